@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"khairul169/garage-webui/schema"
+	"khairul169/garage-webui/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+const usage = `Usage: %s [command]
+
+Commands:
+  serve                                       Start the server (default)
+  user list                                   List the users
+  user add [-role user|admin] <username>      Create a user
+  user passwd <username>                      Change the password of a user
+  user delete <username>                      Delete a user
+  user set-role <username> <admin|user>       Change the role of a user
+  user grant [-cluster name] [-revoke] <username> <bucket> [permissions]
+                                              Grant permissions on a bucket, or "*" for every bucket
+  reset-admin [-username admin]               Reset the password of an admin, created when missing
+  migrate [-bucket-ids]                       Convert a legacy users file
+
+Commands setting a password read it from -password or, with -password-stdin,
+from the standard input. Otherwise a password is generated and printed.
+
+Permissions are a comma separated list of read, write, delete,
+manage_lifecycle, manage_cors, manage_website and delete_bucket, or all.
+They default to read.
+
+The commands are safe while the server runs, which sees their changes.
+`
+
+// runCommand runs a CLI command on the user store and returns the exit
+// code.
+func runCommand(name string, args []string) int {
+	var err error
+
+	switch name {
+	case "user":
+		err = runUserCommand(args)
+	case "reset-admin":
+		err = resetAdmin(args)
+	case "migrate":
+		err = migrate(args)
+	case "help", "-h", "-help", "--help":
+		printUsage(os.Stdout)
+		return 0
+	default:
+		err = fmt.Errorf("unknown command %q", name)
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		var usageErr usageError
+		if errors.As(err, &usageErr) {
+			fmt.Fprintln(os.Stderr)
+			printUsage(os.Stderr)
+		}
+		return 1
+	}
+	return 0
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, usage, filepath.Base(os.Args[0]))
+}
+
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+func runUserCommand(args []string) error {
+	if len(args) == 0 {
+		return usageError("missing user command")
+	}
+
+	if err := utils.OpenUserStore(); err != nil {
+		return err
+	}
+
+	name, args := args[0], args[1:]
+	switch name {
+	case "list":
+		return listUsers()
+	case "add":
+		return addUser(args)
+	case "passwd":
+		return setUserPassword(args)
+	case "delete":
+		return deleteUser(args)
+	case "set-role":
+		return setUserRole(args)
+	case "grant":
+		return grantUser(args)
+	default:
+		return usageError(fmt.Sprintf("unknown user command %q", name))
+	}
+}
+
+func listUsers() error {
+	users := utils.Users.GetAll()
+	slices.SortFunc(users, func(a, b *schema.User) int {
+		return strings.Compare(a.Username, b.Username)
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USERNAME\tROLE\tBUCKETS\tACCESS KEY\tID")
+	for _, user := range users {
+		buckets := make([]string, 0, len(user.BucketPermissions))
+		for _, perm := range user.BucketPermissions {
+			bucket := perm.BucketName
+			if perm.Cluster != "" {
+				bucket = perm.Cluster + "/" + bucket
+			}
+			buckets = append(buckets, bucket)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", user.Username, user.Role, strings.Join(buckets, ","), user.AccessKeyID, user.ID)
+	}
+	return w.Flush()
+}
+
+func addUser(args []string) error {
+	flags := flag.NewFlagSet("user add", flag.ContinueOnError)
+	role := flags.String("role", string(schema.RoleUser), "role of the user, admin or user")
+	password := addPasswordFlags(flags)
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	if err := validateRole(*role); err != nil {
+		return err
+	}
+	pass, err := password()
+	if err != nil {
+		return err
+	}
+
+	user, err := utils.Users.Create(&schema.CreateUserRequest{
+		Username: flags.Arg(0),
+		Password: pass,
+		Role:     schema.UserRole(*role),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %s %s\n", user.Role, user.Username)
+	return nil
+}
+
+func setUserPassword(args []string) error {
+	flags := flag.NewFlagSet("user passwd", flag.ContinueOnError)
+	password := addPasswordFlags(flags)
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	user, err := utils.Users.GetByUsername(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	pass, err := password()
+	if err != nil {
+		return err
+	}
+
+	if _, err := utils.Users.Update(user.ID, &schema.UpdateUserRequest{Password: pass}); err != nil {
+		return err
+	}
+
+	fmt.Printf("Changed the password of %s\n", user.Username)
+	return nil
+}
+
+func deleteUser(args []string) error {
+	flags := flag.NewFlagSet("user delete", flag.ContinueOnError)
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	user, err := utils.Users.GetByUsername(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := utils.Users.Delete(user.ID); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted %s\n", user.Username)
+	return nil
+}
+
+func setUserRole(args []string) error {
+	flags := flag.NewFlagSet("user set-role", flag.ContinueOnError)
+	if err := parseFlags(flags, args, 2); err != nil {
+		return err
+	}
+
+	role := flags.Arg(1)
+	if err := validateRole(role); err != nil {
+		return err
+	}
+
+	user, err := utils.Users.GetByUsername(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if _, err := utils.Users.Update(user.ID, &schema.UpdateUserRequest{Role: schema.UserRole(role)}); err != nil {
+		return err
+	}
+	// Admins have access to every bucket through their key
+	if user.AccessKeyManaged {
+		if err := loadClusters(); err != nil {
+			return err
+		}
+		if err := syncUserKey(user.ID); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%s is now %s\n", user.Username, role)
+	return nil
+}
+
+func grantUser(args []string) error {
+	flags := flag.NewFlagSet("user grant", flag.ContinueOnError)
+	cluster := flags.String("cluster", "", "cluster of the bucket, the default cluster when empty")
+	revoke := flags.Bool("revoke", false, "revoke the permissions on the bucket instead")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 2 || flags.NArg() > 3 {
+		return usageError("user grant requires a username, a bucket and optional permissions")
+	}
+
+	user, err := utils.Users.GetByUsername(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	perm := &schema.BucketPermission{Cluster: *cluster, BucketName: flags.Arg(1)}
+	if err := parsePermissions(perm, flags.Arg(2)); err != nil {
+		return err
+	}
+
+	// Grants on a bucket are bound to its id, and provisioned keys follow
+	// the grants, which requires the cluster
+	if perm.BucketName != "*" || user.AccessKeyManaged {
+		if err := loadClusters(); err != nil {
+			return err
+		}
+	}
+	if err := utils.ResolveBucketPermissions([]*schema.BucketPermission{perm}); err != nil {
+		return err
+	}
+
+	if *revoke {
+		bucketID := perm.BucketID
+		if perm.BucketName == "*" {
+			bucketID = "*"
+		}
+		if err := utils.Users.RemoveBucketPermission(user.ID, perm.Cluster, bucketID); err != nil {
+			return err
+		}
+		if err := syncUserKey(user.ID); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked the permissions of %s on %s\n", user.Username, perm.BucketName)
+		return nil
+	}
+
+	if err := utils.Users.SetBucketPermission(user.ID, perm); err != nil {
+		return err
+	}
+	if err := syncUserKey(user.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Granted %s on %s to %s\n", formatPermissions(perm), perm.BucketName, user.Username)
+	return nil
+}
+
+// resetAdmin sets the password of an admin, restoring its role, or creates
+// it. It recovers access when every admin password is lost.
+func resetAdmin(args []string) error {
+	flags := flag.NewFlagSet("reset-admin", flag.ContinueOnError)
+	username := flags.String("username", "admin", "username of the admin")
+	password := addPasswordFlags(flags)
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	if err := utils.OpenUserStore(); err != nil {
+		return err
+	}
+	pass, err := password()
+	if err != nil {
+		return err
+	}
+
+	user, err := utils.Users.GetByUsername(*username)
+	if err != nil {
+		if _, err := utils.Users.Create(&schema.CreateUserRequest{
+			Username: *username,
+			Password: pass,
+			Role:     schema.RoleAdmin,
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("Created admin %s\n", *username)
+		return nil
+	}
+
+	if _, err := utils.Users.Update(user.ID, &schema.UpdateUserRequest{Password: pass, Role: schema.RoleAdmin}); err != nil {
+		return err
+	}
+	fmt.Printf("Reset the password of admin %s\n", user.Username)
+	return nil
+}
+
+// migrate converts a users file of the legacy format, imported in the
+// database by the SQLite store, and optionally binds the grants by bucket
+// name to the bucket ids.
+func migrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	bucketIDs := flags.Bool("bucket-ids", false, "bind the grants by bucket name to the bucket ids, which requires the clusters")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	legacy, err := utils.IsLegacyUsersFile()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := utils.OpenUserStore(); err != nil {
+		return err
+	}
+
+	if legacy {
+		fmt.Printf("Converted %s, the legacy file is kept in %s.legacy\n", utils.GetUsersPath(), utils.GetUsersPath())
+	} else {
+		fmt.Println("The users are up to date")
+	}
+
+	if !*bucketIDs {
+		return nil
+	}
+	if err := loadClusters(); err != nil {
+		return err
+	}
+	if err := utils.Users.MigrateBucketPermissions(); err != nil {
+		return err
+	}
+	fmt.Println("Bound the bucket grants to the bucket ids")
+	return nil
+}
+
+// syncUserKey updates the provisioned key of a user to their permissions.
+func syncUserKey(id string) error {
+	if err := utils.SyncUserKeyByID(context.Background(), id); err != nil {
+		return fmt.Errorf("permissions updated but access key sync failed: %w", err)
+	}
+	return nil
+}
+
+func loadClusters() error {
+	if err := utils.Garage.LoadConfig(); err != nil {
+		return fmt.Errorf("cannot load garage config: %w", err)
+	}
+	return utils.LoadClusters()
+}
+
+// parseFlags parses the flags of a command requiring n arguments.
+func parseFlags(flags *flag.FlagSet, args []string, n int) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != n {
+		return usageError(fmt.Sprintf("wrong number of arguments for %s", flags.Name()))
+	}
+	return nil
+}
+
+// addPasswordFlags adds the password flags to a command, and returns a
+// function returning the password.
+func addPasswordFlags(flags *flag.FlagSet) func() (string, error) {
+	password := flags.String("password", "", "password, generated when empty")
+	stdin := flags.Bool("password-stdin", false, "read the password from the standard input")
+
+	return func() (string, error) {
+		switch {
+		case *stdin:
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && line == "" {
+				return "", fmt.Errorf("cannot read the password: %w", err)
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				return "", errors.New("password is required")
+			}
+			return line, nil
+		case *password != "":
+			return *password, nil
+		}
+
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		pass := base64.RawURLEncoding.EncodeToString(buf)
+		fmt.Printf("Generated password: %s\n", pass)
+		return pass, nil
+	}
+}
+
+func validateRole(role string) error {
+	if role != string(schema.RoleAdmin) && role != string(schema.RoleUser) {
+		return fmt.Errorf("invalid role %q, must be admin or user", role)
+	}
+	return nil
+}
+
+func parsePermissions(perm *schema.BucketPermission, value string) error {
+	if value == "" {
+		value = "read"
+	}
+
+	for _, name := range strings.Split(value, ",") {
+		switch strings.TrimSpace(name) {
+		case "all":
+			perm.Read, perm.Write, perm.Delete = true, true, true
+			perm.ManageLifecycle, perm.ManageCORS, perm.ManageWebsite = true, true, true
+			perm.DeleteBucket = true
+		case "read":
+			perm.Read = true
+		case "write":
+			perm.Write = true
+		case "delete":
+			perm.Delete = true
+		case "manage_lifecycle":
+			perm.ManageLifecycle = true
+		case "manage_cors":
+			perm.ManageCORS = true
+		case "manage_website":
+			perm.ManageWebsite = true
+		case "delete_bucket":
+			perm.DeleteBucket = true
+		default:
+			return fmt.Errorf("unknown permission %q", name)
+		}
+	}
+	return nil
+}
+
+func formatPermissions(perm *schema.BucketPermission) string {
+	var names []string
+	for _, p := range []struct {
+		name string
+		set  bool
+	}{
+		{"read", perm.Read},
+		{"write", perm.Write},
+		{"delete", perm.Delete},
+		{"manage_lifecycle", perm.ManageLifecycle},
+		{"manage_cors", perm.ManageCORS},
+		{"manage_website", perm.ManageWebsite},
+		{"delete_bucket", perm.DeleteBucket},
+	} {
+		if p.set {
+			names = append(names, p.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
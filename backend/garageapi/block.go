@@ -0,0 +1,47 @@
+package garageapi
+
+import (
+	"context"
+	"khairul169/garage-webui/schema"
+)
+
+func (c *Client) ListBlockErrors(ctx context.Context, node string) (*schema.NodeResponse[[]schema.BlockError], error) {
+	var res schema.NodeResponse[[]schema.BlockError]
+	if err := c.query(ctx, "/v2/ListBlockErrors", nodeQuery(node), nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) GetBlockInfo(ctx context.Context, node string, blockHash string) (*schema.NodeResponse[schema.BlockInfo], error) {
+	var res schema.NodeResponse[schema.BlockInfo]
+	body := map[string]string{"blockHash": blockHash}
+	if err := c.query(ctx, "/v2/GetBlockInfo", nodeQuery(node), body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// RetryBlockResync retries the resync of the given blocks now, or of every
+// block in error if blockHashes is empty.
+func (c *Client) RetryBlockResync(ctx context.Context, node string, blockHashes []string) (*schema.NodeResponse[schema.BlockResyncResult], error) {
+	var res schema.NodeResponse[schema.BlockResyncResult]
+	var body any = map[string]bool{"all": true}
+	if len(blockHashes) > 0 {
+		body = map[string][]string{"blockHashes": blockHashes}
+	}
+	if err := c.post(ctx, "/v2/RetryBlockResync", nodeQuery(node), body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// PurgeBlocks deletes the objects referencing the given blocks, the data is
+// lost.
+func (c *Client) PurgeBlocks(ctx context.Context, node string, blockHashes []string) (*schema.NodeResponse[schema.BlockPurgeResult], error) {
+	var res schema.NodeResponse[schema.BlockPurgeResult]
+	if err := c.post(ctx, "/v2/PurgeBlocks", nodeQuery(node), blockHashes, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
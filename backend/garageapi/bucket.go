@@ -0,0 +1,96 @@
+package garageapi
+
+import (
+	"context"
+	"khairul169/garage-webui/schema"
+	"net/url"
+)
+
+func (c *Client) ListBuckets(ctx context.Context) ([]schema.GetBucketsRes, error) {
+	var res []schema.GetBucketsRes
+	err := c.get(ctx, "/v2/ListBuckets", nil, &res)
+	return res, err
+}
+
+func (c *Client) GetBucketInfo(ctx context.Context, id string) (*schema.Bucket, error) {
+	return c.getBucketInfo(ctx, url.Values{"id": {id}})
+}
+
+func (c *Client) GetBucketByAlias(ctx context.Context, globalAlias string) (*schema.Bucket, error) {
+	return c.getBucketInfo(ctx, url.Values{"globalAlias": {globalAlias}})
+}
+
+// SearchBucket finds a bucket by a prefix of its id, or by a global or local
+// alias.
+func (c *Client) SearchBucket(ctx context.Context, search string) (*schema.Bucket, error) {
+	return c.getBucketInfo(ctx, url.Values{"search": {search}})
+}
+
+func (c *Client) getBucketInfo(ctx context.Context, query url.Values) (*schema.Bucket, error) {
+	var res schema.Bucket
+	if err := c.get(ctx, "/v2/GetBucketInfo", query, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) CreateBucket(ctx context.Context, req *schema.CreateBucketRequest) (*schema.Bucket, error) {
+	var res schema.Bucket
+	if err := c.post(ctx, "/v2/CreateBucket", nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) UpdateBucket(ctx context.Context, id string, req *schema.UpdateBucketRequest) (*schema.Bucket, error) {
+	var res schema.Bucket
+	if err := c.post(ctx, "/v2/UpdateBucket", url.Values{"id": {id}}, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) DeleteBucket(ctx context.Context, id string) error {
+	return c.post(ctx, "/v2/DeleteBucket", url.Values{"id": {id}}, nil, nil)
+}
+
+func (c *Client) CleanupIncompleteUploads(ctx context.Context, id string, olderThanSecs int64) (*schema.CleanupUploadsResult, error) {
+	var res schema.CleanupUploadsResult
+	body := map[string]any{"bucketId": id, "olderThanSecs": olderThanSecs}
+	if err := c.post(ctx, "/v2/CleanupIncompleteUploads", nil, body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) AddBucketAlias(ctx context.Context, req *schema.BucketAliasRequest) (*schema.Bucket, error) {
+	var res schema.Bucket
+	if err := c.post(ctx, "/v2/AddBucketAlias", nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) RemoveBucketAlias(ctx context.Context, req *schema.BucketAliasRequest) (*schema.Bucket, error) {
+	var res schema.Bucket
+	if err := c.post(ctx, "/v2/RemoveBucketAlias", nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) AllowBucketKey(ctx context.Context, req *schema.BucketKeyPermRequest) (*schema.Bucket, error) {
+	var res schema.Bucket
+	if err := c.post(ctx, "/v2/AllowBucketKey", nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) DenyBucketKey(ctx context.Context, req *schema.BucketKeyPermRequest) (*schema.Bucket, error) {
+	var res schema.Bucket
+	if err := c.post(ctx, "/v2/DenyBucketKey", nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
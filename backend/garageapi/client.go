@@ -0,0 +1,225 @@
+// Package garageapi is a typed client of the Garage admin API v2.
+package garageapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTimeout    = 30 * time.Second
+	DefaultMaxRetries = 2
+)
+
+type Client struct {
+	Endpoint   string // e.g. http://localhost:3903
+	Token      string // Admin API bearer token
+	HTTPClient *http.Client
+	MaxRetries int           // Retries of idempotent calls, on network errors and 429/502/503/504
+	RetryDelay time.Duration // Initial backoff, doubled after each retry
+}
+
+func NewClient(endpoint string, token string) *Client {
+	return &Client{
+		Endpoint:   strings.TrimSuffix(endpoint, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+		MaxRetries: DefaultMaxRetries,
+		RetryDelay: 200 * time.Millisecond,
+	}
+}
+
+// Error is a non 2xx response of the admin API.
+type Error struct {
+	Status  int
+	Code    string // Garage error code, e.g. NoSuchBucket
+	Message string
+	Path    string
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	return e.Message
+}
+
+// IsNotFound reports whether err is a 404 response of the admin API.
+func IsNotFound(err error) bool {
+	return StatusOf(err) == http.StatusNotFound
+}
+
+// StatusOf returns the HTTP status of an admin API error, or 0.
+func StatusOf(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+	return 0
+}
+
+type Request struct {
+	Method     string
+	Path       string // e.g. /v2/GetBucketInfo
+	Query      url.Values
+	Body       any
+	Header     http.Header
+	Idempotent bool // Safe to retry, implied for GET
+}
+
+// Do calls the admin API and decodes the JSON response into out, which may
+// be nil. The raw response body is returned as well.
+func (c *Client) Do(ctx context.Context, req *Request, out any) ([]byte, error) {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = json.Marshal(req.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	retries := 0
+	if req.Idempotent || method == http.MethodGet {
+		retries = c.MaxRetries
+	}
+
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		data, err := c.do(ctx, method, req, body)
+		if err == nil {
+			if out != nil && len(data) > 0 {
+				if err := json.Unmarshal(data, out); err != nil {
+					return data, fmt.Errorf("cannot decode %s response: %w", req.Path, err)
+				}
+			}
+			return data, nil
+		}
+
+		if attempt >= retries || !isRetryable(ctx, err) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (c *Client) do(ctx context.Context, method string, req *Request, body []byte) ([]byte, error) {
+	u := c.Endpoint + req.Path
+	if len(req.Query) > 0 {
+		u += "?" + req.Query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range req.Header {
+		httpReq.Header[k] = v
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+c.Token)
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, newError(res.StatusCode, req.Path, data)
+	}
+	return data, nil
+}
+
+// newError parses an error body, which is JSON for errors raised by Garage
+// but may be plain text when returned by a proxy in front of it.
+func newError(status int, path string, body []byte) *Error {
+	apiErr := &Error{Status: status, Path: path}
+
+	var data struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &data); err == nil {
+		apiErr.Code = data.Code
+		apiErr.Message = data.Message
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+
+	if apiErr.Message == "" {
+		apiErr.Message = fmt.Sprintf("unexpected status code: %d", status)
+	}
+	return apiErr
+}
+
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Status {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr)
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	_, err := c.Do(ctx, &Request{Method: http.MethodGet, Path: path, Query: query}, out)
+	return err
+}
+
+func (c *Client) post(ctx context.Context, path string, query url.Values, body any, out any) error {
+	_, err := c.Do(ctx, &Request{Method: http.MethodPost, Path: path, Query: query, Body: body}, out)
+	return err
+}
+
+// query is a POST which doesn't change the cluster state, it may be retried.
+func (c *Client) query(ctx context.Context, path string, query url.Values, body any, out any) error {
+	_, err := c.Do(ctx, &Request{Method: http.MethodPost, Path: path, Query: query, Body: body, Idempotent: true}, out)
+	return err
+}
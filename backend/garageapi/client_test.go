@@ -0,0 +1,478 @@
+package garageapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"khairul169/garage-webui/schema"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testToken = "test-admin-token"
+
+// fakeGarage is an admin API stand-in recording the requests it receives.
+type fakeGarage struct {
+	t        *testing.T
+	mu       sync.Mutex
+	handlers map[string]http.HandlerFunc
+	requests []*recordedRequest
+}
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Query  map[string][]string
+	Header http.Header
+	Body   []byte
+}
+
+func newFakeGarage(t *testing.T) (*fakeGarage, *Client) {
+	f := &fakeGarage{t: t, handlers: map[string]http.HandlerFunc{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL+"/", testToken)
+	client.RetryDelay = time.Millisecond
+	return f, client
+}
+
+func (f *fakeGarage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	f.mu.Lock()
+	f.requests = append(f.requests, &recordedRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+	handler, ok := f.handlers[r.Method+" "+r.URL.Path]
+	f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"code": "Forbidden", "message": "invalid token"})
+		return
+	}
+	if !ok {
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	handler(w, r)
+}
+
+func (f *fakeGarage) handle(pattern string, handler http.HandlerFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[pattern] = handler
+}
+
+// reply answers every call with the same status and JSON body.
+func (f *fakeGarage) reply(pattern string, status int, body any) {
+	f.handle(pattern, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+func (f *fakeGarage) calls() []*recordedRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*recordedRequest(nil), f.requests...)
+}
+
+func (f *fakeGarage) lastCall() *recordedRequest {
+	calls := f.calls()
+	if len(calls) == 0 {
+		f.t.Fatal("no request received")
+	}
+	return calls[len(calls)-1]
+}
+
+func TestAuthHeader(t *testing.T) {
+	f, client := newFakeGarage(t)
+	f.reply("GET /v2/GetClusterHealth", http.StatusOK, schema.ClusterHealth{Status: "healthy"})
+	f.reply("POST /v2/CreateBucket", http.StatusOK, schema.Bucket{ID: "b1"})
+
+	if _, err := client.GetClusterHealth(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	call := f.lastCall()
+	if got := call.Header.Get("Authorization"); got != "Bearer "+testToken {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got := call.Header.Get("Content-Type"); got != "" {
+		t.Errorf("Content-Type of a GET without body = %q", got)
+	}
+
+	alias := "photos"
+	if _, err := client.CreateBucket(context.Background(), &schema.CreateBucketRequest{GlobalAlias: &alias}); err != nil {
+		t.Fatal(err)
+	}
+	call = f.lastCall()
+	if got := call.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	// The token is set last, a custom header cannot override it
+	_, err := client.Do(context.Background(), &Request{
+		Path:   "/v2/GetClusterHealth",
+		Header: http.Header{"Authorization": {"Bearer other"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Token = "wrong"
+	_, err = client.GetClusterHealth(context.Background())
+	if StatusOf(err) != http.StatusUnauthorized {
+		t.Errorf("StatusOf(%v) = %d, want 401", err, StatusOf(err))
+	}
+}
+
+func TestErrorDecoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		code    string
+		message string
+	}{
+		{"json", http.StatusNotFound, `{"code":"NoSuchBucket","message":"Bucket not found: x","region":"garage","path":"/v2/GetBucketInfo"}`, "NoSuchBucket", "Bucket not found: x"},
+		{"plain text", http.StatusBadRequest, "invalid alias\n", "", "invalid alias"},
+		{"html proxy page", http.StatusConflict, "<html>conflict</html>", "", "<html>conflict</html>"},
+		{"empty", http.StatusNotFound, "", "", "unexpected status code: 404"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, client := newFakeGarage(t)
+			f.handle("GET /v2/GetBucketInfo", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			})
+
+			_, err := client.GetBucketInfo(context.Background(), "x")
+
+			var apiErr *Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error %v is not an *Error", err)
+			}
+			if apiErr.Status != tt.status || apiErr.Code != tt.code || apiErr.Message != tt.message {
+				t.Errorf("got %+v", apiErr)
+			}
+			if apiErr.Path != "/v2/GetBucketInfo" {
+				t.Errorf("Path = %q", apiErr.Path)
+			}
+			if IsNotFound(err) != (tt.status == http.StatusNotFound) {
+				t.Errorf("IsNotFound = %v", IsNotFound(err))
+			}
+		})
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := &Error{Status: 404, Code: "NoSuchKey", Message: "Key not found"}
+	if err.Error() != "NoSuchKey: Key not found" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	err.Code = ""
+	if err.Error() != "Key not found" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	if StatusOf(errors.New("other")) != 0 {
+		t.Error("StatusOf of a non API error is not 0")
+	}
+}
+
+func TestInvalidJSONResponse(t *testing.T) {
+	f, client := newFakeGarage(t)
+	f.handle("GET /v2/GetClusterStatus", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "not json")
+	})
+
+	_, err := client.GetClusterStatus(context.Background())
+	if err == nil || StatusOf(err) != 0 {
+		t.Fatalf("expected a decode error, got %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		call      func(c *Client) error
+		pattern   string
+		status    int
+		wantCalls int
+	}{
+		{
+			name:      "get retried on unavailable",
+			call:      func(c *Client) error { _, err := c.GetClusterHealth(context.Background()); return err },
+			pattern:   "GET /v2/GetClusterHealth",
+			status:    http.StatusServiceUnavailable,
+			wantCalls: DefaultMaxRetries + 1,
+		},
+		{
+			name:      "get not retried on client error",
+			call:      func(c *Client) error { _, err := c.GetClusterHealth(context.Background()); return err },
+			pattern:   "GET /v2/GetClusterHealth",
+			status:    http.StatusBadRequest,
+			wantCalls: 1,
+		},
+		{
+			name:      "post not retried",
+			call:      func(c *Client) error { return c.DeleteBucket(context.Background(), "b1") },
+			pattern:   "POST /v2/DeleteBucket",
+			status:    http.StatusServiceUnavailable,
+			wantCalls: 1,
+		},
+		{
+			name: "read only post retried",
+			call: func(c *Client) error {
+				_, err := c.GetWorkerInfo(context.Background(), NodeSelf, 1)
+				return err
+			},
+			pattern:   "POST /v2/GetWorkerInfo",
+			status:    http.StatusBadGateway,
+			wantCalls: DefaultMaxRetries + 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, client := newFakeGarage(t)
+			f.reply(tt.pattern, tt.status, map[string]string{"code": "Error", "message": "failed"})
+
+			err := tt.call(client)
+			if StatusOf(err) != tt.status {
+				t.Errorf("StatusOf(%v) = %d, want %d", err, StatusOf(err), tt.status)
+			}
+			if got := len(f.calls()); got != tt.wantCalls {
+				t.Errorf("%d calls, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	f, client := newFakeGarage(t)
+
+	attempts := 0
+	f.handle("GET /v2/ListBuckets", func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		json.NewEncoder(w).Encode([]schema.GetBucketsRes{{ID: "b1"}})
+	})
+
+	buckets, err := client.ListBuckets(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 1 || buckets[0].ID != "b1" || attempts != 2 {
+		t.Errorf("got %+v after %d attempts", buckets, attempts)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	f, client := newFakeGarage(t)
+	client.RetryDelay = time.Hour
+	f.reply("GET /v2/GetClusterHealth", http.StatusServiceUnavailable, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetClusterHealth(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want deadline exceeded", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("the retry backoff ignored the context")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	f, client := newFakeGarage(t)
+	client.HTTPClient.Timeout = 20 * time.Millisecond
+	client.MaxRetries = 0
+
+	done := make(chan struct{})
+	defer close(done)
+	f.handle("GET /v2/GetClusterHealth", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	})
+
+	if _, err := client.GetClusterHealth(context.Background()); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+}
+
+func TestBucketEndpoints(t *testing.T) {
+	f, client := newFakeGarage(t)
+	f.reply("GET /v2/GetBucketInfo", http.StatusOK, schema.Bucket{ID: "b1", GlobalAliases: []string{"a b&c"}})
+	f.reply("POST /v2/UpdateBucket", http.StatusOK, schema.Bucket{ID: "b1"})
+	f.reply("POST /v2/AllowBucketKey", http.StatusOK, schema.Bucket{ID: "b1"})
+
+	bucket, err := client.GetBucketByAlias(context.Background(), "a b&c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bucket.ID != "b1" {
+		t.Errorf("bucket = %+v", bucket)
+	}
+	if got := f.lastCall().Query["globalAlias"]; len(got) != 1 || got[0] != "a b&c" {
+		t.Errorf("globalAlias query = %q", got)
+	}
+
+	if _, err := client.SearchBucket(context.Background(), "photos"); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.lastCall().Query["search"]; len(got) != 1 || got[0] != "photos" {
+		t.Errorf("search query = %q", got)
+	}
+
+	_, err = client.UpdateBucket(context.Background(), "b1", &schema.UpdateBucketRequest{
+		WebsiteAccess: &schema.UpdateWebsiteAccess{Enabled: true, IndexDocument: "index.html"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := f.lastCall()
+	if got := call.Query["id"]; len(got) != 1 || got[0] != "b1" {
+		t.Errorf("id query = %q", got)
+	}
+	var update schema.UpdateBucketRequest
+	if err := json.Unmarshal(call.Body, &update); err != nil {
+		t.Fatal(err)
+	}
+	if update.WebsiteAccess == nil || !update.WebsiteAccess.Enabled || update.Quotas != nil {
+		t.Errorf("update body = %s", call.Body)
+	}
+
+	_, err = client.AllowBucketKey(context.Background(), &schema.BucketKeyPermRequest{
+		BucketID:    "b1",
+		AccessKeyID: "GK1",
+		Permissions: schema.Permissions{Read: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var perm schema.BucketKeyPermRequest
+	if err := json.Unmarshal(f.lastCall().Body, &perm); err != nil {
+		t.Fatal(err)
+	}
+	if perm.BucketID != "b1" || perm.AccessKeyID != "GK1" || !perm.Permissions.Read || perm.Permissions.Write {
+		t.Errorf("permission body = %s", f.lastCall().Body)
+	}
+}
+
+func TestKeyEndpoints(t *testing.T) {
+	f, client := newFakeGarage(t)
+	f.reply("GET /v2/GetKeyInfo", http.StatusOK, schema.KeyInfo{AccessKeyID: "GK1", SecretAccessKey: "secret"})
+	f.reply("POST /v2/DeleteKey", http.StatusOK, nil)
+
+	key, err := client.GetKeyInfo(context.Background(), "GK1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.SecretAccessKey != "secret" {
+		t.Errorf("key = %+v", key)
+	}
+	query := f.lastCall().Query
+	if query["id"][0] != "GK1" || query["showSecretKey"][0] != "true" {
+		t.Errorf("query = %v", query)
+	}
+
+	if err := client.DeleteKey(context.Background(), "GK1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.lastCall().Query["id"]; len(got) != 1 || got[0] != "GK1" {
+		t.Errorf("id query = %q", got)
+	}
+}
+
+func TestLayoutEndpoints(t *testing.T) {
+	f, client := newFakeGarage(t)
+	f.reply("GET /v2/GetClusterLayout", http.StatusOK, schema.ClusterLayout{Version: 3})
+	f.reply("POST /v2/ApplyClusterLayout", http.StatusOK, schema.ApplyLayoutResult{})
+
+	layout, err := client.GetClusterLayout(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.Version != 3 {
+		t.Errorf("layout = %+v", layout)
+	}
+
+	if _, err := client.ApplyClusterLayout(context.Background(), layout.Version+1); err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]int64
+	if err := json.Unmarshal(f.lastCall().Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["version"] != 4 {
+		t.Errorf("apply body = %s", f.lastCall().Body)
+	}
+}
+
+func TestNodeEndpoints(t *testing.T) {
+	f, client := newFakeGarage(t)
+	f.reply("GET /v2/GetNodeInfo", http.StatusOK, schema.NodeResponse[schema.NodeInfo]{
+		Success: map[string]schema.NodeInfo{"n1": {NodeID: "n1", GarageVersion: "v2.0.0"}},
+		Error:   map[string]string{"n2": "unreachable"},
+	})
+	f.reply("POST /v2/GetWorkerVariable", http.StatusOK, schema.NodeResponse[map[string]string]{
+		Success: map[string]map[string]string{"n1": {"resync-tranquility": "2"}},
+	})
+	f.reply("POST /v2/RetryBlockResync", http.StatusOK, schema.NodeResponse[schema.BlockResyncResult]{})
+
+	info, err := client.GetNodeInfo(context.Background(), NodeAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Success["n1"].GarageVersion != "v2.0.0" || info.Error["n2"] != "unreachable" {
+		t.Errorf("node info = %+v", info)
+	}
+	if got := f.lastCall().Query["node"]; len(got) != 1 || got[0] != "*" {
+		t.Errorf("node query = %q", got)
+	}
+
+	variables, err := client.GetWorkerVariable(context.Background(), NodeSelf, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if variables.Success["n1"]["resync-tranquility"] != "2" {
+		t.Errorf("variables = %+v", variables)
+	}
+	if string(f.lastCall().Body) != `{"variable":null}` {
+		t.Errorf("worker variable body = %s", f.lastCall().Body)
+	}
+
+	if _, err := client.RetryBlockResync(context.Background(), NodeSelf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if string(f.lastCall().Body) != `{"all":true}` {
+		t.Errorf("resync body = %s", f.lastCall().Body)
+	}
+	if _, err := client.RetryBlockResync(context.Background(), NodeSelf, []string{"h1"}); err != nil {
+		t.Fatal(err)
+	}
+	if string(f.lastCall().Body) != `{"blockHashes":["h1"]}` {
+		t.Errorf("resync body = %s", f.lastCall().Body)
+	}
+}
@@ -0,0 +1,82 @@
+package garageapi
+
+import (
+	"context"
+	"khairul169/garage-webui/schema"
+)
+
+func (c *Client) GetClusterHealth(ctx context.Context) (*schema.ClusterHealth, error) {
+	var res schema.ClusterHealth
+	if err := c.get(ctx, "/v2/GetClusterHealth", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) GetClusterStatus(ctx context.Context) (*schema.ClusterStatus, error) {
+	var res schema.ClusterStatus
+	if err := c.get(ctx, "/v2/GetClusterStatus", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) GetClusterStatistics(ctx context.Context) (*schema.ClusterStatistics, error) {
+	var res schema.ClusterStatistics
+	if err := c.get(ctx, "/v2/GetClusterStatistics", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ConnectClusterNodes connects to nodes given as <node_id>@<host>:<port>.
+func (c *Client) ConnectClusterNodes(ctx context.Context, nodes []string) ([]schema.ConnectNodeResult, error) {
+	var res []schema.ConnectNodeResult
+	err := c.post(ctx, "/v2/ConnectClusterNodes", nil, nodes, &res)
+	return res, err
+}
+
+func (c *Client) GetClusterLayout(ctx context.Context) (*schema.ClusterLayout, error) {
+	var res schema.ClusterLayout
+	if err := c.get(ctx, "/v2/GetClusterLayout", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// UpdateClusterLayout stages role changes, they are only effective once
+// applied with ApplyClusterLayout.
+func (c *Client) UpdateClusterLayout(ctx context.Context, req *schema.UpdateLayoutRequest) (*schema.ClusterLayout, error) {
+	var res schema.ClusterLayout
+	if err := c.post(ctx, "/v2/UpdateClusterLayout", nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) PreviewClusterLayoutChanges(ctx context.Context) (*schema.PreviewLayoutResult, error) {
+	var res schema.PreviewLayoutResult
+	if err := c.query(ctx, "/v2/PreviewClusterLayoutChanges", nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ApplyClusterLayout applies the staged changes, version must be the current
+// layout version plus one.
+func (c *Client) ApplyClusterLayout(ctx context.Context, version int64) (*schema.ApplyLayoutResult, error) {
+	var res schema.ApplyLayoutResult
+	body := map[string]int64{"version": version}
+	if err := c.post(ctx, "/v2/ApplyClusterLayout", nil, body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) RevertClusterLayout(ctx context.Context) (*schema.ClusterLayout, error) {
+	var res schema.ClusterLayout
+	if err := c.post(ctx, "/v2/RevertClusterLayout", nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
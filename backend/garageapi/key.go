@@ -0,0 +1,62 @@
+package garageapi
+
+import (
+	"context"
+	"khairul169/garage-webui/schema"
+	"net/url"
+	"strconv"
+)
+
+func (c *Client) ListKeys(ctx context.Context) ([]schema.ListKeysRes, error) {
+	var res []schema.ListKeysRes
+	err := c.get(ctx, "/v2/ListKeys", nil, &res)
+	return res, err
+}
+
+func (c *Client) GetKeyInfo(ctx context.Context, id string, showSecretKey bool) (*schema.KeyInfo, error) {
+	query := url.Values{"id": {id}, "showSecretKey": {strconv.FormatBool(showSecretKey)}}
+	return c.getKeyInfo(ctx, query)
+}
+
+// SearchKey finds a key by a prefix of its id or by its name.
+func (c *Client) SearchKey(ctx context.Context, search string, showSecretKey bool) (*schema.KeyInfo, error) {
+	query := url.Values{"search": {search}, "showSecretKey": {strconv.FormatBool(showSecretKey)}}
+	return c.getKeyInfo(ctx, query)
+}
+
+func (c *Client) getKeyInfo(ctx context.Context, query url.Values) (*schema.KeyInfo, error) {
+	var res schema.KeyInfo
+	if err := c.get(ctx, "/v2/GetKeyInfo", query, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// CreateKey creates an access key, the response includes its secret.
+func (c *Client) CreateKey(ctx context.Context, req *schema.CreateKeyRequest) (*schema.KeyInfo, error) {
+	var res schema.KeyInfo
+	if err := c.post(ctx, "/v2/CreateKey", nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) ImportKey(ctx context.Context, req *schema.ImportKeyRequest) (*schema.KeyInfo, error) {
+	var res schema.KeyInfo
+	if err := c.post(ctx, "/v2/ImportKey", nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) UpdateKey(ctx context.Context, id string, req *schema.UpdateKeyRequest) (*schema.KeyInfo, error) {
+	var res schema.KeyInfo
+	if err := c.post(ctx, "/v2/UpdateKey", url.Values{"id": {id}}, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) DeleteKey(ctx context.Context, id string) error {
+	return c.post(ctx, "/v2/DeleteKey", url.Values{"id": {id}}, nil, nil)
+}
@@ -0,0 +1,94 @@
+package garageapi
+
+import (
+	"context"
+	"khairul169/garage-webui/schema"
+	"net/url"
+)
+
+// Node endpoints target a node id, "self" for the node serving the admin API
+// or "*" for every node of the cluster.
+const (
+	NodeSelf = "self"
+	NodeAll  = "*"
+)
+
+func nodeQuery(node string) url.Values {
+	return url.Values{"node": {node}}
+}
+
+func (c *Client) GetNodeInfo(ctx context.Context, node string) (*schema.NodeResponse[schema.NodeInfo], error) {
+	var res schema.NodeResponse[schema.NodeInfo]
+	if err := c.get(ctx, "/v2/GetNodeInfo", nodeQuery(node), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) GetNodeStatistics(ctx context.Context, node string) (*schema.NodeResponse[schema.NodeStatistics], error) {
+	var res schema.NodeResponse[schema.NodeStatistics]
+	if err := c.get(ctx, "/v2/GetNodeStatistics", nodeQuery(node), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) CreateMetadataSnapshot(ctx context.Context, node string) (*schema.NodeResponse[any], error) {
+	var res schema.NodeResponse[any]
+	if err := c.post(ctx, "/v2/CreateMetadataSnapshot", nodeQuery(node), nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// LaunchRepairOperation starts a repair, e.g. "tables", "blocks", "versions"
+// or "rebalance".
+func (c *Client) LaunchRepairOperation(ctx context.Context, node string, repairType string) (*schema.NodeResponse[any], error) {
+	var res schema.NodeResponse[any]
+	body := map[string]string{"repairType": repairType}
+	if err := c.post(ctx, "/v2/LaunchRepairOperation", nodeQuery(node), body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) ListWorkers(ctx context.Context, node string, busyOnly bool, errorOnly bool) (*schema.NodeResponse[[]schema.WorkerInfo], error) {
+	var res schema.NodeResponse[[]schema.WorkerInfo]
+	body := map[string]bool{"busyOnly": busyOnly, "errorOnly": errorOnly}
+	if err := c.query(ctx, "/v2/ListWorkers", nodeQuery(node), body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) GetWorkerInfo(ctx context.Context, node string, id int64) (*schema.NodeResponse[schema.WorkerInfo], error) {
+	var res schema.NodeResponse[schema.WorkerInfo]
+	body := map[string]int64{"id": id}
+	if err := c.query(ctx, "/v2/GetWorkerInfo", nodeQuery(node), body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GetWorkerVariable returns a worker variable, or every variable if name is
+// empty.
+func (c *Client) GetWorkerVariable(ctx context.Context, node string, name string) (*schema.NodeResponse[map[string]string], error) {
+	var res schema.NodeResponse[map[string]string]
+	body := map[string]*string{"variable": nil}
+	if name != "" {
+		body["variable"] = &name
+	}
+	if err := c.query(ctx, "/v2/GetWorkerVariable", nodeQuery(node), body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) SetWorkerVariable(ctx context.Context, node string, name string, value string) (*schema.NodeResponse[schema.WorkerVariable], error) {
+	var res schema.NodeResponse[schema.WorkerVariable]
+	body := schema.WorkerVariable{Variable: name, Value: value}
+	if err := c.post(ctx, "/v2/SetWorkerVariable", nodeQuery(node), body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -13,8 +13,17 @@ import (
 )
 
 func main() {
-	// Initialize app
 	godotenv.Load()
+
+	// Run a command, serve by default
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+	serve()
+}
+
+func serve() {
+	// Initialize app
 	utils.InitCacheManager()
 	sessionMgr := utils.InitSessionManager()
 
@@ -23,10 +32,44 @@ func main() {
 		log.Fatal("Failed to initialize user store:", err)
 	}
 
+	if err := utils.InitTemplateStore(); err != nil {
+		log.Fatal("Failed to initialize template store:", err)
+	}
+
+	if err := utils.InitPolicyStore(); err != nil {
+		log.Fatal("Failed to initialize lifecycle policy store:", err)
+	}
+
 	if err := utils.Garage.LoadConfig(); err != nil {
 		log.Println("Cannot load garage config!", err)
 	}
 
+	if err := utils.LoadClusters(); err != nil {
+		log.Fatal("Failed to load clusters:", err)
+	}
+
+	go func() {
+		if err := utils.Users.MigrateBucketPermissions(); err != nil {
+			log.Println("Cannot migrate bucket permissions!", err)
+		}
+	}()
+
+	if err := utils.InitManagedKey(); err != nil {
+		log.Fatal("Failed to initialize managed access key:", err)
+	}
+
+	if err := utils.InitIndexer(); err != nil {
+		log.Println("Cannot initialize key index!", err)
+	}
+
+	if err := utils.InitUsageCollector(); err != nil {
+		log.Println("Cannot initialize usage history!", err)
+	}
+
+	if err := utils.InitAlertManager(); err != nil {
+		log.Fatal("Failed to initialize alerts:", err)
+	}
+
 	basePath := os.Getenv("BASE_PATH")
 	mux := http.NewServeMux()
 
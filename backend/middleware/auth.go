@@ -54,7 +54,7 @@ func BucketPermissionMiddleware(next http.Handler) http.Handler {
 		}
 
 		// Check bucket permission
-		if !utils.Users.HasBucketPermission(user.ID, bucket) {
+		if !utils.Users.HasBucketPermission(utils.GetRequestCluster(r), user.ID, bucket) {
 			utils.ResponseErrorStatus(w, errors.New("forbidden: no permission for this bucket"), http.StatusForbidden)
 			return
 		}
@@ -116,7 +116,7 @@ func BucketActionMiddleware(action string) func(http.Handler) http.Handler {
 			}
 
 			// Check specific permission
-			if !utils.Users.HasBucketPermissionDetailed(user.ID, bucket, action) {
+			if !utils.Users.HasBucketPermissionDetailed(utils.GetRequestCluster(r), user.ID, bucket, action) {
 				utils.ResponseErrorStatus(w, errors.New("forbidden: insufficient permissions for this action"), http.StatusForbidden)
 				return
 			}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"khairul169/garage-webui/utils"
+	"net/http"
+	"strings"
+)
+
+// ClusterMiddleware selects the cluster of a request, either from a
+// /clusters/{name}/ path prefix, which is stripped, or from the
+// X-Garage-Cluster header. Requests without a selector use the default
+// cluster.
+func ClusterMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(utils.ClusterHeader)
+		path, rawPath := r.URL.Path, r.URL.RawPath
+
+		if cluster, rest, ok := cutClusterPrefix(path); ok {
+			name = cluster
+			path = rest
+			if _, rawRest, ok := cutClusterPrefix(rawPath); ok {
+				rawPath = rawRest
+			}
+		}
+
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cluster, err := utils.Clusters.Get(name)
+		if err != nil {
+			utils.ResponseErrorStatus(w, errors.New("cluster not found: "+name), http.StatusNotFound)
+			return
+		}
+
+		r2 := r.WithContext(utils.WithCluster(r.Context(), cluster))
+		if path != r.URL.Path {
+			u := *r.URL
+			u.Path = path
+			u.RawPath = rawPath
+			r2.URL = &u
+		}
+
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// cutClusterPrefix splits /clusters/{name}/{rest...} into name and /rest.
+func cutClusterPrefix(path string) (string, string, bool) {
+	remaining, ok := strings.CutPrefix(path, "/clusters/")
+	if !ok {
+		return "", "", false
+	}
+	name, rest, found := strings.Cut(remaining, "/")
+	if !found || rest == "" {
+		return "", "", false
+	}
+	return name, "/" + rest, true
+}
@@ -0,0 +1,164 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"khairul169/garage-webui/schema"
+	"khairul169/garage-webui/utils"
+	"net/http"
+)
+
+type Alerts struct{}
+
+func (a *Alerts) GetAll(w http.ResponseWriter, r *http.Request) {
+	state := schema.AlertState(r.URL.Query().Get("state"))
+	utils.ResponseSuccess(w, utils.Alerts.GetAlerts(state))
+}
+
+// Evaluate evaluates the rules now instead of waiting for ALERTS_INTERVAL.
+func (a *Alerts) Evaluate(w http.ResponseWriter, r *http.Request) {
+	utils.Alerts.Evaluate(r.Context())
+	utils.ResponseSuccess(w, utils.Alerts.GetAlerts(schema.AlertFiring))
+}
+
+func (a *Alerts) GetRules(w http.ResponseWriter, r *http.Request) {
+	utils.ResponseSuccess(w, utils.Alerts.GetRules())
+}
+
+func (a *Alerts) CreateRule(w http.ResponseWriter, r *http.Request) {
+	var rule schema.AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	res, err := utils.Alerts.CreateRule(&rule)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, getAlertErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+func (a *Alerts) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	var rule schema.AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	res, err := utils.Alerts.UpdateRule(r.PathValue("id"), &rule)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, getAlertErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+func (a *Alerts) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	if err := utils.Alerts.DeleteRule(r.PathValue("id")); err != nil {
+		utils.ResponseErrorStatus(w, err, getAlertErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, map[string]bool{"success": true})
+}
+
+func (a *Alerts) GetChannels(w http.ResponseWriter, r *http.Request) {
+	utils.ResponseSuccess(w, utils.Alerts.GetChannels())
+}
+
+func (a *Alerts) CreateChannel(w http.ResponseWriter, r *http.Request) {
+	var channel schema.AlertChannel
+	if err := json.NewDecoder(r.Body).Decode(&channel); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	res, err := utils.Alerts.CreateChannel(&channel)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, getAlertErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+func (a *Alerts) UpdateChannel(w http.ResponseWriter, r *http.Request) {
+	var channel schema.AlertChannel
+	if err := json.NewDecoder(r.Body).Decode(&channel); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	res, err := utils.Alerts.UpdateChannel(r.PathValue("id"), &channel)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, getAlertErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+func (a *Alerts) DeleteChannel(w http.ResponseWriter, r *http.Request) {
+	if err := utils.Alerts.DeleteChannel(r.PathValue("id")); err != nil {
+		utils.ResponseErrorStatus(w, err, getAlertErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, map[string]bool{"success": true})
+}
+
+func (a *Alerts) TestChannel(w http.ResponseWriter, r *http.Request) {
+	if err := utils.Alerts.TestChannel(r.PathValue("id")); err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, utils.ErrAlertChannelNotFound) {
+			status = http.StatusNotFound
+		}
+		utils.ResponseErrorStatus(w, err, status)
+		return
+	}
+
+	utils.ResponseSuccess(w, map[string]bool{"success": true})
+}
+
+func (a *Alerts) GetSilences(w http.ResponseWriter, r *http.Request) {
+	utils.ResponseSuccess(w, utils.Alerts.GetSilences())
+}
+
+func (a *Alerts) CreateSilence(w http.ResponseWriter, r *http.Request) {
+	var silence schema.AlertSilence
+	if err := json.NewDecoder(r.Body).Decode(&silence); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	username, _ := utils.Session.Get(r, "username").(string)
+	res, err := utils.Alerts.CreateSilence(&silence, username)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, getAlertErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+func (a *Alerts) DeleteSilence(w http.ResponseWriter, r *http.Request) {
+	if err := utils.Alerts.DeleteSilence(r.PathValue("id")); err != nil {
+		utils.ResponseErrorStatus(w, err, getAlertErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, map[string]bool{"success": true})
+}
+
+func getAlertErrorStatus(err error) int {
+	if errors.Is(err, utils.ErrAlertRuleNotFound) ||
+		errors.Is(err, utils.ErrAlertChannelNotFound) ||
+		errors.Is(err, utils.ErrAlertSilenceNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
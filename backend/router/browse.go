@@ -10,12 +10,12 @@ import (
 	"khairul169/garage-webui/schema"
 	"khairul169/garage-webui/utils"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go"
@@ -34,14 +34,14 @@ func (b *Browse) GetObjects(w http.ResponseWriter, r *http.Request) {
 		limit = 100
 	}
 
-	client, err := getS3Client(bucket)
+	client, err := getS3Client(r, bucket)
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
 	}
 
-	objects, err := client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
-		Bucket:            aws.String(bucket),
+	objects, err := client.ListObjectsV2(r.Context(), &s3.ListObjectsV2Input{
+		Bucket:            aws.String(client.Name),
 		Prefix:            aws.String(prefix),
 		Delimiter:         aws.String("/"),
 		MaxKeys:           aws.Int32(int32(limit)),
@@ -88,16 +88,22 @@ func (b *Browse) GetOneObject(w http.ResponseWriter, r *http.Request) {
 	view := queryParams.Get("view") == "1"
 	thumbnail := queryParams.Get("thumb") == "1"
 	download := queryParams.Get("dl") == "1"
+	verify := queryParams.Get("verify") == "1"
 
-	client, err := getS3Client(bucket)
+	client, err := getS3Client(r, bucket)
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
 	}
 
+	if verify {
+		b.verifyObject(w, r, client, key)
+		return
+	}
+
 	if !view && !download && !thumbnail {
-		object, err := client.HeadObject(context.Background(), &s3.HeadObjectInput{
-			Bucket: aws.String(bucket),
+		object, err := client.HeadObject(r.Context(), &s3.HeadObjectInput{
+			Bucket: aws.String(client.Name),
 			Key:    aws.String(key),
 		})
 		if err != nil {
@@ -107,8 +113,8 @@ func (b *Browse) GetOneObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	object, err := client.GetObject(context.Background(), &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
+	object, err := client.GetObject(r.Context(), &s3.GetObjectInput{
+		Bucket: aws.String(client.Name),
 		Key:    aws.String(key),
 	})
 
@@ -170,6 +176,41 @@ func (b *Browse) GetOneObject(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// verifyObject recomputes the SHA-256 of an object by streaming its content
+// and compares it against the digest stored in the object metadata.
+func (b *Browse) verifyObject(w http.ResponseWriter, r *http.Request, client *utils.S3Bucket, key string) {
+	object, err := client.GetObject(r.Context(), &s3.GetObjectInput{
+		Bucket: aws.String(client.Name),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var ae smithy.APIError
+		if errors.As(err, &ae) && ae.ErrorCode() == "NoSuchKey" {
+			utils.ResponseErrorStatus(w, err, http.StatusNotFound)
+			return
+		}
+		utils.ResponseError(w, err)
+		return
+	}
+	defer object.Body.Close()
+
+	sum, size, err := utils.HashReader(object.Body)
+	if err != nil {
+		utils.ResponseError(w, fmt.Errorf("cannot read object: %w", err))
+		return
+	}
+
+	expected := object.Metadata[utils.ChecksumMetadataKey]
+	utils.ResponseSuccess(w, schema.ObjectChecksumResult{
+		Key:       key,
+		Algorithm: "SHA256",
+		Expected:  expected,
+		Actual:    sum,
+		Size:      size,
+		Match:     expected != "" && strings.EqualFold(expected, sum),
+	})
+}
+
 func (b *Browse) PutObject(w http.ResponseWriter, r *http.Request) {
 	bucket := r.PathValue("bucket")
 	key := r.PathValue("key")
@@ -185,33 +226,83 @@ func (b *Browse) PutObject(w http.ResponseWriter, r *http.Request) {
 		defer file.Close()
 	}
 
-	client, err := getS3Client(bucket)
+	client, err := getS3Client(r, bucket)
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
 	}
 
-	var contentType string = ""
+	checksum, err := utils.ParseChecksum(
+		firstNonEmpty(r.FormValue("md5"), r.Header.Get("Content-MD5")),
+		firstNonEmpty(r.FormValue("sha256"), r.Header.Get("X-Amz-Checksum-Sha256")),
+	)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	objectHeaders, err := getUploadHeaders(r)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var contentType string = objectHeaders.ContentType
 	var size int64 = 0
+	metadata := objectHeaders.Metadata
 
 	if file != nil {
-		contentType = headers.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = headers.Header.Get("Content-Type")
+		}
 		size = headers.Size
+
+		// Hash the file before sending it, the digest is kept in the object
+		// metadata so the object can be verified later on.
+		sum, _, err := utils.HashReader(file)
+		if err != nil {
+			utils.ResponseError(w, err)
+			return
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			utils.ResponseError(w, err)
+			return
+		}
+		if checksum.SHA256 != "" && checksum.SHA256Hex() != sum {
+			utils.ResponseErrorStatus(w, errors.New("sha256 checksum mismatch"), http.StatusBadRequest)
+			return
+		}
+		metadata[utils.ChecksumMetadataKey] = sum
 	}
 
-	result, err := client.PutObject(context.Background(), &s3.PutObjectInput{
-		Bucket:        aws.String(bucket),
-		Key:           aws.String(key),
-		Body:          file,
-		ContentLength: aws.Int64(size),
-		ContentType:   aws.String(contentType),
-	})
+	input := &s3.PutObjectInput{
+		Bucket:             aws.String(client.Name),
+		Key:                aws.String(key),
+		Body:               file,
+		ContentLength:      aws.Int64(size),
+		ContentType:        aws.String(contentType),
+		CacheControl:       getStringPtr(objectHeaders.CacheControl),
+		ContentDisposition: getStringPtr(objectHeaders.ContentDisposition),
+		ContentEncoding:    getStringPtr(objectHeaders.ContentEncoding),
+		ContentLanguage:    getStringPtr(objectHeaders.ContentLanguage),
+		Metadata:           metadata,
+	}
+	if checksum.ContentMD5 != "" {
+		input.ContentMD5 = aws.String(checksum.ContentMD5)
+	}
+	if checksum.SHA256 != "" {
+		input.ChecksumSHA256 = aws.String(checksum.SHA256)
+	}
+
+	result, err := client.PutObject(r.Context(), input)
 
 	if err != nil {
-		utils.ResponseError(w, fmt.Errorf("cannot put object: %w", err))
+		utils.ResponseErrorStatus(w, fmt.Errorf("cannot put object: %w", err), getChecksumErrorStatus(err))
 		return
 	}
 
+	utils.Index.Refresh(client, key)
+
 	utils.ResponseSuccess(w, result)
 }
 
@@ -221,7 +312,8 @@ func (b *Browse) CreateMultipartUpload(w http.ResponseWriter, r *http.Request) {
 	key := r.PathValue("key")
 
 	var body struct {
-		ContentType string `json:"contentType"`
+		schema.ObjectHeaders
+		SHA256 string `json:"sha256"` // Optional checksum of the full object, verified on completion
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
@@ -229,12 +321,29 @@ func (b *Browse) CreateMultipartUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := normalizeObjectHeaders(&body.ObjectHeaders); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	checksum, err := utils.ParseChecksum("", body.SHA256)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// The metadata of the object cannot be changed once completed without
+	// copying it, so the declared checksum is stored upfront.
+	if checksum.SHA256 != "" {
+		body.Metadata[utils.ChecksumMetadataKey] = checksum.SHA256Hex()
+	}
+
 	// Default content type if not provided
 	if body.ContentType == "" {
 		body.ContentType = "application/octet-stream"
 	}
 
-	client, err := getS3Client(bucket)
+	client, err := getS3Client(r, bucket)
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
@@ -242,8 +351,13 @@ func (b *Browse) CreateMultipartUpload(w http.ResponseWriter, r *http.Request) {
 
 	// Create input for multipart upload
 	input := &s3.CreateMultipartUploadInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
+		Bucket:             aws.String(client.Name),
+		Key:                aws.String(key),
+		CacheControl:       getStringPtr(body.CacheControl),
+		ContentDisposition: getStringPtr(body.ContentDisposition),
+		ContentEncoding:    getStringPtr(body.ContentEncoding),
+		ContentLanguage:    getStringPtr(body.ContentLanguage),
+		Metadata:           body.Metadata,
 	}
 
 	// Only set ContentType if it's not empty
@@ -251,7 +365,7 @@ func (b *Browse) CreateMultipartUpload(w http.ResponseWriter, r *http.Request) {
 		input.ContentType = aws.String(body.ContentType)
 	}
 
-	result, err := client.CreateMultipartUpload(context.Background(), input)
+	result, err := client.CreateMultipartUpload(r.Context(), input)
 
 	if err != nil {
 		utils.ResponseError(w, fmt.Errorf("cannot create multipart upload: %w", err))
@@ -277,7 +391,13 @@ func (b *Browse) UploadPart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client, err := getS3Client(bucket)
+	checksum, err := utils.GetChecksum(r)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	client, err := getS3Client(r, bucket)
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
@@ -291,17 +411,25 @@ func (b *Browse) UploadPart(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	result, err := client.UploadPart(context.Background(), &s3.UploadPartInput{
-		Bucket:        aws.String(bucket),
+	input := &s3.UploadPartInput{
+		Bucket:        aws.String(client.Name),
 		Key:           aws.String(key),
 		UploadId:      aws.String(uploadId),
 		PartNumber:    aws.Int32(int32(partNumber)),
 		Body:          bytes.NewReader(body),
 		ContentLength: aws.Int64(int64(len(body))),
-	})
+	}
+	if checksum.ContentMD5 != "" {
+		input.ContentMD5 = aws.String(checksum.ContentMD5)
+	}
+	if checksum.SHA256 != "" {
+		input.ChecksumSHA256 = aws.String(checksum.SHA256)
+	}
+
+	result, err := client.UploadPart(r.Context(), input)
 
 	if err != nil {
-		utils.ResponseError(w, fmt.Errorf("cannot upload part: %w", err))
+		utils.ResponseErrorStatus(w, fmt.Errorf("cannot upload part: %w", err), getChecksumErrorStatus(err))
 		return
 	}
 
@@ -322,6 +450,7 @@ func (b *Browse) CompleteMultipartUpload(w http.ResponseWriter, r *http.Request)
 			ETag       string `json:"etag"`
 			PartNumber int    `json:"partNumber"`
 		} `json:"parts"`
+		SHA256 string `json:"sha256"` // Optional checksum of the full object
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
@@ -329,7 +458,13 @@ func (b *Browse) CompleteMultipartUpload(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	client, err := getS3Client(bucket)
+	checksum, err := utils.ParseChecksum("", body.SHA256)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	client, err := getS3Client(r, bucket)
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
@@ -344,8 +479,8 @@ func (b *Browse) CompleteMultipartUpload(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	result, err := client.CompleteMultipartUpload(context.Background(), &s3.CompleteMultipartUploadInput{
-		Bucket:   aws.String(bucket),
+	result, err := client.CompleteMultipartUpload(r.Context(), &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(client.Name),
 		Key:      aws.String(key),
 		UploadId: aws.String(uploadId),
 		MultipartUpload: &types.CompletedMultipartUpload{
@@ -358,7 +493,64 @@ func (b *Browse) CompleteMultipartUpload(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	utils.ResponseSuccess(w, result)
+	utils.Index.Refresh(client, key)
+
+	// The parts are only checksummed individually, the assembled object is
+	// hashed and checked against the checksum declared when creating the
+	// upload or on completion. An object which doesn't match, or can't be
+	// verified, is deleted, note that it has already replaced any previous
+	// object of the same key.
+	response := struct {
+		*s3.CompleteMultipartUploadOutput
+		SHA256 string `json:"sha256,omitempty"`
+	}{CompleteMultipartUploadOutput: result}
+
+	object, sum, err := hashObject(r.Context(), client, key)
+	expected := ""
+	if object != nil {
+		expected = strings.ToLower(object.Metadata[utils.ChecksumMetadataKey])
+	}
+	declared := checksum.SHA256 != "" || expected != ""
+
+	switch {
+	case err != nil && !declared:
+		utils.ResponseError(w, fmt.Errorf("cannot compute object checksum: %w", err))
+		return
+	case err != nil:
+		deleteUnverifiedObject(w, r, client, key, fmt.Errorf("cannot verify sha256 checksum: %w", err))
+		return
+	case (expected != "" && expected != sum) || (checksum.SHA256 != "" && checksum.SHA256Hex() != sum):
+		deleteUnverifiedObject(w, r, client, key, errors.New("sha256 checksum mismatch"))
+		return
+	}
+
+	// Uploads without a checksum declared upfront get the computed one
+	if expected == "" {
+		if err := storeObjectChecksum(r.Context(), client, key, object, sum); err != nil {
+			utils.ResponseError(w, fmt.Errorf("cannot store object checksum: %w", err))
+			return
+		}
+		utils.Index.Refresh(client, key)
+	}
+
+	response.SHA256 = sum
+	utils.ResponseSuccess(w, response)
+}
+
+// deleteUnverifiedObject deletes a completed object failing its checksum
+// verification, and responds with the reason.
+func deleteUnverifiedObject(w http.ResponseWriter, r *http.Request, client *utils.S3Bucket, key string, reason error) {
+	// Deleted even when the client is gone
+	_, err := client.DeleteObject(context.WithoutCancel(r.Context()), &s3.DeleteObjectInput{
+		Bucket: aws.String(client.Name),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		utils.ResponseError(w, fmt.Errorf("%w, cannot delete object: %w", reason, err))
+		return
+	}
+	utils.Index.Remove(client, key)
+	utils.ResponseErrorStatus(w, fmt.Errorf("%w, object deleted", reason), http.StatusBadRequest)
 }
 
 // AbortMultipartUpload aborts a multipart upload
@@ -367,14 +559,14 @@ func (b *Browse) AbortMultipartUpload(w http.ResponseWriter, r *http.Request) {
 	key := r.PathValue("key")
 	uploadId := r.URL.Query().Get("uploadId")
 
-	client, err := getS3Client(bucket)
+	client, err := getS3Client(r, bucket)
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
 	}
 
-	_, err = client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
-		Bucket:   aws.String(bucket),
+	_, err = client.AbortMultipartUpload(r.Context(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(client.Name),
 		Key:      aws.String(key),
 		UploadId: aws.String(uploadId),
 	})
@@ -393,7 +585,7 @@ func (b *Browse) DeleteObject(w http.ResponseWriter, r *http.Request) {
 	recursive := r.URL.Query().Get("recursive") == "true"
 	isDirectory := strings.HasSuffix(key, "/")
 
-	client, err := getS3Client(bucket)
+	client, err := getS3Client(r, bucket)
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
@@ -401,8 +593,8 @@ func (b *Browse) DeleteObject(w http.ResponseWriter, r *http.Request) {
 
 	// Delete directory and its content
 	if isDirectory && recursive {
-		objects, err := client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
-			Bucket: aws.String(bucket),
+		objects, err := client.ListObjectsV2(r.Context(), &s3.ListObjectsV2Input{
+			Bucket: aws.String(client.Name),
 			Prefix: aws.String(key),
 		})
 
@@ -424,8 +616,8 @@ func (b *Browse) DeleteObject(w http.ResponseWriter, r *http.Request) {
 			})
 		}
 
-		res, err := client.DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
-			Bucket: aws.String(bucket),
+		res, err := client.DeleteObjects(r.Context(), &s3.DeleteObjectsInput{
+			Bucket: aws.String(client.Name),
 			Delete: &types.Delete{Objects: keys},
 		})
 
@@ -434,6 +626,8 @@ func (b *Browse) DeleteObject(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		utils.Index.RemovePrefix(client, key)
+
 		if len(res.Errors) > 0 {
 			utils.ResponseError(w, fmt.Errorf("cannot delete object: %v", res.Errors[0]))
 			return
@@ -444,8 +638,8 @@ func (b *Browse) DeleteObject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete single object
-	res, err := client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
-		Bucket: aws.String(bucket),
+	res, err := client.DeleteObject(r.Context(), &s3.DeleteObjectInput{
+		Bucket: aws.String(client.Name),
 		Key:    aws.String(key),
 	})
 
@@ -454,77 +648,81 @@ func (b *Browse) DeleteObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	utils.Index.Remove(client, key)
+
 	utils.ResponseSuccess(w, res)
 }
 
-func getBucketCredentials(bucket string) (aws.CredentialsProvider, error) {
-	cacheKey := fmt.Sprintf("key:%s", bucket)
-	cacheData := utils.Cache.Get(cacheKey)
-
-	if cacheData != nil {
-		return cacheData.(aws.CredentialsProvider), nil
-	}
-
-	body, err := utils.Garage.Fetch("/v2/GetBucketInfo?globalAlias="+bucket, &utils.FetchOptions{})
+// hashObject streams an object through SHA-256. The object is returned
+// along with the digest, without its body, and is nil when it cannot be read.
+func hashObject(ctx context.Context, client *utils.S3Bucket, key string) (*s3.GetObjectOutput, string, error) {
+	object, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(client.Name),
+		Key:    aws.String(key),
+	})
 	if err != nil {
-		return nil, err
-	}
-
-	var bucketData schema.Bucket
-	if err := json.Unmarshal(body, &bucketData); err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	defer object.Body.Close()
 
-	var key schema.KeyElement
+	sum, _, err := utils.HashReader(object.Body)
+	return object, sum, err
+}
 
-	for _, k := range bucketData.Keys {
-		if !k.Permissions.Read || !k.Permissions.Write {
-			continue
-		}
+// storeObjectChecksum writes the SHA-256 of an object to its metadata,
+// keeping its other headers and metadata intact.
+func storeObjectChecksum(ctx context.Context, client *utils.S3Bucket, key string, object *s3.GetObjectOutput, sum string) error {
+	metadata := map[string]string{}
+	for k, v := range object.Metadata {
+		metadata[k] = v
+	}
+	metadata[utils.ChecksumMetadataKey] = sum
+
+	return replaceObjectHeaders(ctx, client, key, &schema.ObjectHeaders{
+		ContentType:        aws.ToString(object.ContentType),
+		CacheControl:       aws.ToString(object.CacheControl),
+		ContentDisposition: aws.ToString(object.ContentDisposition),
+		ContentEncoding:    aws.ToString(object.ContentEncoding),
+		ContentLanguage:    aws.ToString(object.ContentLanguage),
+		Metadata:           metadata,
+	})
+}
 
-		body, err := utils.Garage.Fetch(fmt.Sprintf("/v2/GetKeyInfo?id=%s&showSecretKey=true", k.AccessKeyID), &utils.FetchOptions{})
-		if err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal(body, &key); err != nil {
-			return nil, err
-		}
-		break
+// getCopySource returns the url-encoded `bucket/key` copy source of an object.
+func getCopySource(bucket string, key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
 	}
-
-	credential := credentials.NewStaticCredentialsProvider(key.AccessKeyID, key.SecretAccessKey, "")
-	utils.Cache.Set(cacheKey, credential, time.Hour)
-
-	return credential, nil
+	return bucket + "/" + strings.Join(segments, "/")
 }
 
-func getS3Client(bucket string) (*s3.Client, error) {
-	creds, err := getBucketCredentials(bucket)
-	if err != nil {
-		return nil, fmt.Errorf("cannot get credentials for bucket %s: %w", bucket, err)
+// getChecksumErrorStatus maps checksum mismatches reported by S3 to a
+// bad request status.
+func getChecksumErrorStatus(err error) int {
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		switch ae.ErrorCode() {
+		case "BadDigest", "InvalidDigest", "XAmzContentSHA256Mismatch":
+			return http.StatusBadRequest
+		}
 	}
+	return http.StatusInternalServerError
+}
 
-	// Determine endpoint and whether to disable HTTPS
-	endpoint := utils.Garage.GetS3Endpoint()
-	disableHTTPS := !strings.HasPrefix(endpoint, "https://")
-
-	// AWS config without BaseEndpoint
-	awsConfig := aws.Config{
-		Credentials: creds,
-		Region:      utils.Garage.GetS3Region(),
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
 	}
+	return ""
+}
 
-	// Build S3 client with custom endpoint resolver for proper signing
-	client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
-		o.UsePathStyle = true
-		o.EndpointOptions.DisableHTTPS = disableHTTPS
-		o.EndpointResolver = s3.EndpointResolverFunc(func(region string, opts s3.EndpointResolverOptions) (aws.Endpoint, error) {
-			return aws.Endpoint{
-				URL:           endpoint,
-				SigningRegion: utils.Garage.GetS3Region(),
-			}, nil
-		})
-	})
-
-	return client, nil
+// getS3Client returns a client signing requests with the access key of the
+// current user, or the shared bucket key when the user has none, on the
+// cluster selected by the request.
+func getS3Client(r *http.Request, bucket string) (*utils.S3Bucket, error) {
+	userID, _ := utils.Session.Get(r, "user_id").(string)
+	return utils.GetRequestCluster(r).NewUserS3Client(userID, bucket)
 }
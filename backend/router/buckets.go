@@ -1,28 +1,40 @@
 package router
 
 import (
-	"context"
+	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"khairul169/garage-webui/schema"
 	"khairul169/garage-webui/utils"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 type Buckets struct{}
 
+// GetAll lists the buckets of the cluster the user has access to. Buckets
+// are served from a cache refreshed in the background, the X-Fetched-At
+// header tells the age of the data. Query params:
+//   - q: filter by alias or id prefix
+//   - sort: name (default), created, size or objects, with order=desc
+//   - page & limit: paginate, the response is then a schema.BucketListResult
 func (b *Buckets) GetAll(w http.ResponseWriter, r *http.Request) {
-	body, err := utils.Garage.Fetch("/v2/ListBuckets", &utils.FetchOptions{})
-	if err != nil {
-		utils.ResponseError(w, err)
-		return
-	}
+	cluster := utils.GetRequestCluster(r)
+	query := r.URL.Query()
+	cache := cluster.BucketList()
 
-	var buckets []schema.GetBucketsRes
-	if err := json.Unmarshal(body, &buckets); err != nil {
+	buckets, freshness, err := cache.List(r.Context())
+	if err != nil {
 		utils.ResponseError(w, err)
 		return
 	}
@@ -34,278 +46,494 @@ func (b *Buckets) GetAll(w http.ResponseWriter, r *http.Request) {
 		currentUser, _ = utils.Users.GetByID(userID.(string))
 	}
 
-	ch := make(chan schema.Bucket, len(buckets))
-
+	// Filter before fetching details, grants are bound to bucket ids
+	search := strings.ToLower(query.Get("q"))
+	listed := make([]schema.GetBucketsRes, 0, len(buckets))
 	for _, bucket := range buckets {
-		go func() {
-			body, err := utils.Garage.Fetch(fmt.Sprintf("/v2/GetBucketInfo?id=%s", bucket.ID), &utils.FetchOptions{})
-
-			if err != nil {
-				ch <- schema.Bucket{ID: bucket.ID, GlobalAliases: bucket.GlobalAliases}
-				return
-			}
-
-			var data schema.Bucket
-			if err := json.Unmarshal(body, &data); err != nil {
-				ch <- schema.Bucket{ID: bucket.ID, GlobalAliases: bucket.GlobalAliases}
-				return
-			}
-
-			data.LocalAliases = bucket.LocalAliases
-			ch <- data
-		}()
-	}
-
-	res := make([]schema.Bucket, 0, len(buckets))
-	for i := 0; i < len(buckets); i++ {
-		bucket := <-ch
-		
-		// Filter buckets based on user permissions
-		if currentUser != nil && currentUser.Role != schema.RoleAdmin {
-			// Get bucket name from global aliases
-			bucketName := ""
-			if len(bucket.GlobalAliases) > 0 {
-				bucketName = bucket.GlobalAliases[0]
-			}
-			
-			// Check if user has permission
-			if bucketName != "" && !utils.Users.HasBucketPermission(currentUser.ID, bucketName) {
-				continue
-			}
+		if currentUser != nil && currentUser.Role != schema.RoleAdmin &&
+			!utils.Users.HasListedBucketPermission(cluster, currentUser.ID, &bucket) {
+			continue
+		}
+		if search != "" && !matchBucketSearch(&bucket, search) {
+			continue
 		}
-		
-		res = append(res, bucket)
+		listed = append(listed, bucket)
 	}
 
-	utils.ResponseSuccess(w, res)
+	total := len(listed)
+	sortBy := query.Get("sort")
+	desc := query.Get("order") == "desc"
+	paginated := query.Has("page") || query.Has("limit")
+
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	limit = min(limit, 1000)
+
+	var res []schema.Bucket
+	var details utils.BucketListFreshness
+
+	if sortBy == "size" || sortBy == "objects" {
+		// Sorting on usage needs the details of every listed bucket
+		res, details = cache.Details(r.Context(), listed)
+		sortBuckets(res, sortBy, desc)
+		if paginated {
+			res = paginate(res, page, limit)
+		}
+	} else {
+		sortListedBuckets(listed, sortBy, desc)
+		if paginated {
+			listed = paginate(listed, page, limit)
+		}
+		res, details = cache.Details(r.Context(), listed)
+	}
+
+	if !details.FetchedAt.IsZero() && details.FetchedAt.Before(freshness.FetchedAt) {
+		freshness.FetchedAt = details.FetchedAt
+	}
+	freshness.Stale = freshness.Stale || details.Stale
+
+	w.Header().Set("X-Fetched-At", freshness.FetchedAt.UTC().Format(time.RFC3339))
+	if !paginated {
+		utils.ResponseSuccess(w, res)
+		return
+	}
+
+	utils.ResponseSuccess(w, schema.BucketListResult{
+		Buckets:   res,
+		Total:     total,
+		Page:      page,
+		Limit:     limit,
+		FetchedAt: freshness.FetchedAt,
+		Stale:     freshness.Stale,
+	})
+}
+
+// Create creates a bucket owned by the current user, within their bucket
+// allowance. Admins are not limited.
+func (b *Buckets) Create(w http.ResponseWriter, r *http.Request) {
+	var req schema.CreateUserBucketRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	userID, _ := utils.Session.Get(r, "user_id").(string)
+	bucket, err := utils.GetRequestCluster(r).CreateUserBucket(r.Context(), userID, &req)
+	if err != nil {
+		var provisionErr *utils.ProvisionError
+		switch {
+		case errors.Is(err, utils.ErrBucketCreationNotAllowed), errors.Is(err, utils.ErrBucketAllowanceExceeded):
+			utils.ResponseErrorStatus(w, err, http.StatusForbidden)
+		case errors.As(err, &provisionErr):
+			utils.ResponseError(w, err)
+		default:
+			utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		}
+		return
+	}
+
+	utils.ResponseSuccess(w, bucket)
+}
+
+// Delete deletes an empty bucket, users need the delete_bucket permission.
+func (b *Buckets) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := utils.GetRequestCluster(r).DeleteBucket(r.Context(), r.PathValue("bucket")); err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	utils.ResponseSuccess(w, map[string]bool{"success": true})
 }
 
 func (b *Buckets) GetLifecycleConfiguration(w http.ResponseWriter, r *http.Request) {
-	bucket := r.URL.Query().Get("bucket")
+	bucket := r.PathValue("bucket")
 	if bucket == "" {
 		utils.ResponseError(w, fmt.Errorf("bucket parameter is required"))
 		return
 	}
 
-	client, err := getS3Client(bucket)
+	client, err := getS3Client(r, bucket)
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
 	}
 
-	result, err := client.GetBucketLifecycleConfiguration(context.Background(), &s3.GetBucketLifecycleConfigurationInput{
-		Bucket: &bucket,
+	result, err := client.GetBucketLifecycleConfiguration(r.Context(), &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(client.Name),
 	})
 
 	if err != nil {
 		// If no lifecycle configuration exists, return empty rules
-		utils.ResponseSuccess(w, schema.LifecycleConfiguration{Rules: []schema.LifecycleRule{}})
+		if utils.IsNoSuchLifecycleConfiguration(err) {
+			utils.ResponseSuccess(w, schema.LifecycleConfiguration{Rules: []schema.LifecycleRule{}})
+			return
+		}
+		utils.ResponseError(w, err)
 		return
 	}
 
-	// Convert AWS types to our schema
-	rules := make([]schema.LifecycleRule, 0, len(result.Rules))
-	for _, rule := range result.Rules {
-		schemaRule := schema.LifecycleRule{
-			ID:     getStringValue(rule.ID),
-			Status: string(rule.Status),
-		}
+	utils.ResponseSuccess(w, schema.LifecycleConfiguration{Rules: utils.FromS3LifecycleRules(result.Rules)})
+}
 
-		if rule.Prefix != nil {
-			schemaRule.Prefix = rule.Prefix
-		}
+func (b *Buckets) PutLifecycleConfiguration(w http.ResponseWriter, r *http.Request) {
+	bucket := r.PathValue("bucket")
+	if bucket == "" {
+		utils.ResponseError(w, fmt.Errorf("bucket parameter is required"))
+		return
+	}
 
-		if rule.Filter != nil {
-			filter := &schema.LifecycleFilter{}
-			
-			// Handle Filter members based on AWS SDK types union
-			switch v := rule.Filter.(type) {
-			case *types.LifecycleRuleFilterMemberPrefix:
-				filter.Prefix = v.Value
-				// Also set the top-level Prefix field for frontend compatibility
-				if schemaRule.Prefix == nil {
-					schemaRule.Prefix = &v.Value
-				}
-			case *types.LifecycleRuleFilterMemberTag:
-				filter.Tags = []schema.LifecycleTag{{Key: *v.Value.Key, Value: *v.Value.Value}}
-			case *types.LifecycleRuleFilterMemberAnd:
-				and := &schema.LifecycleFilterAnd{}
-				if v.Value.Prefix != nil {
-					and.Prefix = *v.Value.Prefix
-					// Also set the top-level Prefix field for frontend compatibility
-					if schemaRule.Prefix == nil {
-						schemaRule.Prefix = v.Value.Prefix
-					}
-				}
-				if v.Value.Tags != nil {
-					and.Tags = make([]schema.LifecycleTag, 0, len(v.Value.Tags))
-					for _, tag := range v.Value.Tags {
-						and.Tags = append(and.Tags, schema.LifecycleTag{Key: *tag.Key, Value: *tag.Value})
-					}
-				}
-				filter.And = and
-			}
-			schemaRule.Filter = filter
-		}
+	var req schema.PutLifecycleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
 
-		if rule.Expiration != nil {
-			schemaRule.Expiration = &schema.LifecycleExpiration{
-				Days:                      rule.Expiration.Days,
-				ExpiredObjectDeleteMarker: rule.Expiration.ExpiredObjectDeleteMarker,
-			}
-			if rule.Expiration.Date != nil {
-				dateStr := rule.Expiration.Date.Format("2006-01-02")
-				schemaRule.Expiration.Date = &dateStr
-			}
-		}
+	if err := utils.ValidateLifecycleRules(req.Rules); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
 
-		if rule.NoncurrentVersionExpiration != nil {
-			schemaRule.NoncurrentVersionExpiration = &schema.NoncurrentVersionExpiration{
-				NoncurrentDays: rule.NoncurrentVersionExpiration.NoncurrentDays,
-			}
-		}
+	client, err := getS3Client(r, bucket)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
 
-		if rule.AbortIncompleteMultipartUpload != nil {
-			schemaRule.AbortIncompleteMultipartUpload = &schema.AbortIncompleteMultipartUpload{
-				DaysAfterInitiation: rule.AbortIncompleteMultipartUpload.DaysAfterInitiation,
-			}
+	err = utils.PutLifecycleRules(r.Context(), client, req.Rules)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	utils.ResponseSuccess(w, map[string]string{"message": "Lifecycle configuration updated successfully"})
+}
+
+// LifecycleDryRun reports what lifecycle rules would remove from the bucket.
+// The rules of the request body are checked, or the current configuration
+// when the body has none.
+func (b *Buckets) LifecycleDryRun(w http.ResponseWriter, r *http.Request) {
+	bucket := r.PathValue("bucket")
+	if bucket == "" {
+		utils.ResponseErrorStatus(w, errors.New("bucket parameter is required"), http.StatusBadRequest)
+		return
+	}
+
+	var req schema.PutLifecycleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	client, err := getS3Client(r, bucket)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	rules := req.Rules
+	if rules == nil {
+		result, err := client.GetBucketLifecycleConfiguration(r.Context(), &s3.GetBucketLifecycleConfigurationInput{
+			Bucket: aws.String(client.Name),
+		})
+		if err != nil && !utils.IsNoSuchLifecycleConfiguration(err) {
+			utils.ResponseError(w, err)
+			return
 		}
+		if result != nil {
+			rules = utils.FromS3LifecycleRules(result.Rules)
+		}
+	}
+
+	if err := utils.ValidateLifecycleRules(rules); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	res, err := utils.LifecycleDryRun(r.Context(), client, rules, time.Now())
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+// ExportLifecycleConfiguration returns the lifecycle configuration of the
+// bucket as a standard S3 XML document.
+func (b *Buckets) ExportLifecycleConfiguration(w http.ResponseWriter, r *http.Request) {
+	bucket := r.PathValue("bucket")
+	if bucket == "" {
+		utils.ResponseErrorStatus(w, errors.New("bucket parameter is required"), http.StatusBadRequest)
+		return
+	}
+
+	client, err := getS3Client(r, bucket)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
 
-		rules = append(rules, schemaRule)
+	var rules []types.LifecycleRule
+	result, err := client.GetBucketLifecycleConfiguration(r.Context(), &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(client.Name),
+	})
+	if err != nil && !utils.IsNoSuchLifecycleConfiguration(err) {
+		utils.ResponseError(w, err)
+		return
+	}
+	if result != nil {
+		rules = result.Rules
+	}
+
+	data, err := utils.EncodeLifecycleXML(rules)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=lifecycle-%s.xml", bucket))
+	w.Write(data)
+}
+
+// ImportLifecycleConfiguration replaces the lifecycle configuration of the
+// bucket with the rules of a standard S3 XML document.
+func (b *Buckets) ImportLifecycleConfiguration(w http.ResponseWriter, r *http.Request) {
+	bucket := r.PathValue("bucket")
+	if bucket == "" {
+		utils.ResponseErrorStatus(w, errors.New("bucket parameter is required"), http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	awsRules, err := utils.DecodeLifecycleXML(data)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+	if len(awsRules) == 0 {
+		utils.ResponseErrorStatus(w, errors.New("the document has no rules"), http.StatusBadRequest)
+		return
+	}
+
+	rules := utils.FromS3LifecycleRules(awsRules)
+	if err := utils.ValidateLifecycleRules(rules); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	client, err := getS3Client(r, bucket)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	if err := utils.PutLifecycleRules(r.Context(), client, rules); err != nil {
+		utils.ResponseError(w, err)
+		return
 	}
 
 	utils.ResponseSuccess(w, schema.LifecycleConfiguration{Rules: rules})
 }
 
-func (b *Buckets) PutLifecycleConfiguration(w http.ResponseWriter, r *http.Request) {
-	bucket := r.URL.Query().Get("bucket")
+func (b *Buckets) DeleteLifecycleConfiguration(w http.ResponseWriter, r *http.Request) {
+	bucket := r.PathValue("bucket")
 	if bucket == "" {
 		utils.ResponseError(w, fmt.Errorf("bucket parameter is required"))
 		return
 	}
 
-	var req schema.PutLifecycleRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	client, err := getS3Client(r, bucket)
+	if err != nil {
 		utils.ResponseError(w, err)
 		return
 	}
 
-	client, err := getS3Client(bucket)
+	_, err = client.DeleteBucketLifecycle(r.Context(), &s3.DeleteBucketLifecycleInput{
+		Bucket: aws.String(client.Name),
+	})
+
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
 	}
 
-	// Convert our schema to AWS types
-	rules := make([]types.LifecycleRule, 0, len(req.Rules))
-	for _, rule := range req.Rules {
-		awsRule := types.LifecycleRule{
-			Status: types.ExpirationStatus(rule.Status),
-		}
+	utils.ResponseSuccess(w, map[string]string{"message": "Lifecycle configuration deleted successfully"})
+}
 
-		if rule.ID != "" {
-			awsRule.ID = &rule.ID
-		}
+func (b *Buckets) GetCorsConfiguration(w http.ResponseWriter, r *http.Request) {
+	bucket := r.PathValue("bucket")
+	if bucket == "" {
+		utils.ResponseErrorStatus(w, errors.New("bucket parameter is required"), http.StatusBadRequest)
+		return
+	}
 
-		// Handle Prefix - prefer using Filter for consistency
-		if rule.Prefix != nil && *rule.Prefix != "" {
-			awsRule.Filter = &types.LifecycleRuleFilterMemberPrefix{
-				Value: *rule.Prefix,
-			}
-		}
+	client, err := getS3Client(r, bucket)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
 
-		if rule.Filter != nil {
-			// Convert filter to AWS SDK union type
-			if rule.Filter.Prefix != "" {
-				awsRule.Filter = &types.LifecycleRuleFilterMemberPrefix{
-					Value: rule.Filter.Prefix,
-				}
-			} else if len(rule.Filter.Tags) > 0 {
-				awsRule.Filter = &types.LifecycleRuleFilterMemberTag{
-					Value: types.Tag{Key: &rule.Filter.Tags[0].Key, Value: &rule.Filter.Tags[0].Value},
-				}
-			} else if rule.Filter.And != nil {
-				and := types.LifecycleRuleAndOperator{}
-				if rule.Filter.And.Prefix != "" {
-					and.Prefix = &rule.Filter.And.Prefix
-				}
-				if len(rule.Filter.And.Tags) > 0 {
-					and.Tags = make([]types.Tag, 0, len(rule.Filter.And.Tags))
-					for _, tag := range rule.Filter.And.Tags {
-						and.Tags = append(and.Tags, types.Tag{Key: &tag.Key, Value: &tag.Value})
-					}
-				}
-				awsRule.Filter = &types.LifecycleRuleFilterMemberAnd{
-					Value: and,
-				}
-			}
+	result, err := client.GetBucketCors(r.Context(), &s3.GetBucketCorsInput{
+		Bucket: aws.String(client.Name),
+	})
+	if err != nil {
+		var ae smithy.APIError
+		if errors.As(err, &ae) && ae.ErrorCode() == "NoSuchCORSConfiguration" {
+			utils.ResponseSuccess(w, schema.CORSConfiguration{Rules: []schema.CORSRule{}})
+			return
 		}
+		utils.ResponseError(w, err)
+		return
+	}
 
-		if rule.Expiration != nil {
-			awsRule.Expiration = &types.LifecycleExpiration{
-				Days:                      rule.Expiration.Days,
-				ExpiredObjectDeleteMarker: rule.Expiration.ExpiredObjectDeleteMarker,
-			}
-		}
+	utils.ResponseSuccess(w, schema.CORSConfiguration{Rules: utils.FromS3CORSRules(result.CORSRules)})
+}
 
-		if rule.NoncurrentVersionExpiration != nil {
-			awsRule.NoncurrentVersionExpiration = &types.NoncurrentVersionExpiration{
-				NoncurrentDays: rule.NoncurrentVersionExpiration.NoncurrentDays,
-			}
-		}
+func (b *Buckets) PutCorsConfiguration(w http.ResponseWriter, r *http.Request) {
+	bucket := r.PathValue("bucket")
+	if bucket == "" {
+		utils.ResponseErrorStatus(w, errors.New("bucket parameter is required"), http.StatusBadRequest)
+		return
+	}
 
-		if rule.AbortIncompleteMultipartUpload != nil {
-			awsRule.AbortIncompleteMultipartUpload = &types.AbortIncompleteMultipartUpload{
-				DaysAfterInitiation: rule.AbortIncompleteMultipartUpload.DaysAfterInitiation,
-			}
-		}
+	var req schema.CORSConfiguration
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
 
-		rules = append(rules, awsRule)
+	if err := utils.ValidateCORSRules(req.Rules); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
 	}
 
-	_, err = client.PutBucketLifecycleConfiguration(context.Background(), &s3.PutBucketLifecycleConfigurationInput{
-		Bucket: &bucket,
-		LifecycleConfiguration: &types.BucketLifecycleConfiguration{
-			Rules: rules,
+	client, err := getS3Client(r, bucket)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	_, err = client.PutBucketCors(r.Context(), &s3.PutBucketCorsInput{
+		Bucket: aws.String(client.Name),
+		CORSConfiguration: &types.CORSConfiguration{
+			CORSRules: utils.ToS3CORSRules(req.Rules),
 		},
 	})
-
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
 	}
 
-	utils.ResponseSuccess(w, map[string]string{"message": "Lifecycle configuration updated successfully"})
+	utils.ResponseSuccess(w, map[string]string{"message": "CORS configuration updated successfully"})
 }
 
-func (b *Buckets) DeleteLifecycleConfiguration(w http.ResponseWriter, r *http.Request) {
-	bucket := r.URL.Query().Get("bucket")
+func (b *Buckets) DeleteCorsConfiguration(w http.ResponseWriter, r *http.Request) {
+	bucket := r.PathValue("bucket")
 	if bucket == "" {
-		utils.ResponseError(w, fmt.Errorf("bucket parameter is required"))
+		utils.ResponseErrorStatus(w, errors.New("bucket parameter is required"), http.StatusBadRequest)
 		return
 	}
 
-	client, err := getS3Client(bucket)
+	client, err := getS3Client(r, bucket)
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
 	}
 
-	_, err = client.DeleteBucketLifecycle(context.Background(), &s3.DeleteBucketLifecycleInput{
-		Bucket: &bucket,
+	_, err = client.DeleteBucketCors(r.Context(), &s3.DeleteBucketCorsInput{
+		Bucket: aws.String(client.Name),
 	})
-
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
 	}
 
-	utils.ResponseSuccess(w, map[string]string{"message": "Lifecycle configuration deleted successfully"})
+	utils.ResponseSuccess(w, map[string]string{"message": "CORS configuration deleted successfully"})
+}
+
+// GetAnalytics returns the storage breakdown of a bucket, the `prefix` query
+// allows drilling down into a sub directory.
+func (b *Buckets) GetAnalytics(w http.ResponseWriter, r *http.Request) {
+	bucket := r.PathValue("bucket")
+	query := r.URL.Query()
+
+	result := utils.Analytics.Get(utils.GetRequestCluster(r), bucket, query.Get("prefix"), query.Get("refresh") == "1")
+	utils.ResponseSuccess(w, result)
+}
+
+// matchBucketSearch reports whether a bucket alias contains search, or its
+// id starts with it.
+func matchBucketSearch(bucket *schema.GetBucketsRes, search string) bool {
+	if strings.HasPrefix(bucket.ID, search) {
+		return true
+	}
+	for _, alias := range bucket.GlobalAliases {
+		if strings.Contains(strings.ToLower(alias), search) {
+			return true
+		}
+	}
+	for _, alias := range bucket.LocalAliases {
+		if strings.Contains(strings.ToLower(alias.Alias), search) {
+			return true
+		}
+	}
+	return false
 }
 
-func getStringValue(s *string) string {
-	if s != nil {
-		return *s
+func getListedBucketName(bucket *schema.GetBucketsRes) string {
+	if len(bucket.GlobalAliases) > 0 {
+		return bucket.GlobalAliases[0]
 	}
-	return ""
+	if len(bucket.LocalAliases) > 0 {
+		return bucket.LocalAliases[0].Alias
+	}
+	return bucket.ID
+}
+
+func sortListedBuckets(buckets []schema.GetBucketsRes, sortBy string, desc bool) {
+	slices.SortStableFunc(buckets, func(a, b schema.GetBucketsRes) int {
+		var res int
+		if sortBy == "created" {
+			res = strings.Compare(a.Created, b.Created)
+		} else {
+			res = strings.Compare(getListedBucketName(&a), getListedBucketName(&b))
+		}
+		if desc {
+			return -res
+		}
+		return res
+	})
+}
+
+func sortBuckets(buckets []schema.Bucket, sortBy string, desc bool) {
+	slices.SortStableFunc(buckets, func(a, b schema.Bucket) int {
+		var res int
+		if sortBy == "objects" {
+			res = cmp.Compare(a.Objects, b.Objects)
+		} else {
+			res = cmp.Compare(a.Bytes, b.Bytes)
+		}
+		if desc {
+			return -res
+		}
+		return res
+	})
+}
+
+func paginate[T any](items []T, page int, limit int) []T {
+	start := min((page-1)*limit, len(items))
+	end := min(start+limit, len(items))
+	return items[start:end]
 }
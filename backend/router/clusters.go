@@ -0,0 +1,45 @@
+package router
+
+import (
+	"khairul169/garage-webui/schema"
+	"khairul169/garage-webui/utils"
+	"net/http"
+	"sync"
+)
+
+type Clusters struct{}
+
+func (c *Clusters) GetAll(w http.ResponseWriter, r *http.Request) {
+	clusters := utils.Clusters.List()
+	res := make([]schema.ClusterInfo, 0, len(clusters))
+
+	for _, cluster := range clusters {
+		res = append(res, schema.ClusterInfo{
+			Name:       cluster.Name,
+			Default:    cluster.IsDefault(),
+			S3Endpoint: cluster.GetS3Endpoint(),
+			S3Region:   cluster.GetS3Region(),
+		})
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+// GetOverview returns the health and capacity of every cluster, clusters
+// which cannot be reached are reported with an error.
+func (c *Clusters) GetOverview(w http.ResponseWriter, r *http.Request) {
+	clusters := utils.Clusters.List()
+	res := make([]schema.ClusterOverview, len(clusters))
+
+	var wg sync.WaitGroup
+	for i, cluster := range clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res[i] = cluster.GetOverview(r.Context())
+		}()
+	}
+	wg.Wait()
+
+	utils.ResponseSuccess(w, res)
+}
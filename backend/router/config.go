@@ -8,6 +8,6 @@ import (
 type Config struct{}
 
 func (c *Config) GetAll(w http.ResponseWriter, r *http.Request) {
-	config := utils.Garage.Config
+	config := utils.GetRequestCluster(r).Config
 	utils.ResponseSuccess(w, config)
 }
@@ -0,0 +1,105 @@
+package router
+
+import (
+	"errors"
+	"khairul169/garage-webui/utils"
+	"net/http"
+	"strconv"
+)
+
+type Index struct{}
+
+// The key index only covers buckets of the default cluster.
+var errIndexCluster = errors.New("the key index is only available on the default cluster")
+
+func (i *Index) Query(w http.ResponseWriter, r *http.Request) {
+	if !utils.GetRequestCluster(r).IsDefault() {
+		utils.ResponseErrorStatus(w, errIndexCluster, http.StatusNotFound)
+		return
+	}
+
+	bucket := r.PathValue("bucket")
+	values := r.URL.Query()
+
+	search, err := utils.ParseObjectSearchQuery(values)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	filter, err := utils.NewObjectFilter(search)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	limit, err := strconv.Atoi(values.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(values.Get("offset"))
+
+	i.respondQuery(w, bucket, utils.IndexQuery{
+		Filter: filter,
+		Prefix: search.Prefix,
+		Sort:   values.Get("sort"),
+		Desc:   values.Get("order") == "desc",
+		Limit:  limit,
+		Offset: max(offset, 0),
+	})
+}
+
+func (i *Index) GetLargest(w http.ResponseWriter, r *http.Request) {
+	if !utils.GetRequestCluster(r).IsDefault() {
+		utils.ResponseErrorStatus(w, errIndexCluster, http.StatusNotFound)
+		return
+	}
+
+	bucket := r.PathValue("bucket")
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+
+	i.respondQuery(w, bucket, utils.IndexQuery{
+		Prefix: r.URL.Query().Get("prefix"),
+		Sort:   "size",
+		Desc:   true,
+		Limit:  limit,
+	})
+}
+
+func (i *Index) Reindex(w http.ResponseWriter, r *http.Request) {
+	if !utils.GetRequestCluster(r).IsDefault() {
+		utils.ResponseErrorStatus(w, errIndexCluster, http.StatusNotFound)
+		return
+	}
+
+	bucket := r.PathValue("bucket")
+
+	if err := utils.Index.Reindex(bucket); err != nil {
+		utils.ResponseErrorStatus(w, err, getIndexErrorStatus(err))
+		return
+	}
+
+	status, _ := utils.Index.Status(bucket)
+	utils.ResponseSuccess(w, status)
+}
+
+func (i *Index) respondQuery(w http.ResponseWriter, bucket string, query utils.IndexQuery) {
+	result, err := utils.Index.Query(bucket, query)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, getIndexErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, result)
+}
+
+func getIndexErrorStatus(err error) int {
+	if errors.Is(err, utils.ErrIndexDisabled) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,201 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"khairul169/garage-webui/utils"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+var metadataKeyRegex = regexp.MustCompile(`^[a-z0-9_.-]+$`)
+
+func (b *Browse) GetObjectMetadata(w http.ResponseWriter, r *http.Request) {
+	bucket := r.PathValue("bucket")
+	key := r.PathValue("key")
+
+	client, err := getS3Client(r, bucket)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	object, err := client.HeadObject(r.Context(), &s3.HeadObjectInput{
+		Bucket: aws.String(client.Name),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, getObjectErrorStatus(err))
+		return
+	}
+
+	result := schema.ObjectMetadata{
+		Key:          key,
+		Size:         aws.ToInt64(object.ContentLength),
+		ETag:         aws.ToString(object.ETag),
+		LastModified: object.LastModified,
+		ObjectHeaders: schema.ObjectHeaders{
+			ContentType:        aws.ToString(object.ContentType),
+			CacheControl:       aws.ToString(object.CacheControl),
+			ContentDisposition: aws.ToString(object.ContentDisposition),
+			ContentEncoding:    aws.ToString(object.ContentEncoding),
+			ContentLanguage:    aws.ToString(object.ContentLanguage),
+			Metadata:           object.Metadata,
+		},
+	}
+	if result.Metadata == nil {
+		result.Metadata = map[string]string{}
+	}
+
+	utils.ResponseSuccess(w, result)
+}
+
+// UpdateObjectMetadata replaces the headers and user metadata of an object
+// by copying the object onto itself.
+func (b *Browse) UpdateObjectMetadata(w http.ResponseWriter, r *http.Request) {
+	bucket := r.PathValue("bucket")
+	key := r.PathValue("key")
+
+	var body schema.ObjectHeaders
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		utils.ResponseErrorStatus(w, fmt.Errorf("invalid request body: %w", err), http.StatusBadRequest)
+		return
+	}
+	if err := normalizeObjectHeaders(&body); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	client, err := getS3Client(r, bucket)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	object, err := client.HeadObject(r.Context(), &s3.HeadObjectInput{
+		Bucket: aws.String(client.Name),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, getObjectErrorStatus(err))
+		return
+	}
+
+	// The content is left untouched, keep the stored checksum and type.
+	if sum, ok := object.Metadata[utils.ChecksumMetadataKey]; ok {
+		body.Metadata[utils.ChecksumMetadataKey] = sum
+	}
+	if body.ContentType == "" {
+		body.ContentType = aws.ToString(object.ContentType)
+	}
+
+	if err := replaceObjectHeaders(r.Context(), client, key, &body); err != nil {
+		utils.ResponseError(w, fmt.Errorf("cannot update object metadata: %w", err))
+		return
+	}
+
+	utils.Index.Refresh(client, key)
+
+	utils.ResponseSuccess(w, body)
+}
+
+func replaceObjectHeaders(ctx context.Context, client *utils.S3Bucket, key string, headers *schema.ObjectHeaders) error {
+	_, err := client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:             aws.String(client.Name),
+		Key:                aws.String(key),
+		CopySource:         aws.String(getCopySource(client.Name, key)),
+		MetadataDirective:  types.MetadataDirectiveReplace,
+		Metadata:           headers.Metadata,
+		ContentType:        getStringPtr(headers.ContentType),
+		CacheControl:       getStringPtr(headers.CacheControl),
+		ContentDisposition: getStringPtr(headers.ContentDisposition),
+		ContentEncoding:    getStringPtr(headers.ContentEncoding),
+		ContentLanguage:    getStringPtr(headers.ContentLanguage),
+	})
+	return err
+}
+
+// getUploadHeaders reads the object headers sent along with a form upload.
+// User metadata is passed as a JSON object in the `metadata` field.
+func getUploadHeaders(r *http.Request) (*schema.ObjectHeaders, error) {
+	headers := &schema.ObjectHeaders{
+		ContentType:        r.FormValue("contentType"),
+		CacheControl:       r.FormValue("cacheControl"),
+		ContentDisposition: r.FormValue("contentDisposition"),
+		ContentEncoding:    r.FormValue("contentEncoding"),
+		ContentLanguage:    r.FormValue("contentLanguage"),
+	}
+
+	if metadata := r.FormValue("metadata"); metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &headers.Metadata); err != nil {
+			return nil, fmt.Errorf("invalid metadata: %w", err)
+		}
+	}
+
+	if err := normalizeObjectHeaders(headers); err != nil {
+		return nil, err
+	}
+
+	return headers, nil
+}
+
+// normalizeObjectHeaders validates the metadata keys and values, and strips
+// the x-amz-meta- prefix from the keys. The checksum key is dropped, it is
+// only set from the object content.
+func normalizeObjectHeaders(headers *schema.ObjectHeaders) error {
+	metadata := make(map[string]string, len(headers.Metadata))
+
+	for k, v := range headers.Metadata {
+		k = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(k)), "x-amz-meta-")
+		if !metadataKeyRegex.MatchString(k) {
+			return fmt.Errorf("invalid metadata key: %q", k)
+		}
+		if !isHeaderValue(v) {
+			return fmt.Errorf("invalid value for metadata key %q", k)
+		}
+		metadata[k] = v
+	}
+	delete(metadata, utils.ChecksumMetadataKey)
+	headers.Metadata = metadata
+
+	for _, v := range []string{headers.ContentType, headers.CacheControl, headers.ContentDisposition, headers.ContentEncoding, headers.ContentLanguage} {
+		if !isHeaderValue(v) {
+			return errors.New("invalid header value")
+		}
+	}
+
+	return nil
+}
+
+func isHeaderValue(value string) bool {
+	for _, ch := range value {
+		if ch < 0x20 || ch > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func getObjectErrorStatus(err error) int {
+	var ae smithy.APIError
+	if errors.As(err, &ae) && (ae.ErrorCode() == "NoSuchKey" || ae.ErrorCode() == "NotFound") {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func getStringPtr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,123 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"khairul169/garage-webui/schema"
+	"khairul169/garage-webui/utils"
+	"net/http"
+)
+
+type LifecyclePolicies struct{}
+
+func (p *LifecyclePolicies) GetAll(w http.ResponseWriter, r *http.Request) {
+	utils.ResponseSuccess(w, utils.Policies.GetAll())
+}
+
+func (p *LifecyclePolicies) GetOne(w http.ResponseWriter, r *http.Request) {
+	policy, err := utils.Policies.GetByID(r.PathValue("id"))
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusNotFound)
+		return
+	}
+
+	utils.ResponseSuccess(w, policy)
+}
+
+func (p *LifecyclePolicies) Create(w http.ResponseWriter, r *http.Request) {
+	var policy schema.LifecyclePolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	res, err := utils.Policies.Create(&policy)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+func (p *LifecyclePolicies) Update(w http.ResponseWriter, r *http.Request) {
+	var policy schema.LifecyclePolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	res, err := utils.Policies.Update(r.PathValue("id"), &policy)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, getPolicyErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+// SetAttachments replaces the buckets the policy is attached to.
+func (p *LifecyclePolicies) SetAttachments(w http.ResponseWriter, r *http.Request) {
+	var attachments []schema.PolicyAttachment
+	if err := json.NewDecoder(r.Body).Decode(&attachments); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+	if attachments == nil {
+		attachments = []schema.PolicyAttachment{}
+	}
+
+	res, err := utils.Policies.SetAttachments(r.PathValue("id"), attachments)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, getPolicyErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+func (p *LifecyclePolicies) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := utils.Policies.Delete(r.PathValue("id")); err != nil {
+		utils.ResponseErrorStatus(w, err, getPolicyErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, map[string]bool{"success": true})
+}
+
+// GetDrift compares the attached buckets with the policy.
+func (p *LifecyclePolicies) GetDrift(w http.ResponseWriter, r *http.Request) {
+	policy, err := utils.Policies.GetByID(r.PathValue("id"))
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusNotFound)
+		return
+	}
+
+	utils.ResponseSuccess(w, utils.GetPolicyDrift(r.Context(), policy))
+}
+
+// Reconcile applies the policy to the attached buckets which drifted from
+// it, optionally limited to the `bucket_ids` of the body.
+func (p *LifecyclePolicies) Reconcile(w http.ResponseWriter, r *http.Request) {
+	policy, err := utils.Policies.GetByID(r.PathValue("id"))
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusNotFound)
+		return
+	}
+
+	var req schema.ReconcilePolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	utils.ResponseSuccess(w, utils.ReconcilePolicy(r.Context(), policy, req.BucketIDs))
+}
+
+func getPolicyErrorStatus(err error) int {
+	if errors.Is(err, utils.ErrPolicyNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
@@ -1,7 +1,10 @@
 package router
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"khairul169/garage-webui/utils"
 	"net/http"
 	"net/http/httputil"
@@ -10,19 +13,86 @@ import (
 )
 
 func ProxyHandler(w http.ResponseWriter, r *http.Request) {
-	target, err := url.Parse(utils.Garage.GetAdminEndpoint())
+	cluster := utils.GetRequestCluster(r)
+	target, err := url.Parse(cluster.GetAdminEndpoint())
 	if err != nil {
 		utils.ResponseError(w, err)
 		return
 	}
 
+	var body []byte
+	if r.Method == http.MethodPost && r.Body != nil {
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			utils.ResponseError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
 	proxy := &httputil.ReverseProxy{
 		Rewrite: func(r *httputil.ProxyRequest) {
 			r.SetURL(target)
 			r.Out.URL.Path = strings.TrimPrefix(r.In.URL.Path, "/api")
-			r.Out.Header.Set("Authorization", fmt.Sprintf("Bearer %s", utils.Garage.GetAdminKey()))
+			r.Out.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cluster.GetAdminKey()))
+			r.Out.Header.Del(utils.ClusterHeader)
+		},
+		ModifyResponse: func(res *http.Response) error {
+			if res.StatusCode < 300 {
+				invalidateS3Clients(cluster.S3Clients(), r, body)
+				invalidateBucketList(cluster.BucketList(), r, body)
+			}
+			return nil
 		},
 	}
 
 	proxy.ServeHTTP(w, r)
 }
+
+// invalidateS3Clients drops the cached S3 credentials affected by a
+// successful admin API call, so the browser doesn't keep using a key which
+// has been denied or deleted.
+func invalidateS3Clients(clients *utils.S3ClientPool, r *http.Request, body []byte) {
+	var req struct {
+		BucketID    string `json:"bucketId"`
+		AccessKeyID string `json:"accessKeyId"`
+		GlobalAlias string `json:"globalAlias"`
+		LocalAlias  string `json:"localAlias"`
+	}
+	json.Unmarshal(body, &req)
+	id := r.URL.Query().Get("id")
+
+	switch strings.TrimPrefix(r.URL.Path, "/api") {
+	case "/v2/DenyBucketKey":
+		clients.InvalidateAccessKey(req.AccessKeyID)
+		clients.InvalidateBucket(req.BucketID)
+	case "/v2/DeleteKey", "/v2/UpdateKey":
+		clients.InvalidateAccessKey(id)
+	case "/v2/DeleteBucket":
+		clients.InvalidateBucket(id)
+	case "/v2/AddBucketAlias", "/v2/RemoveBucketAlias":
+		clients.InvalidateBucket(req.BucketID)
+		clients.InvalidateBucket(req.GlobalAlias)
+		clients.InvalidateBucket(req.LocalAlias)
+	}
+}
+
+// invalidateBucketList drops the cached bucket list and details after a
+// successful admin API call changing buckets.
+func invalidateBucketList(list *utils.BucketListCache, r *http.Request, body []byte) {
+	var req struct {
+		BucketID string `json:"bucketId"`
+	}
+	json.Unmarshal(body, &req)
+
+	switch strings.TrimPrefix(r.URL.Path, "/api") {
+	case "/v2/CreateBucket":
+		list.InvalidateList()
+	case "/v2/DeleteKey":
+		list.Invalidate("")
+	case "/v2/UpdateBucket", "/v2/DeleteBucket":
+		list.Invalidate(r.URL.Query().Get("id"))
+	case "/v2/AddBucketAlias", "/v2/RemoveBucketAlias", "/v2/AllowBucketKey", "/v2/DenyBucketKey", "/v2/CleanupIncompleteUploads":
+		list.Invalidate(req.BucketID)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"khairul169/garage-webui/schema"
 	"khairul169/garage-webui/utils"
 	"net/http"
+	"strings"
 )
 
 func HandleApiRouter() *http.ServeMux {
@@ -21,6 +22,10 @@ func HandleApiRouter() *http.ServeMux {
 	config := &Config{}
 	router.HandleFunc("GET /config", config.GetAll)
 
+	clusters := &Clusters{}
+	router.HandleFunc("GET /clusters", clusters.GetAll)
+	router.Handle("GET /clusters/overview", middleware.AdminOnlyMiddleware(http.HandlerFunc(clusters.GetOverview)))
+
 	// User management routes (admin only)
 	users := &Users{}
 	usersRouter := http.NewServeMux()
@@ -29,6 +34,8 @@ func HandleApiRouter() *http.ServeMux {
 	usersRouter.HandleFunc("POST /users", users.Create)
 	usersRouter.HandleFunc("PUT /users/{id}", users.Update)
 	usersRouter.HandleFunc("DELETE /users/{id}", users.Delete)
+	usersRouter.HandleFunc("POST /users/{id}/access-key", users.LinkAccessKey)
+	usersRouter.HandleFunc("DELETE /users/{id}/access-key", users.UnlinkAccessKey)
 	router.Handle("/users", middleware.AdminOnlyMiddleware(usersRouter))
 	router.Handle("/users/", middleware.AdminOnlyMiddleware(usersRouter))
 
@@ -36,44 +43,91 @@ func HandleApiRouter() *http.ServeMux {
 	buckets := &Buckets{}
 	bucketsRouter := http.NewServeMux()
 	bucketsRouter.HandleFunc("GET /buckets", buckets.GetAll)
+	bucketsRouter.HandleFunc("POST /buckets", buckets.Create)
 	router.Handle("/buckets", middleware.BucketPermissionMiddleware(bucketsRouter))
-	
-	// Lifecycle routes - combine read and write handlers
-	lifecycleHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		bucket := r.URL.Query().Get("bucket")
-		userID := utils.Session.Get(r, "user_id")
-		if userID == nil {
-			utils.ResponseErrorStatus(w, errors.New("unauthorized"), http.StatusUnauthorized)
-			return
-		}
+	router.Handle("DELETE /buckets/{bucket}", middleware.BucketActionMiddleware("delete_bucket")(http.HandlerFunc(buckets.Delete)))
+	router.Handle("GET /buckets/{bucket}/analytics", middleware.BucketActionMiddleware("read")(http.HandlerFunc(buckets.GetAnalytics)))
 
-		user, _ := utils.Users.GetByID(userID.(string))
-		isAdmin := user != nil && user.Role == schema.RoleAdmin
+	// Alerting routes (admin only)
+	alerts := &Alerts{}
+	alertsRouter := http.NewServeMux()
+	alertsRouter.HandleFunc("GET /alerts", alerts.GetAll)
+	alertsRouter.HandleFunc("POST /alerts/evaluate", alerts.Evaluate)
+	alertsRouter.HandleFunc("GET /alerts/rules", alerts.GetRules)
+	alertsRouter.HandleFunc("POST /alerts/rules", alerts.CreateRule)
+	alertsRouter.HandleFunc("PUT /alerts/rules/{id}", alerts.UpdateRule)
+	alertsRouter.HandleFunc("DELETE /alerts/rules/{id}", alerts.DeleteRule)
+	alertsRouter.HandleFunc("GET /alerts/channels", alerts.GetChannels)
+	alertsRouter.HandleFunc("POST /alerts/channels", alerts.CreateChannel)
+	alertsRouter.HandleFunc("PUT /alerts/channels/{id}", alerts.UpdateChannel)
+	alertsRouter.HandleFunc("DELETE /alerts/channels/{id}", alerts.DeleteChannel)
+	alertsRouter.HandleFunc("POST /alerts/channels/{id}/test", alerts.TestChannel)
+	alertsRouter.HandleFunc("GET /alerts/silences", alerts.GetSilences)
+	alertsRouter.HandleFunc("POST /alerts/silences", alerts.CreateSilence)
+	alertsRouter.HandleFunc("DELETE /alerts/silences/{id}", alerts.DeleteSilence)
+	router.Handle("/alerts", middleware.AdminOnlyMiddleware(alertsRouter))
+	router.Handle("/alerts/", middleware.AdminOnlyMiddleware(alertsRouter))
 
-		switch r.Method {
-		case "GET":
-			// Read requires read permission
-			if !isAdmin && !utils.Users.HasBucketPermissionDetailed(userID.(string), bucket, "read") {
-				utils.ResponseErrorStatus(w, errors.New("forbidden"), http.StatusForbidden)
-				return
-			}
-			buckets.GetLifecycleConfiguration(w, r)
-		case "PUT", "DELETE":
-			// Write/Delete requires manage_lifecycle permission
-			if !isAdmin && !utils.Users.HasBucketPermissionDetailed(userID.(string), bucket, "manage_lifecycle") {
-				utils.ResponseErrorStatus(w, errors.New("forbidden"), http.StatusForbidden)
-				return
-			}
-			if r.Method == "PUT" {
-				buckets.PutLifecycleConfiguration(w, r)
-			} else {
-				buckets.DeleteLifecycleConfiguration(w, r)
-			}
-		default:
-			utils.ResponseErrorStatus(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
-		}
-	})
-	router.Handle("/buckets/lifecycle", lifecycleHandler)
+	// Bucket provisioning templates (admin only)
+	templates := &Templates{}
+	templatesRouter := http.NewServeMux()
+	templatesRouter.HandleFunc("GET /templates", templates.GetAll)
+	templatesRouter.HandleFunc("GET /templates/{id}", templates.GetOne)
+	templatesRouter.HandleFunc("POST /templates", templates.Create)
+	templatesRouter.HandleFunc("PUT /templates/{id}", templates.Update)
+	templatesRouter.HandleFunc("DELETE /templates/{id}", templates.Delete)
+	templatesRouter.HandleFunc("POST /templates/{id}/provision", templates.Provision)
+	router.Handle("/templates", middleware.AdminOnlyMiddleware(templatesRouter))
+	router.Handle("/templates/", middleware.AdminOnlyMiddleware(templatesRouter))
+
+	// Lifecycle policies (admin only)
+	policies := &LifecyclePolicies{}
+	policiesRouter := http.NewServeMux()
+	policiesRouter.HandleFunc("GET /lifecycle-policies", policies.GetAll)
+	policiesRouter.HandleFunc("GET /lifecycle-policies/{id}", policies.GetOne)
+	policiesRouter.HandleFunc("POST /lifecycle-policies", policies.Create)
+	policiesRouter.HandleFunc("PUT /lifecycle-policies/{id}", policies.Update)
+	policiesRouter.HandleFunc("DELETE /lifecycle-policies/{id}", policies.Delete)
+	policiesRouter.HandleFunc("PUT /lifecycle-policies/{id}/attachments", policies.SetAttachments)
+	policiesRouter.HandleFunc("GET /lifecycle-policies/{id}/drift", policies.GetDrift)
+	policiesRouter.HandleFunc("POST /lifecycle-policies/{id}/reconcile", policies.Reconcile)
+	router.Handle("/lifecycle-policies", middleware.AdminOnlyMiddleware(policiesRouter))
+	router.Handle("/lifecycle-policies/", middleware.AdminOnlyMiddleware(policiesRouter))
+
+	// Declarative configuration (admin only)
+	state := &State{}
+	stateRouter := http.NewServeMux()
+	stateRouter.HandleFunc("GET /state/export", state.Export)
+	stateRouter.HandleFunc("POST /state/plan", state.Plan)
+	stateRouter.HandleFunc("POST /state/apply", state.Apply)
+	router.Handle("/state", middleware.AdminOnlyMiddleware(stateRouter))
+	router.Handle("/state/", middleware.AdminOnlyMiddleware(stateRouter))
+
+	// Usage history routes
+	usage := &Usage{}
+	router.Handle("GET /buckets/{bucket}/usage", middleware.BucketActionMiddleware("read")(http.HandlerFunc(usage.GetHistory)))
+	router.Handle("GET /usage/forecast", middleware.AdminOnlyMiddleware(http.HandlerFunc(usage.GetForecasts)))
+
+	// Website hosting routes
+	website := &Website{}
+	router.Handle("GET /buckets/{bucket}/website", middleware.BucketActionMiddleware("read")(http.HandlerFunc(website.Get)))
+	router.Handle("PUT /buckets/{bucket}/website", middleware.BucketActionMiddleware("manage_website")(http.HandlerFunc(website.Update)))
+	router.Handle("POST /buckets/{bucket}/website/upload", middleware.BucketActionMiddleware("write")(http.HandlerFunc(website.Upload)))
+	router.Handle("GET /buckets/{bucket}/website/preview", middleware.BucketActionMiddleware("read")(http.HandlerFunc(website.Preview)))
+	router.Handle("GET /buckets/{bucket}/website/preview/{path...}", middleware.BucketActionMiddleware("read")(http.HandlerFunc(website.Preview)))
+	
+	// Lifecycle routes, write and delete require the manage_lifecycle permission
+	router.Handle("GET /buckets/{bucket}/lifecycle", middleware.BucketActionMiddleware("read")(http.HandlerFunc(buckets.GetLifecycleConfiguration)))
+	router.Handle("PUT /buckets/{bucket}/lifecycle", middleware.BucketActionMiddleware("manage_lifecycle")(http.HandlerFunc(buckets.PutLifecycleConfiguration)))
+	router.Handle("DELETE /buckets/{bucket}/lifecycle", middleware.BucketActionMiddleware("manage_lifecycle")(http.HandlerFunc(buckets.DeleteLifecycleConfiguration)))
+	router.Handle("POST /buckets/{bucket}/lifecycle/dry-run", middleware.BucketActionMiddleware("read")(http.HandlerFunc(buckets.LifecycleDryRun)))
+	router.Handle("GET /buckets/{bucket}/lifecycle/xml", middleware.BucketActionMiddleware("read")(http.HandlerFunc(buckets.ExportLifecycleConfiguration)))
+	router.Handle("PUT /buckets/{bucket}/lifecycle/xml", middleware.BucketActionMiddleware("manage_lifecycle")(http.HandlerFunc(buckets.ImportLifecycleConfiguration)))
+
+	// CORS routes, write and delete require the manage_cors permission
+	router.Handle("GET /buckets/{bucket}/cors", middleware.BucketActionMiddleware("read")(http.HandlerFunc(buckets.GetCorsConfiguration)))
+	router.Handle("PUT /buckets/{bucket}/cors", middleware.BucketActionMiddleware("manage_cors")(http.HandlerFunc(buckets.PutCorsConfiguration)))
+	router.Handle("DELETE /buckets/{bucket}/cors", middleware.BucketActionMiddleware("manage_cors")(http.HandlerFunc(buckets.DeleteCorsConfiguration)))
 
 	// Browse routes with permission checking
 	browse := &Browse{}
@@ -88,52 +142,25 @@ func HandleApiRouter() *http.ServeMux {
 	browseRouter.HandleFunc("PUT /multipart/{bucket}/{key...}", browse.UploadPart)
 	browseRouter.HandleFunc("POST /multipart/complete/{bucket}/{key...}", browse.CompleteMultipartUpload)
 	browseRouter.HandleFunc("DELETE /multipart/{bucket}/{key...}", browse.AbortMultipartUpload)
+
+	// Object metadata routes
+	browseRouter.HandleFunc("GET /metadata/{bucket}/{key...}", browse.GetObjectMetadata)
+	browseRouter.HandleFunc("PUT /metadata/{bucket}/{key...}", browse.UpdateObjectMetadata)
+
+	// Recursive object search
+	browseRouter.HandleFunc("GET /search/{bucket}", browse.SearchObjects)
+
+	// Local key index routes
+	index := &Index{}
+	browseRouter.HandleFunc("GET /index/{bucket}", index.Query)
+	browseRouter.HandleFunc("GET /index/{bucket}/largest", index.GetLargest)
+	browseRouter.HandleFunc("POST /index/{bucket}/reindex", index.Reindex)
 	
 	// Wrap with permission checking middleware
 	browsePermissionHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Parse bucket from URL path manually since PathValue may not work before ServeMux routing
-		path := r.URL.Path
-		var bucket string
-		
-		// Extract bucket name from path
-		if len(path) > len("/api/browse/") && (path[:len("/api/browse/")] == "/api/browse/" || path[:len("/browse/")] == "/browse/") {
-			// Remove /api/browse/ or /browse/ prefix
-			remaining := path[len("/api/browse/"):]
-			if path[:len("/browse/")] == "/browse/" {
-				remaining = path[len("/browse/"):]
-			}
-			// Get first segment as bucket name
-			for i, ch := range remaining {
-				if ch == '/' {
-					bucket = remaining[:i]
-					break
-				}
-			}
-			if bucket == "" && remaining != "" {
-				bucket = remaining
-			}
-		} else if len(path) > len("/api/multipart/") && (path[:len("/api/multipart/")] == "/api/multipart/" || path[:len("/multipart/")] == "/multipart/") {
-			// Remove /api/multipart/ or /multipart/ prefix
-			remaining := path[len("/api/multipart/"):]
-			if path[:len("/multipart/")] == "/multipart/" {
-				remaining = path[len("/multipart/"):]
-			}
-			// Handle /multipart/complete/ case
-			if len(remaining) > len("complete/") && remaining[:len("complete/")] == "complete/" {
-				remaining = remaining[len("complete/"):]
-			}
-			// Get first segment as bucket name
-			for i, ch := range remaining {
-				if ch == '/' {
-					bucket = remaining[:i]
-					break
-				}
-			}
-			if bucket == "" && remaining != "" {
-				bucket = remaining
-			}
-		}
-		
+		bucket := getBucketFromPath(r.URL.Path)
+
 		if bucket == "" {
 			utils.ResponseErrorStatus(w, errors.New("bucket name required"), http.StatusBadRequest)
 			return
@@ -162,7 +189,7 @@ func HandleApiRouter() *http.ServeMux {
 			return
 		}
 
-		hasPermission := utils.Users.HasBucketPermissionDetailed(userID.(string), bucket, requiredPermission)
+		hasPermission := utils.Users.HasBucketPermissionDetailed(utils.GetRequestCluster(r), userID.(string), bucket, requiredPermission)
 		
 		if !isAdmin && !hasPermission {
 			utils.ResponseErrorStatus(w, errors.New("forbidden: insufficient permissions"), http.StatusForbidden)
@@ -174,6 +201,9 @@ func HandleApiRouter() *http.ServeMux {
 	
 	router.Handle("/browse/", browsePermissionHandler)
 	router.Handle("/multipart/", browsePermissionHandler)
+	router.Handle("/metadata/", browsePermissionHandler)
+	router.Handle("/search/", browsePermissionHandler)
+	router.Handle("/index/", browsePermissionHandler)
 
 	// Proxy request to garage api endpoint (only v0, v1, v2 prefixes)
 	router.HandleFunc("/v0/{path...}", ProxyHandler)
@@ -199,6 +229,21 @@ func HandleApiRouter() *http.ServeMux {
 	// Other v2 routes (accessible to all authenticated users)
 	router.HandleFunc("/v2/{path...}", ProxyHandler)
 
-	mux.Handle("/", middleware.AuthMiddleware(router))
+	mux.Handle("/", middleware.AuthMiddleware(middleware.ClusterMiddleware(router)))
 	return mux
 }
+
+// getBucketFromPath extracts the bucket name from object routes such as
+// /browse/{bucket}/{key...} or /multipart/complete/{bucket}/{key...}.
+func getBucketFromPath(path string) string {
+	path = strings.TrimPrefix(path, "/api")
+
+	for _, prefix := range []string{"/multipart/complete/", "/multipart/", "/browse/", "/metadata/", "/search/", "/index/"} {
+		if remaining, ok := strings.CutPrefix(path, prefix); ok {
+			bucket, _, _ := strings.Cut(remaining, "/")
+			return bucket
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,129 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"khairul169/garage-webui/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	searchDefaultBudget = 10 * time.Second
+	searchMaxBudget     = 60 * time.Second
+	searchDefaultLimit  = 1000
+)
+
+// SearchObjects walks every object under a prefix and streams the objects
+// matching the query as newline-delimited JSON. The last line holds the
+// summary, with a token to resume the search when the time budget or the
+// result limit has been reached.
+func (b *Browse) SearchObjects(w http.ResponseWriter, r *http.Request) {
+	bucket := r.PathValue("bucket")
+	values := r.URL.Query()
+
+	query, err := utils.ParseObjectSearchQuery(values)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	filter, err := utils.NewObjectFilter(query)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	limit, err := strconv.Atoi(values.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = searchDefaultLimit
+	}
+
+	budget := searchDefaultBudget
+	if secs, err := strconv.Atoi(values.Get("budget")); err == nil && secs > 0 {
+		budget = min(time.Duration(secs)*time.Second, searchMaxBudget)
+	}
+
+	client, err := getS3Client(r, bucket)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), budget)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	summary := schema.ObjectSearchSummary{}
+
+	var token *string
+	if next := values.Get("next"); next != "" {
+		token = aws.String(next)
+	}
+
+	for {
+		if ctx.Err() != nil {
+			summary.Truncated = true
+			summary.NextToken = token
+			break
+		}
+
+		objects, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(client.Name),
+			Prefix:            aws.String(query.Prefix),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			summary.Error = err.Error()
+			summary.NextToken = token
+			break
+		}
+
+		for _, object := range objects.Contents {
+			summary.Scanned++
+
+			if !filter.Match(aws.ToString(object.Key), aws.ToInt64(object.Size), aws.ToTime(object.LastModified)) {
+				continue
+			}
+
+			summary.Matched++
+			enc.Encode(schema.ObjectSearchResult{
+				Object: &schema.BrowserObject{
+					ObjectKey:    object.Key,
+					LastModified: object.LastModified,
+					Size:         object.Size,
+					Url:          fmt.Sprintf("/browse/%s/%s", bucket, *object.Key),
+				},
+			})
+		}
+		rc.Flush()
+
+		token = objects.NextContinuationToken
+		if !aws.ToBool(objects.IsTruncated) || token == nil {
+			break
+		}
+		// The limit is checked per page so the resume token never skips objects
+		if summary.Matched >= int64(limit) {
+			summary.Truncated = true
+			summary.NextToken = token
+			break
+		}
+	}
+
+	enc.Encode(schema.ObjectSearchResult{Summary: &summary})
+	rc.Flush()
+}
@@ -0,0 +1,101 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"khairul169/garage-webui/schema"
+	"khairul169/garage-webui/utils"
+	"net/http"
+)
+
+type State struct{}
+
+// Export returns the state of the cluster as a YAML document.
+func (s *State) Export(w http.ResponseWriter, r *http.Request) {
+	state, err := utils.GetRequestCluster(r).ExportState(r.Context())
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	data, err := utils.EncodeStateYAML(state)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-state.yaml", utils.GetRequestCluster(r).Name))
+	w.Write(data)
+}
+
+// Plan returns the changes applying the YAML state of the body would make.
+// Users missing from the state are only deleted with `prune_users=true`.
+func (s *State) Plan(w http.ResponseWriter, r *http.Request) {
+	state, err := readStateBody(r)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	plan, err := utils.GetRequestCluster(r).PlanState(r.Context(), state, getStateOptions(r))
+	if err != nil {
+		writeStateError(w, err)
+		return
+	}
+
+	utils.ResponseSuccess(w, plan)
+}
+
+// Apply applies the YAML state of the body. The `confirm` query must be the
+// id of the plan to apply, as returned by Plan.
+func (s *State) Apply(w http.ResponseWriter, r *http.Request) {
+	confirm := r.URL.Query().Get("confirm")
+	if confirm == "" {
+		utils.ResponseErrorStatus(w, errors.New("confirm parameter is required"), http.StatusBadRequest)
+		return
+	}
+
+	state, err := readStateBody(r)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	res, err := utils.GetRequestCluster(r).ApplyState(r.Context(), state, getStateOptions(r), confirm)
+	if err != nil {
+		writeStateError(w, err)
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+// getStateOptions keeps the current user, and reads the prune_users query.
+func getStateOptions(r *http.Request) utils.StateOptions {
+	userID, _ := utils.Session.Get(r, "user_id").(string)
+	return utils.StateOptions{
+		KeepUserID: userID,
+		PruneUsers: r.URL.Query().Get("prune_users") == "true",
+	}
+}
+
+func readStateBody(r *http.Request) (*schema.ClusterState, error) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+	return utils.DecodeStateYAML(data)
+}
+
+func writeStateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, utils.ErrInvalidState):
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+	case errors.Is(err, utils.ErrPlanChanged):
+		utils.ResponseErrorStatus(w, err, http.StatusConflict)
+	default:
+		utils.ResponseError(w, err)
+	}
+}
@@ -0,0 +1,103 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"khairul169/garage-webui/schema"
+	"khairul169/garage-webui/utils"
+	"net/http"
+)
+
+type Templates struct{}
+
+func (t *Templates) GetAll(w http.ResponseWriter, r *http.Request) {
+	utils.ResponseSuccess(w, utils.Templates.GetAll())
+}
+
+func (t *Templates) GetOne(w http.ResponseWriter, r *http.Request) {
+	template, err := utils.Templates.GetByID(r.PathValue("id"))
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusNotFound)
+		return
+	}
+
+	utils.ResponseSuccess(w, template)
+}
+
+func (t *Templates) Create(w http.ResponseWriter, r *http.Request) {
+	var template schema.BucketTemplate
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	res, err := utils.Templates.Create(&template)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+func (t *Templates) Update(w http.ResponseWriter, r *http.Request) {
+	var template schema.BucketTemplate
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	res, err := utils.Templates.Update(r.PathValue("id"), &template)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, getTemplateErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+func (t *Templates) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := utils.Templates.Delete(r.PathValue("id")); err != nil {
+		utils.ResponseErrorStatus(w, err, getTemplateErrorStatus(err))
+		return
+	}
+
+	utils.ResponseSuccess(w, map[string]bool{"success": true})
+}
+
+// Provision creates a bucket from a template on the request cluster. The
+// secret key of the created access key is only returned by this call.
+func (t *Templates) Provision(w http.ResponseWriter, r *http.Request) {
+	template, err := utils.Templates.GetByID(r.PathValue("id"))
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusNotFound)
+		return
+	}
+
+	var req schema.ProvisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	res, err := utils.GetRequestCluster(r).Provision(r.Context(), template, &req)
+	if err != nil {
+		var provisionErr *utils.ProvisionError
+		if errors.As(err, &provisionErr) {
+			utils.ResponseError(w, err)
+		} else {
+			utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		}
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.ResponseSuccess(w, res)
+}
+
+func getTemplateErrorStatus(err error) int {
+	if errors.Is(err, utils.ErrTemplateNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,99 @@
+package router
+
+import (
+	"errors"
+	"khairul169/garage-webui/schema"
+	"khairul169/garage-webui/utils"
+	"net/http"
+	"time"
+)
+
+type Usage struct{}
+
+// GetHistory returns the usage history of a bucket with its forecast. The
+// `from` and `to` query params are RFC3339 dates, defaulting to the last 7
+// days, and `resolution` is raw, hour or day, defaulting to the finest one
+// covering the range.
+func (u *Usage) GetHistory(w http.ResponseWriter, r *http.Request) {
+	cluster := utils.GetRequestCluster(r)
+	query := r.URL.Query()
+
+	bucket, err := cluster.GetBucketInfo(r.PathValue("bucket"))
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-7 * 24 * time.Hour)
+	if value := query.Get("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			utils.ResponseErrorStatus(w, errors.New("invalid from date"), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			utils.ResponseErrorStatus(w, errors.New("invalid to date"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	resolution := query.Get("resolution")
+	if resolution == "" {
+		resolution = utils.Usage.GetResolution(from)
+	}
+
+	points, err := utils.Usage.History(cluster, bucket.ID, from, to, resolution)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, getUsageErrorStatus(err))
+		return
+	}
+
+	forecast, err := utils.Usage.Forecast(cluster, bucket.ID)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, getUsageErrorStatus(err))
+		return
+	}
+	forecast.Bucket = utils.GetBucketDisplayName(bucket)
+
+	utils.ResponseSuccess(w, schema.UsageHistory{
+		Bucket:     forecast.Bucket,
+		Resolution: resolution,
+		From:       from,
+		To:         to,
+		Points:     points,
+		Forecast:   forecast,
+	})
+}
+
+// GetForecasts returns the forecast of every bucket of the cluster.
+func (u *Usage) GetForecasts(w http.ResponseWriter, r *http.Request) {
+	cluster := utils.GetRequestCluster(r)
+
+	buckets, _, err := cluster.BucketList().List(r.Context())
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	res := make([]*schema.UsageForecast, 0, len(buckets))
+	for _, bucket := range buckets {
+		forecast, err := utils.Usage.Forecast(cluster, bucket.ID)
+		if err != nil {
+			utils.ResponseErrorStatus(w, err, getUsageErrorStatus(err))
+			return
+		}
+		forecast.Bucket = getListedBucketName(&bucket)
+		res = append(res, forecast)
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+func getUsageErrorStatus(err error) int {
+	if errors.Is(err, utils.ErrUsageDisabled) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
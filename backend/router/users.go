@@ -3,8 +3,11 @@ package router
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"khairul169/garage-webui/schema"
 	"khairul169/garage-webui/utils"
+	"log"
 	"net/http"
 )
 
@@ -144,6 +147,7 @@ func (c *Users) Update(w http.ResponseWriter, r *http.Request) {
 	if !isAdmin {
 		req.Role = ""
 		req.BucketPermissions = nil
+		req.BucketAllowance = nil
 	}
 
 	user, err := utils.Users.Update(id, &req)
@@ -152,6 +156,11 @@ func (c *Users) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := utils.SyncUserKey(r.Context(), user); err != nil {
+		utils.ResponseError(w, fmt.Errorf("user updated but access key sync failed: %w", err))
+		return
+	}
+
 	utils.ResponseSuccess(w, user.ToResponse())
 }
 
@@ -181,10 +190,67 @@ func (c *Users) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, err := utils.Users.GetByID(id)
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusNotFound)
+		return
+	}
+
 	if err := utils.Users.Delete(id); err != nil {
 		utils.ResponseError(w, err)
 		return
 	}
 
+	if user.AccessKeyManaged {
+		if err := utils.RevokeUserKey(r.Context(), user); err != nil {
+			log.Printf("Cannot delete access key of user %s: %v", user.Username, err)
+		}
+	}
+
 	utils.ResponseSuccess(w, map[string]bool{"success": true})
 }
+
+// LinkAccessKey links an existing Garage access key to a user, or
+// provisions a new key when no key id is given.
+func (c *Users) LinkAccessKey(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.Users.GetByID(r.PathValue("id"))
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		AccessKeyID string `json:"access_key_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if req.AccessKeyID != "" {
+		user, err = utils.LinkUserKey(r.Context(), user, req.AccessKeyID)
+	} else {
+		user, err = utils.ProvisionUserKey(r.Context(), user)
+	}
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	utils.ResponseSuccess(w, user.ToResponse())
+}
+
+func (c *Users) UnlinkAccessKey(w http.ResponseWriter, r *http.Request) {
+	user, err := utils.Users.GetByID(r.PathValue("id"))
+	if err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err := utils.RevokeUserKey(r.Context(), user); err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	utils.ResponseSuccess(w, user.ToResponse())
+}
@@ -0,0 +1,183 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"khairul169/garage-webui/schema"
+	"khairul169/garage-webui/utils"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+type Website struct{}
+
+func (ws *Website) Get(w http.ResponseWriter, r *http.Request) {
+	cluster := utils.GetRequestCluster(r)
+	res, err := cluster.GetWebsite(r.Context(), r.PathValue("bucket"))
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+func (ws *Website) Update(w http.ResponseWriter, r *http.Request) {
+	var req schema.UpdateWebsiteAccess
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	cluster := utils.GetRequestCluster(r)
+	res, err := cluster.UpdateWebsite(r.Context(), r.PathValue("bucket"), &req)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+// Upload extracts the ZIP archive of the `file` form field into the bucket,
+// under the optional `prefix` form field.
+func (ws *Website) Upload(w http.ResponseWriter, r *http.Request) {
+	// The form is spooled to disk, limit it before parsing. The margin leaves
+	// room for the multipart framing and the other fields.
+	r.Body = http.MaxBytesReader(w, r.Body, utils.GetWebsiteMaxSize()+1<<20)
+
+	file, headers, err := r.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			utils.ResponseErrorStatus(w, fmt.Errorf("archive is larger than %d bytes", utils.GetWebsiteMaxSize()), http.StatusRequestEntityTooLarge)
+			return
+		}
+		utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	prefix := strings.TrimPrefix(r.FormValue("prefix"), "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	client, err := getS3Client(r, r.PathValue("bucket"))
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	res, err := utils.UploadWebsiteArchive(r.Context(), client, file, headers.Size, prefix)
+	if err != nil {
+		if res == nil {
+			utils.ResponseErrorStatus(w, err, http.StatusBadRequest)
+			return
+		}
+		utils.ResponseError(w, err)
+		return
+	}
+
+	utils.ResponseSuccess(w, res)
+}
+
+// Preview serves the website of a bucket the way the Garage web endpoint
+// does, so it can be checked before being published. The content is
+// sandboxed so its scripts cannot act on the WebUI with the user session.
+func (ws *Website) Preview(w http.ResponseWriter, r *http.Request) {
+	// Links of the site are relative to the preview root
+	if !strings.HasSuffix(r.URL.Path, "/") && r.PathValue("path") == "" {
+		w.Header().Set("Location", "preview/")
+		w.WriteHeader(http.StatusMovedPermanently)
+		return
+	}
+
+	bucket := r.PathValue("bucket")
+	info, err := utils.GetRequestCluster(r).GetBucketInfo(bucket)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	client, err := getS3Client(r, bucket)
+	if err != nil {
+		utils.ResponseError(w, err)
+		return
+	}
+
+	index := info.WebsiteConfig.IndexDocument
+	if index == "" {
+		index = "index.html"
+	}
+
+	key := r.PathValue("path")
+	if key == "" || strings.HasSuffix(key, "/") {
+		key += index
+	}
+
+	object, err := getPreviewObject(r, client, key)
+	if isNoSuchKey(err) && !strings.HasSuffix(r.URL.Path, "/") {
+		// Like Garage, redirect to the directory when it has an index
+		if dir, err := getPreviewObject(r, client, key+"/"+index); err == nil {
+			dir.Body.Close()
+			w.Header().Set("Location", path.Base(key)+"/")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+	}
+
+	status := http.StatusOK
+	if isNoSuchKey(err) && info.WebsiteConfig.ErrorDocument != "" {
+		status = http.StatusNotFound
+		object, err = getPreviewObject(r, client, info.WebsiteConfig.ErrorDocument)
+	}
+	if err != nil {
+		if isNoSuchKey(err) {
+			utils.ResponseErrorStatus(w, err, http.StatusNotFound)
+			return
+		}
+		utils.ResponseError(w, err)
+		return
+	}
+	defer object.Body.Close()
+
+	w.Header().Set("Content-Security-Policy", "sandbox allow-scripts allow-forms allow-popups")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if object.ContentType != nil {
+		w.Header().Set("Content-Type", *object.ContentType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	if object.ContentLength != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(*object.ContentLength, 10))
+	}
+	if object.ETag != nil {
+		w.Header().Set("Etag", *object.ETag)
+	}
+
+	w.WriteHeader(status)
+	io.Copy(w, object.Body)
+}
+
+func getPreviewObject(r *http.Request, client *utils.S3Bucket, key string) (*s3.GetObjectOutput, error) {
+	return client.GetObject(r.Context(), &s3.GetObjectInput{
+		Bucket: aws.String(client.Name),
+		Key:    aws.String(key),
+	})
+}
+
+func isNoSuchKey(err error) bool {
+	var ae smithy.APIError
+	return errors.As(err, &ae) && ae.ErrorCode() == "NoSuchKey"
+}
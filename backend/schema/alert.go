@@ -0,0 +1,102 @@
+package schema
+
+import "time"
+
+type AlertRuleType string
+
+const (
+	AlertBucketSize      AlertRuleType = "bucket_size"      // Percent of the bucket max size quota
+	AlertBucketObjects   AlertRuleType = "bucket_objects"   // Percent of the bucket max objects quota
+	AlertStaleUploads    AlertRuleType = "stale_uploads"    // Bytes of unfinished multipart uploads of a bucket
+	AlertClusterCapacity AlertRuleType = "cluster_capacity" // Percent of free data capacity, fires below the threshold
+	AlertUnhealthyNodes  AlertRuleType = "unhealthy_nodes"  // Number of disconnected or down nodes
+)
+
+// AlertRule fires an alert for every bucket, or cluster, reaching its
+// threshold.
+type AlertRule struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Type      AlertRuleType `json:"type"`
+	Cluster   string        `json:"cluster,omitempty"`   // Cluster name, empty for the default cluster or "*" for every cluster
+	BucketID  string        `json:"bucket_id,omitempty"` // Bucket rules only, empty for every bucket
+	Threshold float64       `json:"threshold"`
+	Severity  string        `json:"severity"` // "warning" or "critical"
+	Channels  []string      `json:"channels"` // Notification channel ids
+	Disabled  bool          `json:"disabled"`
+}
+
+type AlertChannelType string
+
+const (
+	AlertChannelWebhook AlertChannelType = "webhook"
+	AlertChannelSMTP    AlertChannelType = "smtp"
+)
+
+// AlertChannel sends the alert notifications, webhooks receive an
+// AlertNotification as JSON.
+type AlertChannel struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Type    AlertChannelType  `json:"type"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	SMTPHost     string   `json:"smtp_host,omitempty"`
+	SMTPPort     int      `json:"smtp_port,omitempty"`
+	SMTPUsername string   `json:"smtp_username,omitempty"`
+	SMTPPassword string   `json:"smtp_password,omitempty"` // Kept on updates when empty, never returned
+	From         string   `json:"from,omitempty"`
+	To           []string `json:"to,omitempty"`
+}
+
+// WithoutSecrets returns a copy of the channel without its SMTP password.
+func (c *AlertChannel) WithoutSecrets() *AlertChannel {
+	res := *c
+	res.SMTPPassword = ""
+	return &res
+}
+
+type AlertState string
+
+const (
+	AlertFiring   AlertState = "firing"
+	AlertResolved AlertState = "resolved"
+)
+
+type Alert struct {
+	ID         string        `json:"id"`
+	RuleID     string        `json:"rule_id"`
+	RuleName   string        `json:"rule_name"`
+	Type       AlertRuleType `json:"type"`
+	Severity   string        `json:"severity"`
+	Cluster    string        `json:"cluster"`
+	Subject    string        `json:"subject"` // Bucket id or cluster name
+	Name       string        `json:"name"`    // Bucket alias or cluster name
+	State      AlertState    `json:"state"`
+	Value      float64       `json:"value"`
+	Threshold  float64       `json:"threshold"`
+	Message    string        `json:"message"`
+	StartedAt  time.Time     `json:"started_at"`
+	ResolvedAt *time.Time    `json:"resolved_at,omitempty"`
+	Silenced   bool          `json:"silenced"`
+}
+
+// AlertSilence mutes the notifications of matching alerts until EndsAt,
+// empty fields match everything.
+type AlertSilence struct {
+	ID        string    `json:"id"`
+	RuleID    string    `json:"rule_id,omitempty"`
+	Cluster   string    `json:"cluster,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Comment   string    `json:"comment"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	EndsAt    time.Time `json:"ends_at"`
+}
+
+type AlertNotification struct {
+	Alert *Alert    `json:"alert"`
+	Test  bool      `json:"test,omitempty"`
+	Time  time.Time `json:"time"`
+}
@@ -0,0 +1,38 @@
+package schema
+
+import "time"
+
+type BucketAnalytics struct {
+	Bucket      string     `json:"bucket"`
+	Prefix      string     `json:"prefix"`
+	Running     bool       `json:"running"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   *time.Time `json:"startedAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+
+	Objects int64 `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+
+	// Breakdown by the next path segment below Prefix, objects stored
+	// directly under the prefix are grouped under an empty name.
+	Prefixes      []AnalyticsGroup     `json:"prefixes"`
+	Extensions    []AnalyticsGroup     `json:"extensions"`
+	ContentTypes  []AnalyticsGroup     `json:"contentTypes"`
+	SizeHistogram []AnalyticsHistogram `json:"sizeHistogram"`
+	AgeHistogram  []AnalyticsHistogram `json:"ageHistogram"`
+	Largest       []IndexedObject      `json:"largest"`
+}
+
+type AnalyticsGroup struct {
+	Name    string `json:"name"`
+	Objects int64  `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+}
+
+type AnalyticsHistogram struct {
+	Label   string `json:"label"`
+	Min     int64  `json:"min"`
+	Max     *int64 `json:"max"` // Exclusive, nil for the last bucket
+	Objects int64  `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+}
@@ -15,3 +15,57 @@ type BrowserObject struct {
 	Size         *int64     `json:"size"`
 	Url          string     `json:"url"`
 }
+
+type ObjectChecksumResult struct {
+	Key       string `json:"key"`
+	Algorithm string `json:"algorithm"`
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual"`
+	Size      int64  `json:"size"`
+	Match     bool   `json:"match"`
+}
+
+// ObjectHeaders are the user editable headers and metadata (x-amz-meta-*)
+// of an object.
+type ObjectHeaders struct {
+	ContentType        string            `json:"contentType"`
+	CacheControl       string            `json:"cacheControl"`
+	ContentDisposition string            `json:"contentDisposition"`
+	ContentEncoding    string            `json:"contentEncoding"`
+	ContentLanguage    string            `json:"contentLanguage"`
+	Metadata           map[string]string `json:"metadata"`
+}
+
+type ObjectMetadata struct {
+	Key          string     `json:"key"`
+	Size         int64      `json:"size"`
+	ETag         string     `json:"etag"`
+	LastModified *time.Time `json:"lastModified"`
+	ObjectHeaders
+}
+
+type ObjectSearchQuery struct {
+	Prefix         string     `json:"prefix"`
+	Query          string     `json:"query"`
+	Mode           string     `json:"mode"` // "substring", "glob" or "regex"
+	CaseSensitive  bool       `json:"caseSensitive"`
+	MinSize        *int64     `json:"minSize,omitempty"`
+	MaxSize        *int64     `json:"maxSize,omitempty"`
+	ModifiedAfter  *time.Time `json:"modifiedAfter,omitempty"`
+	ModifiedBefore *time.Time `json:"modifiedBefore,omitempty"`
+}
+
+// ObjectSearchResult is a single line of the search response stream, it
+// holds either a matched object or the final summary.
+type ObjectSearchResult struct {
+	Object  *BrowserObject       `json:"object,omitempty"`
+	Summary *ObjectSearchSummary `json:"summary,omitempty"`
+}
+
+type ObjectSearchSummary struct {
+	Scanned   int64   `json:"scanned"`
+	Matched   int64   `json:"matched"`
+	Truncated bool    `json:"truncated"`
+	NextToken *string `json:"nextToken"`
+	Error     string  `json:"error,omitempty"`
+}
@@ -1,5 +1,7 @@
 package schema
 
+import "time"
+
 type GetBucketsRes struct {
 	ID            string       `json:"id"`
 	GlobalAliases []string     `json:"globalAliases"`
@@ -68,15 +70,21 @@ type LifecycleRule struct {
 	AbortIncompleteMultipartUpload *AbortIncompleteMultipartUpload `json:"abortIncompleteMultipartUpload,omitempty"`
 }
 
+// LifecycleFilter selects the objects of a rule. Every condition must match,
+// whether set on the filter or in And.
 type LifecycleFilter struct {
-	Prefix string            `json:"prefix,omitempty"`
-	Tags   []LifecycleTag    `json:"tags,omitempty"`
-	And    *LifecycleFilterAnd `json:"and,omitempty"`
+	Prefix                string              `json:"prefix,omitempty"`
+	Tags                  []LifecycleTag      `json:"tags,omitempty"`
+	ObjectSizeGreaterThan *int64              `json:"objectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    *int64              `json:"objectSizeLessThan,omitempty"`
+	And                   *LifecycleFilterAnd `json:"and,omitempty"`
 }
 
 type LifecycleFilterAnd struct {
-	Prefix string         `json:"prefix,omitempty"`
-	Tags   []LifecycleTag `json:"tags,omitempty"`
+	Prefix                string         `json:"prefix,omitempty"`
+	Tags                  []LifecycleTag `json:"tags,omitempty"`
+	ObjectSizeGreaterThan *int64         `json:"objectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    *int64         `json:"objectSizeLessThan,omitempty"`
 }
 
 type LifecycleTag struct {
@@ -86,7 +94,7 @@ type LifecycleTag struct {
 
 type LifecycleExpiration struct {
 	Days                      *int32  `json:"days,omitempty"`
-	Date                      *string `json:"date,omitempty"`
+	Date                      *string `json:"date,omitempty"` // YYYY-MM-DD, midnight UTC
 	ExpiredObjectDeleteMarker *bool   `json:"expiredObjectDeleteMarker,omitempty"`
 }
 
@@ -102,3 +110,101 @@ type AbortIncompleteMultipartUpload struct {
 type PutLifecycleRequest struct {
 	Rules []LifecycleRule `json:"rules"`
 }
+
+// LifecycleDryRun reports what lifecycle rules would remove from a bucket,
+// from a scan of its objects and unfinished multipart uploads.
+type LifecycleDryRun struct {
+	Objects int64                 `json:"objects"`
+	Bytes   int64                 `json:"bytes"`
+	Uploads int64                 `json:"uploads"`
+	Rules   []LifecycleRuleImpact `json:"rules"`
+}
+
+// LifecycleRuleImpact is the cumulative impact of a rule by the end of the
+// current day (UTC), and 7 and 30 days later.
+type LifecycleRuleImpact struct {
+	ID       string          `json:"id"`
+	Status   string          `json:"status"`
+	Today    LifecycleImpact `json:"today"`
+	In7Days  LifecycleImpact `json:"in7Days"`
+	In30Days LifecycleImpact `json:"in30Days"`
+}
+
+type LifecycleImpact struct {
+	Objects int64 `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+	Uploads int64 `json:"uploads"` // aborted multipart uploads
+}
+
+// CORSConfiguration is the CORS configuration of a bucket, allowing browser
+// apps to access it directly.
+type CORSConfiguration struct {
+	Rules []CORSRule `json:"rules"`
+}
+
+type CORSRule struct {
+	ID             string   `json:"id,omitempty"`
+	AllowedOrigins []string `json:"allowedOrigins"` // e.g. "https://app.example.com", "https://*.example.com" or "*"
+	AllowedMethods []string `json:"allowedMethods"` // GET, PUT, POST, DELETE or HEAD
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+	ExposeHeaders  []string `json:"exposeHeaders,omitempty"`
+	MaxAgeSeconds  *int32   `json:"maxAgeSeconds,omitempty"`
+}
+
+type CreateBucketRequest struct {
+	GlobalAlias *string                 `json:"globalAlias,omitempty"`
+	LocalAlias  *CreateBucketLocalAlias `json:"localAlias,omitempty"`
+}
+
+type CreateBucketLocalAlias struct {
+	AccessKeyID string      `json:"accessKeyId"`
+	Alias       string      `json:"alias"`
+	Allow       Permissions `json:"allow"`
+}
+
+type UpdateBucketRequest struct {
+	WebsiteAccess *UpdateWebsiteAccess `json:"websiteAccess,omitempty"`
+	Quotas        *UpdateBucketQuotas  `json:"quotas,omitempty"`
+}
+
+type UpdateWebsiteAccess struct {
+	Enabled       bool   `json:"enabled"`
+	IndexDocument string `json:"indexDocument,omitempty"`
+	ErrorDocument string `json:"errorDocument,omitempty"`
+}
+
+// UpdateBucketQuotas replaces both quotas, nil removes a quota.
+type UpdateBucketQuotas struct {
+	MaxSize    *int64 `json:"maxSize"`
+	MaxObjects *int64 `json:"maxObjects"`
+}
+
+// BucketAliasRequest adds or removes either a global alias, or a local alias
+// of an access key.
+type BucketAliasRequest struct {
+	BucketID    string `json:"bucketId"`
+	GlobalAlias string `json:"globalAlias,omitempty"`
+	AccessKeyID string `json:"accessKeyId,omitempty"`
+	LocalAlias  string `json:"localAlias,omitempty"`
+}
+
+type BucketKeyPermRequest struct {
+	BucketID    string      `json:"bucketId"`
+	AccessKeyID string      `json:"accessKeyId"`
+	Permissions Permissions `json:"permissions"`
+}
+
+type CleanupUploadsResult struct {
+	UploadsDeleted int64 `json:"uploadsDeleted"`
+}
+
+// BucketListResult is a page of GET /buckets. FetchedAt is the oldest fetch
+// time of the returned data, Stale is set when some of it is being refreshed.
+type BucketListResult struct {
+	Buckets   []Bucket  `json:"buckets"`
+	Total     int       `json:"total"`
+	Page      int       `json:"page"`
+	Limit     int       `json:"limit"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	Stale     bool      `json:"stale"`
+}
@@ -0,0 +1,187 @@
+package schema
+
+import "encoding/json"
+
+type ClusterHealth struct {
+	Status           string `json:"status"` // "healthy", "degraded" or "unavailable"
+	KnownNodes       int    `json:"knownNodes"`
+	ConnectedNodes   int    `json:"connectedNodes"`
+	StorageNodes     int    `json:"storageNodes"`
+	StorageNodesUp   int    `json:"storageNodesUp"`
+	Partitions       int    `json:"partitions"`
+	PartitionsQuorum int    `json:"partitionsQuorum"`
+	PartitionsAllOk  int    `json:"partitionsAllOk"`
+}
+
+type ClusterStatus struct {
+	LayoutVersion int64        `json:"layoutVersion"`
+	Nodes         []NodeStatus `json:"nodes"`
+}
+
+type NodeStatus struct {
+	ID                string         `json:"id"`
+	GarageVersion     string         `json:"garageVersion"`
+	Addr              string         `json:"addr"`
+	Hostname          string         `json:"hostname"`
+	IsUp              bool           `json:"isUp"`
+	LastSeenSecsAgo   *int64         `json:"lastSeenSecsAgo"`
+	Role              *NodeRole      `json:"role"`
+	Draining          bool           `json:"draining"`
+	DataPartition     *DiskPartition `json:"dataPartition"`
+	MetadataPartition *DiskPartition `json:"metadataPartition"`
+}
+
+type NodeRole struct {
+	ID       string   `json:"id,omitempty"`
+	Zone     string   `json:"zone"`
+	Capacity *int64   `json:"capacity"` // nil for gateway nodes
+	Tags     []string `json:"tags"`
+	Remove   bool     `json:"remove,omitempty"` // Staged role removal
+}
+
+type DiskPartition struct {
+	Available int64 `json:"available"`
+	Total     int64 `json:"total"`
+}
+
+type ClusterStatistics struct {
+	Freeform string `json:"freeform"`
+}
+
+type ConnectNodeResult struct {
+	Success bool    `json:"success"`
+	Error   *string `json:"error"`
+}
+
+type ClusterLayout struct {
+	Version           int64             `json:"version"`
+	Roles             []LayoutNodeRole  `json:"roles"`
+	Parameters        LayoutParameters  `json:"parameters"`
+	PartitionSize     int64             `json:"partitionSize"`
+	StagedRoleChanges []NodeRole        `json:"stagedRoleChanges"`
+	StagedParameters  *LayoutParameters `json:"stagedParameters"`
+}
+
+type LayoutNodeRole struct {
+	ID               string   `json:"id"`
+	Zone             string   `json:"zone"`
+	Capacity         *int64   `json:"capacity"`
+	StoredPartitions *int64   `json:"storedPartitions"`
+	UsableCapacity   *int64   `json:"usableCapacity"`
+	Tags             []string `json:"tags"`
+}
+
+// LayoutParameters.ZoneRedundancy is either the string "maximum" or
+// {"atLeast": n}.
+type LayoutParameters struct {
+	ZoneRedundancy json.RawMessage `json:"zoneRedundancy"`
+}
+
+type UpdateLayoutRequest struct {
+	Roles      []NodeRole        `json:"roles,omitempty"`
+	Parameters *LayoutParameters `json:"parameters,omitempty"`
+}
+
+type ApplyLayoutResult struct {
+	Message []string      `json:"message"`
+	Layout  ClusterLayout `json:"layout"`
+}
+
+type PreviewLayoutResult struct {
+	Message   []string       `json:"message"`
+	NewLayout *ClusterLayout `json:"newLayout"`
+	Error     string         `json:"error"`
+}
+
+// NodeResponse is the result of a node endpoint, which may target a single
+// node, "self" or "*" for every node. Nodes which failed are listed in Error.
+type NodeResponse[T any] struct {
+	Success map[string]T      `json:"success"`
+	Error   map[string]string `json:"error"`
+}
+
+type NodeInfo struct {
+	NodeID         string   `json:"nodeId"`
+	GarageVersion  string   `json:"garageVersion"`
+	GarageFeatures []string `json:"garageFeatures"`
+	RustVersion    string   `json:"rustVersion"`
+	DBEngine       string   `json:"dbEngine"`
+}
+
+type NodeStatistics struct {
+	Freeform string `json:"freeform"`
+}
+
+type WorkerInfo struct {
+	ID                int64        `json:"id"`
+	Name              string       `json:"name"`
+	State             string       `json:"state"`
+	Errors            int64        `json:"errors"`
+	ConsecutiveErrors int64        `json:"consecutiveErrors"`
+	LastError         *WorkerError `json:"lastError"`
+	Tranquility       *int64       `json:"tranquility"`
+	Progress          *string      `json:"progress"`
+	QueueLength       *int64       `json:"queueLength"`
+	PersistentErrors  *int64       `json:"persistentErrors"`
+	Freeform          []string     `json:"freeform"`
+}
+
+type WorkerError struct {
+	Message string `json:"message"`
+	SecsAgo int64  `json:"secsAgo"`
+}
+
+type WorkerVariable struct {
+	Variable string `json:"variable"`
+	Value    string `json:"value"`
+}
+
+type BlockError struct {
+	BlockHash      string `json:"blockHash"`
+	Refcount       int64  `json:"refcount"`
+	ErrorCount     int64  `json:"errorCount"`
+	LastTrySecsAgo int64  `json:"lastTrySecsAgo"`
+	NextTryInSecs  int64  `json:"nextTryInSecs"`
+}
+
+type BlockInfo struct {
+	NodeID    string            `json:"nodeId"`
+	BlockHash string            `json:"blockHash"`
+	Refcount  int64             `json:"refcount"`
+	Versions  []json.RawMessage `json:"versions"`
+}
+
+type BlockResyncResult struct {
+	Count int64 `json:"count"`
+}
+
+type BlockPurgeResult struct {
+	BlocksPurged    int64 `json:"blocksPurged"`
+	ObjectsDeleted  int64 `json:"objectsDeleted"`
+	UploadsDeleted  int64 `json:"uploadsDeleted"`
+	VersionsDeleted int64 `json:"versionsDeleted"`
+}
+
+type ClusterInfo struct {
+	Name       string `json:"name"`
+	Default    bool   `json:"default"`
+	S3Endpoint string `json:"s3Endpoint"`
+	S3Region   string `json:"s3Region"`
+}
+
+// ClusterOverview summarizes the health and capacity of a cluster, capacity
+// is the sum of the layout capacity of storage nodes and data is the disk
+// space of their data partitions.
+type ClusterOverview struct {
+	Name          string         `json:"name"`
+	Default       bool           `json:"default"`
+	S3Endpoint    string         `json:"s3Endpoint"`
+	Health        *ClusterHealth `json:"health"`
+	LayoutVersion int64          `json:"layoutVersion"`
+	Nodes         int            `json:"nodes"`
+	NodesUp       int            `json:"nodesUp"`
+	Capacity      int64          `json:"capacity"`
+	DataAvailable int64          `json:"dataAvailable"`
+	DataTotal     int64          `json:"dataTotal"`
+	Error         string         `json:"error,omitempty"`
+}
@@ -1,5 +1,19 @@
 package schema
 
+// ClusterConfig is an entry of the clusters file.
+type ClusterConfig struct {
+	Name          string `json:"name" toml:"name"`
+	AdminEndpoint string `json:"admin_endpoint" toml:"admin_endpoint"`
+	AdminToken    string `json:"-" toml:"admin_token"`
+	S3Endpoint    string `json:"s3_endpoint" toml:"s3_endpoint"`
+	S3Region      string `json:"s3_region" toml:"s3_region"`
+	ConfigPath    string `json:"config_path" toml:"config_path"` // Optional garage.toml of the cluster
+}
+
+type ClustersFile struct {
+	Clusters []ClusterConfig `toml:"clusters"`
+}
+
 type Config struct {
 	RPCBindAddr   string `json:"rpc_bind_addr" toml:"rpc_bind_addr"`
 	RPCPublicAddr string `json:"rpc_public_addr" toml:"rpc_public_addr"`
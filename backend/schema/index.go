@@ -0,0 +1,24 @@
+package schema
+
+import "time"
+
+type IndexedObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+	ContentType  string    `json:"contentType"`
+}
+
+type IndexStatus struct {
+	Bucket    string     `json:"bucket"`
+	Objects   int        `json:"objects"`
+	IndexedAt *time.Time `json:"indexedAt"`
+	Indexing  bool       `json:"indexing"`
+}
+
+type IndexQueryResult struct {
+	Objects []IndexedObject `json:"objects"`
+	HasMore bool            `json:"hasMore"`
+	Status  IndexStatus     `json:"status"`
+}
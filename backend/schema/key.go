@@ -0,0 +1,46 @@
+package schema
+
+import "time"
+
+type ListKeysRes struct {
+	ID      string     `json:"id"`
+	Name    string     `json:"name"`
+	Created *time.Time `json:"created"`
+	Expired bool       `json:"expired"`
+}
+
+type KeyInfo struct {
+	Name            string      `json:"name"`
+	AccessKeyID     string      `json:"accessKeyId"`
+	SecretAccessKey string      `json:"secretAccessKey"`
+	Created         *time.Time  `json:"created"`
+	Expired         bool        `json:"expired"`
+	Buckets         []KeyBucket `json:"buckets"`
+}
+
+type KeyBucket struct {
+	ID            string      `json:"id"`
+	GlobalAliases []string    `json:"globalAliases"`
+	LocalAliases  []string    `json:"localAliases"`
+	Permissions   Permissions `json:"permissions"`
+}
+
+type KeyPermissions struct {
+	CreateBucket bool `json:"createBucket"`
+}
+
+type CreateKeyRequest struct {
+	Name         string          `json:"name,omitempty"`
+	Allow        *KeyPermissions `json:"allow,omitempty"`
+	Deny         *KeyPermissions `json:"deny,omitempty"`
+	Expiration   *time.Time      `json:"expiration,omitempty"`
+	NeverExpires bool            `json:"neverExpires,omitempty"`
+}
+
+type UpdateKeyRequest = CreateKeyRequest
+
+type ImportKeyRequest struct {
+	AccessKeyID     string `json:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey"`
+	Name            string `json:"name,omitempty"`
+}
@@ -0,0 +1,64 @@
+package schema
+
+import "time"
+
+// LifecyclePolicy is a named set of lifecycle rules kept in sync on every
+// bucket it is attached to. Each change of the rules is a new version.
+type LifecyclePolicy struct {
+	ID          string                   `json:"id"`
+	Name        string                   `json:"name"`
+	Description string                   `json:"description"`
+	Version     int                      `json:"version"`
+	Rules       []LifecycleRule          `json:"rules"`
+	Attachments []PolicyAttachment       `json:"attachments"`
+	History     []LifecyclePolicyVersion `json:"history"` // Previous versions, oldest first
+	CreatedAt   time.Time                `json:"created_at"`
+	UpdatedAt   time.Time                `json:"updated_at"`
+}
+
+type LifecyclePolicyVersion struct {
+	Version   int             `json:"version"`
+	Rules     []LifecycleRule `json:"rules"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// PolicyAttachment selects buckets by id or global alias, or by a pattern
+// matched against their global aliases, e.g. "app-*".
+type PolicyAttachment struct {
+	Cluster string `json:"cluster,omitempty"` // Empty for the default cluster, "*" for every cluster
+	Bucket  string `json:"bucket,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+}
+
+type PolicyDriftStatus string
+
+const (
+	PolicyInSync   PolicyDriftStatus = "in_sync"
+	PolicyDrifted  PolicyDriftStatus = "drifted"
+	PolicyMissing  PolicyDriftStatus = "missing"  // The bucket has no lifecycle configuration
+	PolicyConflict PolicyDriftStatus = "conflict" // Several policies are attached to the bucket
+	PolicyError    PolicyDriftStatus = "error"
+)
+
+// PolicyDrift compares the lifecycle configuration of an attached bucket
+// with its policy.
+type PolicyDrift struct {
+	Cluster   string            `json:"cluster"`
+	BucketID  string            `json:"bucket_id"`
+	Bucket    string            `json:"bucket"`
+	Status    PolicyDriftStatus `json:"status"`
+	Policies  []string          `json:"policies,omitempty"` // Policy ids, on conflicts
+	Actual    []LifecycleRule   `json:"actual"`
+	Error     string            `json:"error,omitempty"`
+	Reconcile string            `json:"reconcile,omitempty"` // "applied" or the error of the reconcile
+}
+
+type PolicyDriftReport struct {
+	PolicyID string        `json:"policy_id"`
+	Version  int           `json:"version"`
+	Buckets  []PolicyDrift `json:"buckets"`
+}
+
+type ReconcilePolicyRequest struct {
+	BucketIDs []string `json:"bucket_ids"` // Limits the reconcile to these buckets, all when empty
+}
@@ -0,0 +1,77 @@
+package schema
+
+// ClusterState is the declarative configuration of the buckets of a cluster
+// and of the WebUI users, exported to and applied from a YAML document.
+type ClusterState struct {
+	Buckets []BucketState `json:"buckets"`
+	Users   []UserState   `json:"users"`
+}
+
+// BucketState identifies a bucket by its first global alias, or by its id
+// when it has none.
+type BucketState struct {
+	Name      string          `json:"name,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Aliases   []string        `json:"aliases,omitempty"` // Other global aliases
+	Quotas    *Quotas         `json:"quotas,omitempty"`
+	Website   *WebsiteConfig  `json:"website,omitempty"` // Website hosting is disabled when nil
+	Lifecycle []LifecycleRule `json:"lifecycle,omitempty"`
+	CORS      []CORSRule      `json:"cors,omitempty"`
+	Grants    []KeyGrant      `json:"grants,omitempty"`
+
+	// Skipped is why the lifecycle and CORS rules could not be read, e.g.
+	// when no key has read and write access. They are left untouched.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// KeyGrant gives an access key permissions on a bucket. The key name is only
+// informative.
+type KeyGrant struct {
+	KeyID   string `json:"key_id"`
+	KeyName string `json:"key_name,omitempty"`
+	Read    bool   `json:"read"`
+	Write   bool   `json:"write"`
+	Owner   bool   `json:"owner"`
+}
+
+// UserState is a WebUI user. The password is only used to create the user,
+// it is never exported.
+type UserState struct {
+	Username          string              `json:"username"`
+	Password          string              `json:"password,omitempty"`
+	Role              UserRole            `json:"role"`
+	BucketPermissions []*BucketPermission `json:"bucket_permissions,omitempty"`
+	BucketAllowance   *BucketAllowance    `json:"bucket_allowance,omitempty"`
+}
+
+type StateAction string
+
+const (
+	StateCreate StateAction = "create"
+	StateUpdate StateAction = "update"
+	StateDelete StateAction = "delete"
+)
+
+// StateChange is a step of a plan, e.g. an update of the quotas of a bucket.
+type StateChange struct {
+	Action StateAction `json:"action"`
+	Kind   string      `json:"kind"` // bucket, alias, quotas, website, lifecycle, cors, grant or user
+	Target string      `json:"target"`
+	Detail string      `json:"detail,omitempty"`
+}
+
+// StatePlan lists the changes bringing the live state to the desired one.
+// It is applied only when confirmed with its id, which changes with the
+// plan.
+type StatePlan struct {
+	ID       string        `json:"id"`
+	Cluster  string        `json:"cluster"`
+	Changes  []StateChange `json:"changes"`
+	Warnings []string      `json:"warnings,omitempty"` // Settings left out of the plan
+}
+
+type StateApplyResult struct {
+	Plan    *StatePlan    `json:"plan"`
+	Applied []StateChange `json:"applied"`
+	Errors  []string      `json:"errors"`
+}
@@ -0,0 +1,43 @@
+package schema
+
+import "time"
+
+// BucketTemplate captures the steps to provision a bucket for an app: the
+// bucket and its alias, an access key, quotas, website access, lifecycle
+// rules and the permissions of WebUI users.
+type BucketTemplate struct {
+	ID              string               `json:"id"`
+	Name            string               `json:"name"`
+	Description     string               `json:"description"`
+	Alias           string               `json:"alias"` // Global alias, "{name}" is replaced by the provisioned name
+	Key             *TemplateKey         `json:"key,omitempty"`
+	Quotas          *UpdateBucketQuotas  `json:"quotas,omitempty"`
+	WebsiteAccess   *UpdateWebsiteAccess `json:"website_access,omitempty"`
+	LifecycleRules  []LifecycleRule      `json:"lifecycle_rules,omitempty"`
+	UserPermissions *BucketPermission    `json:"user_permissions,omitempty"` // Granted to the users given on provisioning, bucket fields are ignored
+	CreatedAt       time.Time            `json:"created_at"`
+	UpdatedAt       time.Time            `json:"updated_at"`
+}
+
+// TemplateKey is the access key created for the provisioned bucket.
+type TemplateKey struct {
+	Name        string      `json:"name"` // "{name}" is replaced by the provisioned name
+	Permissions Permissions `json:"permissions"`
+}
+
+type ProvisionRequest struct {
+	Name  string   `json:"name"`
+	Users []string `json:"users"` // User ids granted the template user permissions
+}
+
+// ProvisionResult is returned once, the secret key is not stored.
+type ProvisionResult struct {
+	Template        string   `json:"template"`
+	Cluster         string   `json:"cluster"`
+	BucketID        string   `json:"bucket_id"`
+	Bucket          string   `json:"bucket"`
+	AccessKeyID     string   `json:"access_key_id,omitempty"`
+	SecretAccessKey string   `json:"secret_access_key,omitempty"`
+	Users           []string `json:"users"`
+	Steps           []string `json:"steps"`
+}
@@ -0,0 +1,37 @@
+package schema
+
+import "time"
+
+// UsagePoint is a usage sample of a bucket, downsampled points hold the
+// average of the samples of their period and the last quotas.
+type UsagePoint struct {
+	Time              time.Time `json:"time"`
+	Bytes             int64     `json:"bytes"`
+	Objects           int64     `json:"objects"`
+	UnfinishedUploads int64     `json:"unfinishedUploads"`
+	UnfinishedBytes   int64     `json:"unfinishedBytes"`
+	MaxSize           int64     `json:"maxSize"`    // 0 without size quota
+	MaxObjects        int64     `json:"maxObjects"` // 0 without objects quota
+	SizeUsage         float64   `json:"sizeUsage"`  // Bytes / MaxSize
+	ObjectsUsage      float64   `json:"objectsUsage"`
+}
+
+type UsageHistory struct {
+	Bucket     string         `json:"bucket"`
+	Resolution string         `json:"resolution"` // "raw", "hour" or "day"
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+	Points     []UsagePoint   `json:"points"`
+	Forecast   *UsageForecast `json:"forecast"`
+}
+
+// UsageForecast extrapolates the size of a bucket with a linear regression
+// over its recent history.
+type UsageForecast struct {
+	Bucket         string     `json:"bucket"`
+	Bytes          int64      `json:"bytes"`
+	MaxSize        int64      `json:"maxSize"`
+	GrowthPerDay   float64    `json:"growthPerDay"`   // Bytes per day
+	QuotaReachedAt *time.Time `json:"quotaReachedAt"` // nil without quota or growth
+	Samples        int        `json:"samples"`
+}
@@ -11,12 +11,31 @@ const (
 
 // BucketPermission defines detailed permissions for a bucket
 type BucketPermission struct {
-	BucketName      string `json:"bucket_name"`
-	Read            bool   `json:"read"`             // View and download files
-	Write           bool   `json:"write"`            // Upload and create files/folders
-	Delete          bool   `json:"delete"`           // Delete files and folders
-	ManageLifecycle bool   `json:"manage_lifecycle"` // Add/edit/delete lifecycle rules
-	DeleteBucket    bool   `json:"delete_bucket"`    // Delete the bucket itself
+	Cluster         string `json:"cluster,omitempty"`   // Cluster name, empty for the default cluster or "*" for every cluster
+	BucketID        string `json:"bucket_id,omitempty"` // Garage bucket id, grants follow the bucket across alias changes
+	BucketName      string `json:"bucket_name"`         // Display alias, or "*" for every bucket
+	Read            bool   `json:"read"`                // View and download files
+	Write           bool   `json:"write"`               // Upload and create files/folders
+	Delete          bool   `json:"delete"`              // Delete files and folders
+	ManageLifecycle bool   `json:"manage_lifecycle"`    // Add/edit/delete lifecycle rules
+	ManageCORS      bool   `json:"manage_cors"`         // Edit/delete the CORS configuration
+	ManageWebsite   bool   `json:"manage_website"`      // Enable/disable website hosting
+	DeleteBucket    bool   `json:"delete_bucket"`       // Delete the bucket itself
+	Owned           bool   `json:"owned,omitempty"`     // Created by the user, counts towards their bucket allowance
+}
+
+// BucketAllowance lets a user create buckets, a zero MaxBuckets disables it.
+type BucketAllowance struct {
+	MaxBuckets   int    `json:"max_buckets"`
+	MaxTotalSize int64  `json:"max_total_size"` // Sum of the size quotas of the created buckets in bytes, 0 for unlimited
+	NamePrefix   string `json:"name_prefix"`    // Required name prefix, "{username}" is replaced by the username
+}
+
+// CreateUserBucketRequest creates a bucket owned by the current user.
+type CreateUserBucketRequest struct {
+	Name       string `json:"name"`
+	MaxSize    int64  `json:"max_size"`    // Size quota in bytes, required when the allowance limits the total size
+	MaxObjects int64  `json:"max_objects"` // Objects quota, 0 for unlimited
 }
 
 type User struct {
@@ -27,6 +46,9 @@ type User struct {
 	CreatedAt         time.Time           `json:"created_at"`
 	UpdatedAt         time.Time           `json:"updated_at"`
 	BucketPermissions []*BucketPermission `json:"bucket_permissions"`
+	AccessKeyID       string              `json:"access_key_id,omitempty"`      // Garage key used to sign S3 requests
+	AccessKeyManaged  bool                `json:"access_key_managed,omitempty"` // Key was provisioned by the WebUI
+	BucketAllowance   *BucketAllowance    `json:"bucket_allowance,omitempty"`
 }
 
 type CreateUserRequest struct {
@@ -34,12 +56,14 @@ type CreateUserRequest struct {
 	Password          string              `json:"password"`
 	Role              UserRole            `json:"role"`
 	BucketPermissions []*BucketPermission `json:"bucket_permissions"`
+	BucketAllowance   *BucketAllowance    `json:"bucket_allowance,omitempty"`
 }
 
 type UpdateUserRequest struct {
 	Password          string              `json:"password,omitempty"`
 	Role              UserRole            `json:"role,omitempty"`
 	BucketPermissions []*BucketPermission `json:"bucket_permissions,omitempty"`
+	BucketAllowance   *BucketAllowance    `json:"bucket_allowance,omitempty"`
 }
 
 type UserResponse struct {
@@ -49,6 +73,9 @@ type UserResponse struct {
 	CreatedAt         time.Time           `json:"created_at"`
 	UpdatedAt         time.Time           `json:"updated_at"`
 	BucketPermissions []*BucketPermission `json:"bucket_permissions"`
+	AccessKeyID       string              `json:"access_key_id"`
+	AccessKeyManaged  bool                `json:"access_key_managed"`
+	BucketAllowance   *BucketAllowance    `json:"bucket_allowance,omitempty"`
 }
 
 func (u *User) ToResponse() *UserResponse {
@@ -59,5 +86,8 @@ func (u *User) ToResponse() *UserResponse {
 		CreatedAt:         u.CreatedAt,
 		UpdatedAt:         u.UpdatedAt,
 		BucketPermissions: u.BucketPermissions,
+		AccessKeyID:       u.AccessKeyID,
+		AccessKeyManaged:  u.AccessKeyManaged,
+		BucketAllowance:   u.BucketAllowance,
 	}
 }
@@ -0,0 +1,16 @@
+package schema
+
+// WebsiteInfo is the website hosting state of a bucket. URLs are the public
+// addresses of the site, one per global alias.
+type WebsiteInfo struct {
+	Enabled       bool     `json:"enabled"`
+	IndexDocument string   `json:"indexDocument"`
+	ErrorDocument string   `json:"errorDocument"`
+	URLs          []string `json:"urls"`
+}
+
+type WebsiteUploadResult struct {
+	Files int      `json:"files"`
+	Bytes int64    `json:"bytes"`
+	Keys  []string `json:"keys"`
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var alertHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+func sendAlertNotification(channel *schema.AlertChannel, n *schema.AlertNotification) error {
+	switch channel.Type {
+	case schema.AlertChannelWebhook:
+		return sendAlertWebhook(channel, n)
+	case schema.AlertChannelSMTP:
+		return sendAlertMail(channel, n)
+	}
+	return fmt.Errorf("invalid channel type %q", channel.Type)
+}
+
+// sendAlertWebhook posts the notification as JSON.
+func sendAlertWebhook(channel *schema.AlertChannel, n *schema.AlertNotification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, channel.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range channel.Headers {
+		req.Header.Set(key, value)
+	}
+
+	res, err := alertHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// sendAlertMail sends the notification as a plain text email. STARTTLS is
+// used when the server supports it, authentication requires TLS unless the
+// server is on localhost.
+func sendAlertMail(channel *schema.AlertChannel, n *schema.AlertNotification) error {
+	var auth smtp.Auth
+	if channel.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", channel.SMTPUsername, channel.SMTPPassword, channel.SMTPHost)
+	}
+
+	addr := net.JoinHostPort(channel.SMTPHost, strconv.Itoa(channel.SMTPPort))
+	return smtp.SendMail(addr, auth, channel.From, channel.To, getAlertMail(channel, n))
+}
+
+func getAlertMail(channel *schema.AlertChannel, n *schema.AlertNotification) []byte {
+	alert := n.Alert
+	subject := fmt.Sprintf("[%s] %s: %s", strings.ToUpper(string(alert.State)), alert.RuleName, alert.Name)
+	if n.Test {
+		subject = "[TEST] " + alert.RuleName
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", stripHeader(channel.From))
+	fmt.Fprintf(&msg, "To: %s\r\n", stripHeader(strings.Join(channel.To, ", ")))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", stripHeader(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+
+	fmt.Fprintf(&msg, "%s\r\n\r\n", alert.Message)
+	fmt.Fprintf(&msg, "Rule: %s\r\n", alert.RuleName)
+	fmt.Fprintf(&msg, "Severity: %s\r\n", alert.Severity)
+	fmt.Fprintf(&msg, "Cluster: %s\r\n", alert.Cluster)
+	fmt.Fprintf(&msg, "State: %s\r\n", alert.State)
+	fmt.Fprintf(&msg, "Started at: %s\r\n", alert.StartedAt.Format(time.RFC3339))
+	if alert.ResolvedAt != nil {
+		fmt.Fprintf(&msg, "Resolved at: %s\r\n", alert.ResolvedAt.Format(time.RFC3339))
+	}
+
+	return msg.Bytes()
+}
+
+// stripHeader prevents header injection from rule or bucket names.
+func stripHeader(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
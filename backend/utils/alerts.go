@@ -0,0 +1,794 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertManager evaluates the alert rules every ALERTS_INTERVAL and notifies
+// their channels when an alert fires or resolves. Rules, channels, silences
+// and alert states are stored in the ALERTS_PATH file.
+type AlertManager struct {
+	mu       sync.Mutex
+	file     string
+	interval time.Duration
+	rules    []*schema.AlertRule
+	channels []*schema.AlertChannel
+	silences []*schema.AlertSilence
+	alerts   map[string]*schema.Alert
+}
+
+type alertsFile struct {
+	Rules    []*schema.AlertRule    `json:"rules"`
+	Channels []*schema.AlertChannel `json:"channels"`
+	Silences []*schema.AlertSilence `json:"silences"`
+	Alerts   []*schema.Alert        `json:"alerts"`
+}
+
+// alertObservation is the value of a rule for a bucket or a cluster, unknown
+// subjects keep their current state.
+type alertObservation struct {
+	subject string
+	name    string
+	value   float64
+	firing  bool
+	unknown bool
+	message string
+}
+
+type alertDelivery struct {
+	alert    schema.Alert
+	channels []*schema.AlertChannel
+}
+
+// Resolved alerts are kept in the history for a week.
+const alertHistoryRetention = 7 * 24 * time.Hour
+
+var (
+	ErrAlertRuleNotFound    = errors.New("alert rule not found")
+	ErrAlertChannelNotFound = errors.New("alert channel not found")
+	ErrAlertSilenceNotFound = errors.New("alert silence not found")
+)
+
+var Alerts *AlertManager
+
+func InitAlertManager() error {
+	interval, err := time.ParseDuration(GetEnv("ALERTS_INTERVAL", "1m"))
+	if err != nil {
+		return err
+	}
+
+	m := &AlertManager{
+		file:     GetEnv("ALERTS_PATH", "alerts.json"),
+		interval: interval,
+		alerts:   make(map[string]*schema.Alert),
+	}
+	if err := m.load(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	Alerts = m
+	go m.run()
+
+	return nil
+}
+
+func (m *AlertManager) load() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := os.ReadFile(m.file)
+	if err != nil {
+		return err
+	}
+
+	var file alertsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+
+	m.rules = file.Rules
+	m.channels = file.Channels
+	m.silences = file.Silences
+	for _, alert := range file.Alerts {
+		m.alerts[alert.ID] = alert
+	}
+	return nil
+}
+
+func (m *AlertManager) save() error {
+	file := alertsFile{
+		Rules:    m.rules,
+		Channels: m.channels,
+		Silences: m.silences,
+		Alerts:   make([]*schema.Alert, 0, len(m.alerts)),
+	}
+	for _, alert := range m.alerts {
+		file.Alerts = append(file.Alerts, alert)
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// The file holds SMTP passwords and webhook headers
+	return os.WriteFile(m.file, data, 0600)
+}
+
+func (m *AlertManager) run() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.Evaluate(context.Background())
+		<-ticker.C
+	}
+}
+
+// Evaluate evaluates every enabled rule and sends the notifications of the
+// alerts which changed state.
+func (m *AlertManager) Evaluate(ctx context.Context) {
+	m.mu.Lock()
+	rules := slices.Clone(m.rules)
+	m.mu.Unlock()
+
+	snapshots := map[string]*alertSnapshot{}
+	var deliveries []alertDelivery
+	now := time.Now()
+
+	for _, rule := range rules {
+		if rule.Disabled {
+			continue
+		}
+
+		for _, cluster := range getAlertRuleClusters(rule) {
+			snapshot := snapshots[cluster.Name]
+			if snapshot == nil {
+				snapshot = &alertSnapshot{cluster: cluster}
+				snapshots[cluster.Name] = snapshot
+			}
+
+			observations, err := snapshot.evaluate(ctx, rule)
+			if err != nil {
+				log.Printf("Alerts: cannot evaluate rule %s on cluster %s: %v", rule.Name, cluster.Name, err)
+				continue
+			}
+			deliveries = append(deliveries, m.update(rule, cluster, observations, now)...)
+		}
+	}
+
+	m.mu.Lock()
+	m.prune(now)
+	if err := m.save(); err != nil {
+		log.Println("Alerts: cannot save alerts:", err)
+	}
+	m.mu.Unlock()
+
+	for _, delivery := range deliveries {
+		go delivery.send()
+	}
+}
+
+// update applies the observations of a rule on a cluster and returns the
+// notifications to send. Alerts of subjects which disappeared are resolved.
+func (m *AlertManager) update(rule *schema.AlertRule, cluster *garage, observations []alertObservation, now time.Time) []alertDelivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The rule may have been deleted during the evaluation
+	if m.getRule(rule.ID) == nil {
+		return nil
+	}
+
+	var res []alertDelivery
+	notify := func(alert *schema.Alert) {
+		alert.Silenced = m.isSilenced(alert, now)
+		if alert.Silenced {
+			return
+		}
+		if channels := m.getRuleChannels(rule); len(channels) > 0 {
+			res = append(res, alertDelivery{alert: *alert, channels: channels})
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, obs := range observations {
+		id := getAlertID(rule.ID, cluster.Name, obs.subject)
+		seen[id] = true
+		if obs.unknown {
+			continue
+		}
+
+		alert := m.alerts[id]
+		firing := alert != nil && alert.State == schema.AlertFiring
+
+		switch {
+		case obs.firing && firing:
+			alert.Value = obs.value
+			alert.Message = obs.message
+			alert.Silenced = m.isSilenced(alert, now)
+		case obs.firing:
+			alert = &schema.Alert{
+				ID:        id,
+				RuleID:    rule.ID,
+				RuleName:  rule.Name,
+				Type:      rule.Type,
+				Severity:  rule.Severity,
+				Cluster:   cluster.Name,
+				Subject:   obs.subject,
+				Name:      obs.name,
+				State:     schema.AlertFiring,
+				Value:     obs.value,
+				Threshold: rule.Threshold,
+				Message:   obs.message,
+				StartedAt: now,
+			}
+			m.alerts[id] = alert
+			notify(alert)
+		case firing:
+			alert.Value = obs.value
+			alert.Message = obs.message
+			alert.State = schema.AlertResolved
+			alert.ResolvedAt = &now
+			notify(alert)
+		}
+	}
+
+	for id, alert := range m.alerts {
+		if alert.RuleID != rule.ID || alert.Cluster != cluster.Name || alert.State != schema.AlertFiring || seen[id] {
+			continue
+		}
+		alert.State = schema.AlertResolved
+		alert.ResolvedAt = &now
+		alert.Message = fmt.Sprintf("%s is gone", alert.Name)
+		notify(alert)
+	}
+
+	return res
+}
+
+// prune drops the expired silences and the old resolved alerts.
+func (m *AlertManager) prune(now time.Time) {
+	m.silences = slices.DeleteFunc(m.silences, func(s *schema.AlertSilence) bool {
+		return !now.Before(s.EndsAt)
+	})
+
+	for id, alert := range m.alerts {
+		if alert.ResolvedAt != nil && now.Sub(*alert.ResolvedAt) > alertHistoryRetention {
+			delete(m.alerts, id)
+		}
+	}
+}
+
+func (m *AlertManager) isSilenced(alert *schema.Alert, now time.Time) bool {
+	for _, s := range m.silences {
+		if now.Before(s.EndsAt) &&
+			(s.RuleID == "" || s.RuleID == alert.RuleID) &&
+			(s.Cluster == "" || s.Cluster == alert.Cluster) &&
+			(s.Subject == "" || s.Subject == alert.Subject || s.Subject == alert.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *AlertManager) refreshSilenced() {
+	now := time.Now()
+	for _, alert := range m.alerts {
+		if alert.State == schema.AlertFiring {
+			alert.Silenced = m.isSilenced(alert, now)
+		}
+	}
+}
+
+// GetAlerts returns the alerts, most recent first, optionally filtered by
+// state.
+func (m *AlertManager) GetAlerts(state schema.AlertState) []*schema.Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make([]*schema.Alert, 0, len(m.alerts))
+	for _, alert := range m.alerts {
+		if state == "" || alert.State == state {
+			a := *alert
+			res = append(res, &a)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].StartedAt.After(res[j].StartedAt)
+	})
+	return res
+}
+
+func (m *AlertManager) GetRules() []*schema.AlertRule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.rules)
+}
+
+func (m *AlertManager) CreateRule(rule *schema.AlertRule) (*schema.AlertRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.validateRule(rule); err != nil {
+		return nil, err
+	}
+
+	id, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+	rule.ID = id
+	m.rules = append(m.rules, rule)
+
+	return rule, m.save()
+}
+
+func (m *AlertManager) UpdateRule(id string, rule *schema.AlertRule) (*schema.AlertRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.rules, func(r *schema.AlertRule) bool { return r.ID == id })
+	if i < 0 {
+		return nil, ErrAlertRuleNotFound
+	}
+	if err := m.validateRule(rule); err != nil {
+		return nil, err
+	}
+
+	// Alerts of the previous definition are dropped, the next evaluation
+	// fires them again if needed.
+	rule.ID = id
+	m.rules[i] = rule
+	m.deleteRuleAlerts(id)
+
+	return rule, m.save()
+}
+
+func (m *AlertManager) DeleteRule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.rules, func(r *schema.AlertRule) bool { return r.ID == id })
+	if i < 0 {
+		return ErrAlertRuleNotFound
+	}
+	m.rules = slices.Delete(m.rules, i, i+1)
+	m.deleteRuleAlerts(id)
+
+	return m.save()
+}
+
+func (m *AlertManager) deleteRuleAlerts(ruleID string) {
+	for id, alert := range m.alerts {
+		if alert.RuleID == ruleID {
+			delete(m.alerts, id)
+		}
+	}
+}
+
+func (m *AlertManager) validateRule(rule *schema.AlertRule) error {
+	if rule.Name == "" {
+		return errors.New("rule name is required")
+	}
+
+	switch rule.Type {
+	case schema.AlertBucketSize, schema.AlertBucketObjects, schema.AlertClusterCapacity:
+		if rule.Threshold <= 0 || rule.Threshold > 100 {
+			return errors.New("threshold must be a percentage between 0 and 100")
+		}
+	case schema.AlertStaleUploads:
+		if rule.Threshold <= 0 {
+			return errors.New("threshold must be a positive number of bytes")
+		}
+	case schema.AlertUnhealthyNodes:
+		if rule.Threshold == 0 {
+			rule.Threshold = 1
+		}
+		if rule.Threshold < 0 {
+			return errors.New("threshold must be a positive number of nodes")
+		}
+	default:
+		return fmt.Errorf("invalid rule type %q", rule.Type)
+	}
+
+	if !isBucketAlertRule(rule) && rule.BucketID != "" {
+		return errors.New("bucket_id is only allowed on bucket rules")
+	}
+
+	switch rule.Severity {
+	case "":
+		rule.Severity = "warning"
+	case "warning", "critical":
+	default:
+		return fmt.Errorf("invalid severity %q", rule.Severity)
+	}
+
+	if rule.Cluster != "*" {
+		cluster, err := Clusters.Get(rule.Cluster)
+		if err != nil {
+			return err
+		}
+		if cluster.IsDefault() {
+			rule.Cluster = ""
+		}
+	}
+
+	if rule.Channels == nil {
+		rule.Channels = []string{}
+	}
+	for _, id := range rule.Channels {
+		if m.getChannel(id) == nil {
+			return fmt.Errorf("unknown channel %q", id)
+		}
+	}
+
+	return nil
+}
+
+func (m *AlertManager) getRule(id string) *schema.AlertRule {
+	for _, rule := range m.rules {
+		if rule.ID == id {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (m *AlertManager) getRuleChannels(rule *schema.AlertRule) []*schema.AlertChannel {
+	var res []*schema.AlertChannel
+	for _, id := range rule.Channels {
+		if channel := m.getChannel(id); channel != nil {
+			res = append(res, channel)
+		}
+	}
+	return res
+}
+
+// GetChannels returns the channels without their SMTP password.
+func (m *AlertManager) GetChannels() []*schema.AlertChannel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make([]*schema.AlertChannel, 0, len(m.channels))
+	for _, channel := range m.channels {
+		res = append(res, channel.WithoutSecrets())
+	}
+	return res
+}
+
+func (m *AlertManager) CreateChannel(channel *schema.AlertChannel) (*schema.AlertChannel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := validateAlertChannel(channel); err != nil {
+		return nil, err
+	}
+
+	id, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+	channel.ID = id
+	m.channels = append(m.channels, channel)
+
+	return channel.WithoutSecrets(), m.save()
+}
+
+// UpdateChannel replaces a channel, an empty SMTP password keeps the current
+// one.
+func (m *AlertManager) UpdateChannel(id string, channel *schema.AlertChannel) (*schema.AlertChannel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.channels, func(c *schema.AlertChannel) bool { return c.ID == id })
+	if i < 0 {
+		return nil, ErrAlertChannelNotFound
+	}
+	if err := validateAlertChannel(channel); err != nil {
+		return nil, err
+	}
+
+	if channel.SMTPPassword == "" && channel.Type == m.channels[i].Type {
+		channel.SMTPPassword = m.channels[i].SMTPPassword
+	}
+	channel.ID = id
+	m.channels[i] = channel
+
+	return channel.WithoutSecrets(), m.save()
+}
+
+// DeleteChannel deletes a channel and removes it from the rules.
+func (m *AlertManager) DeleteChannel(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.channels, func(c *schema.AlertChannel) bool { return c.ID == id })
+	if i < 0 {
+		return ErrAlertChannelNotFound
+	}
+	m.channels = slices.Delete(m.channels, i, i+1)
+
+	for _, rule := range m.rules {
+		rule.Channels = slices.DeleteFunc(rule.Channels, func(c string) bool { return c == id })
+	}
+
+	return m.save()
+}
+
+// TestChannel sends a test notification to a channel.
+func (m *AlertManager) TestChannel(id string) error {
+	m.mu.Lock()
+	channel := m.getChannel(id)
+	m.mu.Unlock()
+
+	if channel == nil {
+		return ErrAlertChannelNotFound
+	}
+
+	alert := &schema.Alert{
+		ID:        "test",
+		RuleName:  "Test notification",
+		Severity:  "warning",
+		Cluster:   Garage.Name,
+		Subject:   Garage.Name,
+		Name:      Garage.Name,
+		State:     schema.AlertFiring,
+		Message:   "This is a test notification from Garage Web UI",
+		StartedAt: time.Now(),
+	}
+	return sendAlertNotification(channel, &schema.AlertNotification{Alert: alert, Test: true, Time: time.Now()})
+}
+
+func (m *AlertManager) getChannel(id string) *schema.AlertChannel {
+	for _, channel := range m.channels {
+		if channel.ID == id {
+			return channel
+		}
+	}
+	return nil
+}
+
+func validateAlertChannel(channel *schema.AlertChannel) error {
+	if channel.Name == "" {
+		return errors.New("channel name is required")
+	}
+
+	switch channel.Type {
+	case schema.AlertChannelWebhook:
+		if !strings.HasPrefix(channel.URL, "http://") && !strings.HasPrefix(channel.URL, "https://") {
+			return errors.New("webhook url must be an http or https url")
+		}
+	case schema.AlertChannelSMTP:
+		if channel.SMTPHost == "" || channel.From == "" || len(channel.To) == 0 {
+			return errors.New("smtp_host, from and to are required")
+		}
+		if channel.SMTPPort == 0 {
+			channel.SMTPPort = 25
+		}
+	default:
+		return fmt.Errorf("invalid channel type %q", channel.Type)
+	}
+
+	return nil
+}
+
+// GetSilences returns the active silences.
+func (m *AlertManager) GetSilences() []*schema.AlertSilence {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	res := []*schema.AlertSilence{}
+	for _, s := range m.silences {
+		if now.Before(s.EndsAt) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func (m *AlertManager) CreateSilence(silence *schema.AlertSilence, createdBy string) (*schema.AlertSilence, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !silence.EndsAt.After(time.Now()) {
+		return nil, errors.New("ends_at must be in the future")
+	}
+	if silence.RuleID != "" && m.getRule(silence.RuleID) == nil {
+		return nil, fmt.Errorf("unknown rule %q", silence.RuleID)
+	}
+
+	id, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+	silence.ID = id
+	silence.CreatedBy = createdBy
+	silence.CreatedAt = time.Now()
+	m.silences = append(m.silences, silence)
+	m.refreshSilenced()
+
+	return silence, m.save()
+}
+
+func (m *AlertManager) DeleteSilence(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.silences, func(s *schema.AlertSilence) bool { return s.ID == id })
+	if i < 0 {
+		return ErrAlertSilenceNotFound
+	}
+	m.silences = slices.Delete(m.silences, i, i+1)
+	m.refreshSilenced()
+
+	return m.save()
+}
+
+func (d *alertDelivery) send() {
+	n := &schema.AlertNotification{Alert: &d.alert, Time: time.Now()}
+	for _, channel := range d.channels {
+		if err := sendAlertNotification(channel, n); err != nil {
+			log.Printf("Alerts: cannot notify channel %s: %v", channel.Name, err)
+		}
+	}
+}
+
+func getAlertID(ruleID, cluster, subject string) string {
+	return ruleID + "/" + cluster + "/" + subject
+}
+
+func getAlertRuleClusters(rule *schema.AlertRule) []*garage {
+	if rule.Cluster == "*" {
+		return Clusters.List()
+	}
+	cluster, err := Clusters.Get(rule.Cluster)
+	if err != nil {
+		return nil
+	}
+	return []*garage{cluster}
+}
+
+func isBucketAlertRule(rule *schema.AlertRule) bool {
+	switch rule.Type {
+	case schema.AlertBucketSize, schema.AlertBucketObjects, schema.AlertStaleUploads:
+		return true
+	}
+	return false
+}
+
+// alertSnapshot fetches the data of a cluster once per evaluation.
+type alertSnapshot struct {
+	cluster *garage
+	buckets []schema.Bucket
+	health  *schema.ClusterHealth
+	status  *schema.ClusterStatus
+}
+
+func (s *alertSnapshot) getBuckets(ctx context.Context) ([]schema.Bucket, error) {
+	if s.buckets == nil {
+		list, _, err := s.cluster.BucketList().List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.buckets, _ = s.cluster.BucketList().Details(ctx, list)
+	}
+	return s.buckets, nil
+}
+
+func (s *alertSnapshot) evaluate(ctx context.Context, rule *schema.AlertRule) ([]alertObservation, error) {
+	if isBucketAlertRule(rule) {
+		buckets, err := s.getBuckets(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var res []alertObservation
+		for _, bucket := range buckets {
+			if rule.BucketID != "" && bucket.ID != rule.BucketID {
+				continue
+			}
+			if obs, ok := evaluateBucketAlert(rule, &bucket); ok {
+				res = append(res, obs)
+			}
+		}
+		return res, nil
+	}
+
+	switch rule.Type {
+	case schema.AlertClusterCapacity:
+		if s.status == nil {
+			status, err := s.cluster.Client().GetClusterStatus(ctx)
+			if err != nil {
+				return nil, err
+			}
+			s.status = status
+		}
+
+		var available, total int64
+		for _, node := range s.status.Nodes {
+			if node.Role != nil && node.DataPartition != nil {
+				available += node.DataPartition.Available
+				total += node.DataPartition.Total
+			}
+		}
+		if total == 0 {
+			return nil, nil
+		}
+
+		free := float64(available) / float64(total) * 100
+		return []alertObservation{{
+			subject: s.cluster.Name,
+			name:    s.cluster.Name,
+			value:   free,
+			firing:  free <= rule.Threshold,
+			message: fmt.Sprintf("Cluster %s has %.1f%% free data capacity (%d of %d bytes)", s.cluster.Name, free, available, total),
+		}}, nil
+
+	case schema.AlertUnhealthyNodes:
+		if s.health == nil {
+			health, err := s.cluster.Client().GetClusterHealth(ctx)
+			if err != nil {
+				return nil, err
+			}
+			s.health = health
+		}
+
+		down := max(s.health.KnownNodes-s.health.ConnectedNodes, s.health.StorageNodes-s.health.StorageNodesUp)
+		return []alertObservation{{
+			subject: s.cluster.Name,
+			name:    s.cluster.Name,
+			value:   float64(down),
+			firing:  float64(down) >= rule.Threshold,
+			message: fmt.Sprintf("Cluster %s is %s, %d node(s) down", s.cluster.Name, s.health.Status, down),
+		}}, nil
+	}
+
+	return nil, fmt.Errorf("invalid rule type %q", rule.Type)
+}
+
+// evaluateBucketAlert returns the observation of a bucket rule, buckets
+// without the relevant quota are not observed.
+func evaluateBucketAlert(rule *schema.AlertRule, bucket *schema.Bucket) (alertObservation, bool) {
+	name := GetBucketDisplayName(bucket)
+	obs := alertObservation{subject: bucket.ID, name: name}
+
+	// Details which could not be fetched only have the bucket aliases
+	if bucket.Created == "" {
+		obs.unknown = true
+		return obs, true
+	}
+
+	switch rule.Type {
+	case schema.AlertBucketSize:
+		if bucket.Quotas.MaxSize <= 0 {
+			return obs, false
+		}
+		obs.value = float64(bucket.Bytes) / float64(bucket.Quotas.MaxSize) * 100
+		obs.message = fmt.Sprintf("Bucket %s uses %.1f%% of its size quota (%d of %d bytes)", name, obs.value, bucket.Bytes, bucket.Quotas.MaxSize)
+	case schema.AlertBucketObjects:
+		if bucket.Quotas.MaxObjects <= 0 {
+			return obs, false
+		}
+		obs.value = float64(bucket.Objects) / float64(bucket.Quotas.MaxObjects) * 100
+		obs.message = fmt.Sprintf("Bucket %s uses %.1f%% of its objects quota (%d of %d objects)", name, obs.value, bucket.Objects, bucket.Quotas.MaxObjects)
+	case schema.AlertStaleUploads:
+		obs.value = float64(bucket.UnfinishedMultipartUploadBytes)
+		obs.message = fmt.Sprintf("Bucket %s has %d bytes of unfinished multipart uploads", name, bucket.UnfinishedMultipartUploadBytes)
+	}
+
+	obs.firing = obs.value >= rule.Threshold
+	return obs, true
+}
@@ -0,0 +1,351 @@
+package utils
+
+import (
+	"bufio"
+	"khairul169/garage-webui/schema"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpStandIn is a minimal in-process SMTP server collecting the mails it
+// receives, without STARTTLS nor authentication.
+type smtpStandIn struct {
+	listener net.Listener
+	mails    chan smtpMail
+}
+
+type smtpMail struct {
+	From string
+	To   []string
+	Data string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{listener: listener, mails: make(chan smtpMail, 16)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP stand-in")
+	var mail smtpMail
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			mail = smtpMail{From: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			mail.To = append(mail.To, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			mail.Data = data.String()
+			s.mails <- mail
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// next returns the next received mail, or fails after a timeout.
+func (s *smtpStandIn) next(t *testing.T) smtpMail {
+	t.Helper()
+	select {
+	case mail := <-s.mails:
+		return mail
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+		return smtpMail{}
+	}
+}
+
+// expectNone checks that no mail is pending.
+func (s *smtpStandIn) expectNone(t *testing.T) {
+	t.Helper()
+	select {
+	case mail := <-s.mails:
+		t.Fatalf("unexpected mail: %s", mail.Data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func newTestAlertManager(t *testing.T, smtpPort int) (*AlertManager, *schema.AlertRule) {
+	rule := &schema.AlertRule{
+		ID:        "r1",
+		Name:      "Bucket almost full",
+		Type:      schema.AlertBucketSize,
+		Threshold: 90,
+		Severity:  "warning",
+		Channels:  []string{"c1"},
+	}
+	m := &AlertManager{
+		file:   filepath.Join(t.TempDir(), "alerts.json"),
+		alerts: map[string]*schema.Alert{},
+		rules:  []*schema.AlertRule{rule},
+		channels: []*schema.AlertChannel{{
+			ID:       "c1",
+			Name:     "ops mail",
+			Type:     schema.AlertChannelSMTP,
+			SMTPHost: "127.0.0.1",
+			SMTPPort: smtpPort,
+			From:     "garage@example.com",
+			To:       []string{"ops@example.com", "oncall@example.com"},
+		}},
+	}
+	return m, rule
+}
+
+func bucketObservation(firing bool, value float64) alertObservation {
+	return alertObservation{
+		subject: "b1",
+		name:    "photos",
+		value:   value,
+		firing:  firing,
+		message: "photos uses " + strconv.FormatFloat(value, 'f', 0, 64) + "% of its quota",
+	}
+}
+
+// evaluate applies the observations and sends the notifications.
+func evaluate(m *AlertManager, rule *schema.AlertRule, now time.Time, observations ...alertObservation) int {
+	deliveries := m.update(rule, &garage{Name: "test"}, observations, now)
+	for _, d := range deliveries {
+		d.send()
+	}
+	return len(deliveries)
+}
+
+func getMailHeader(t *testing.T, mail smtpMail, name string) string {
+	t.Helper()
+	for _, line := range strings.Split(mail.Data, "\r\n") {
+		if line == "" {
+			break
+		}
+		if value, ok := strings.CutPrefix(line, name+": "); ok {
+			return value
+		}
+	}
+	t.Fatalf("no %s header in %q", name, mail.Data)
+	return ""
+}
+
+func TestAlertMailFireAndResolve(t *testing.T) {
+	smtp := newSMTPStandIn(t)
+	m, rule := newTestAlertManager(t, smtp.port())
+	now := time.Now()
+
+	if n := evaluate(m, rule, now, bucketObservation(true, 95)); n != 1 {
+		t.Fatalf("%d notifications on fire, want 1", n)
+	}
+	mail := smtp.next(t)
+	if mail.From != "garage@example.com" || strings.Join(mail.To, ",") != "ops@example.com,oncall@example.com" {
+		t.Errorf("envelope = %s -> %v", mail.From, mail.To)
+	}
+	if got := getMailHeader(t, mail, "Subject"); got != "[FIRING] Bucket almost full: photos" {
+		t.Errorf("Subject = %q", got)
+	}
+	if !strings.Contains(mail.Data, "photos uses 95% of its quota") || !strings.Contains(mail.Data, "Cluster: test") {
+		t.Errorf("body = %q", mail.Data)
+	}
+
+	// Still firing, the alert is updated without a new notification
+	if n := evaluate(m, rule, now.Add(time.Minute), bucketObservation(true, 97)); n != 0 {
+		t.Fatalf("%d notifications while firing, want 0", n)
+	}
+	smtp.expectNone(t)
+	if alert := m.alerts[getAlertID("r1", "test", "b1")]; alert.Value != 97 || !alert.StartedAt.Equal(now) {
+		t.Errorf("alert = %+v", alert)
+	}
+
+	// An unknown value keeps the state
+	unknown := bucketObservation(false, 0)
+	unknown.unknown = true
+	if n := evaluate(m, rule, now.Add(2*time.Minute), unknown); n != 0 {
+		t.Fatalf("%d notifications on an unknown value, want 0", n)
+	}
+
+	if n := evaluate(m, rule, now.Add(3*time.Minute), bucketObservation(false, 50)); n != 1 {
+		t.Fatalf("%d notifications on resolve, want 1", n)
+	}
+	mail = smtp.next(t)
+	if got := getMailHeader(t, mail, "Subject"); got != "[RESOLVED] Bucket almost full: photos" {
+		t.Errorf("Subject = %q", got)
+	}
+	if !strings.Contains(mail.Data, "Resolved at: ") {
+		t.Errorf("body = %q", mail.Data)
+	}
+
+	if n := evaluate(m, rule, now.Add(4*time.Minute), bucketObservation(false, 40)); n != 0 {
+		t.Fatalf("%d notifications once resolved, want 0", n)
+	}
+	smtp.expectNone(t)
+
+	// Firing again opens a new alert
+	if n := evaluate(m, rule, now.Add(5*time.Minute), bucketObservation(true, 99)); n != 1 {
+		t.Fatalf("%d notifications on a new fire, want 1", n)
+	}
+	smtp.next(t)
+}
+
+func TestAlertResolvedWhenSubjectIsGone(t *testing.T) {
+	smtp := newSMTPStandIn(t)
+	m, rule := newTestAlertManager(t, smtp.port())
+	now := time.Now()
+
+	evaluate(m, rule, now, bucketObservation(true, 95))
+	smtp.next(t)
+
+	if n := evaluate(m, rule, now.Add(time.Minute)); n != 1 {
+		t.Fatalf("%d notifications, want 1", n)
+	}
+	mail := smtp.next(t)
+	if got := getMailHeader(t, mail, "Subject"); got != "[RESOLVED] Bucket almost full: photos" {
+		t.Errorf("Subject = %q", got)
+	}
+	if !strings.Contains(mail.Data, "photos is gone") {
+		t.Errorf("body = %q", mail.Data)
+	}
+}
+
+func TestAlertSilence(t *testing.T) {
+	smtp := newSMTPStandIn(t)
+	m, rule := newTestAlertManager(t, smtp.port())
+	now := time.Now()
+
+	// A silence of another bucket doesn't match
+	_, err := m.CreateSilence(&schema.AlertSilence{RuleID: "r1", Subject: "other", EndsAt: now.Add(time.Hour)}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	silence, err := m.CreateSilence(&schema.AlertSilence{RuleID: "r1", Subject: "photos", EndsAt: now.Add(time.Hour)}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := evaluate(m, rule, now, bucketObservation(true, 95)); n != 0 {
+		t.Fatalf("%d notifications while silenced, want 0", n)
+	}
+	smtp.expectNone(t)
+	alert := m.alerts[getAlertID("r1", "test", "b1")]
+	if alert == nil || alert.State != schema.AlertFiring || !alert.Silenced {
+		t.Fatalf("alert = %+v", alert)
+	}
+
+	if err := m.DeleteSilence(silence.ID); err != nil {
+		t.Fatal(err)
+	}
+	if alert.Silenced {
+		t.Error("alert still silenced once the silence is deleted")
+	}
+
+	// The fire happened while silenced, only the resolve is notified
+	if n := evaluate(m, rule, now.Add(time.Minute), bucketObservation(true, 96)); n != 0 {
+		t.Fatalf("%d notifications while firing, want 0", n)
+	}
+	if n := evaluate(m, rule, now.Add(2*time.Minute), bucketObservation(false, 10)); n != 1 {
+		t.Fatalf("%d notifications on resolve, want 1", n)
+	}
+	smtp.next(t)
+}
+
+func TestAlertSilenceExpires(t *testing.T) {
+	smtp := newSMTPStandIn(t)
+	m, rule := newTestAlertManager(t, smtp.port())
+	now := time.Now()
+
+	if _, err := m.CreateSilence(&schema.AlertSilence{Cluster: "test", EndsAt: now.Add(time.Minute)}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	evaluate(m, rule, now, bucketObservation(true, 95))
+	smtp.expectNone(t)
+
+	// Evaluated after the end of the silence
+	later := now.Add(2 * time.Minute)
+	evaluate(m, rule, later, bucketObservation(false, 10))
+	smtp.next(t)
+
+	m.prune(later)
+	if len(m.silences) != 0 {
+		t.Errorf("expired silences were kept: %+v", m.silences)
+	}
+}
+
+func TestAlertTestChannel(t *testing.T) {
+	smtp := newSMTPStandIn(t)
+	m, _ := newTestAlertManager(t, smtp.port())
+
+	if err := m.TestChannel("c1"); err != nil {
+		t.Fatal(err)
+	}
+	mail := smtp.next(t)
+	if got := getMailHeader(t, mail, "Subject"); got != "[TEST] Test notification" {
+		t.Errorf("Subject = %q", got)
+	}
+
+	if err := m.TestChannel("unknown"); err != ErrAlertChannelNotFound {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestAlertMailHeaderInjection(t *testing.T) {
+	smtp := newSMTPStandIn(t)
+	m, rule := newTestAlertManager(t, smtp.port())
+	rule.Name = "Full\r\nBcc: attacker@example.com"
+
+	evaluate(m, rule, time.Now(), bucketObservation(true, 95))
+	mail := smtp.next(t)
+	header, _, _ := strings.Cut(mail.Data, "\r\n\r\n")
+	if strings.Contains(header, "\r\nBcc:") {
+		t.Errorf("header injected: %q", header)
+	}
+}
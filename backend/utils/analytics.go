@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"container/heap"
+	"context"
+	"khairul169/garage-webui/schema"
+	"log"
+	"mime"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const analyticsTopN = 20
+
+var (
+	analyticsSizeBounds = []int64{1 << 10, 64 << 10, 1 << 20, 16 << 20, 128 << 20, 1 << 30}
+	analyticsSizeLabels = []string{"< 1 KiB", "1 KiB - 64 KiB", "64 KiB - 1 MiB", "1 MiB - 16 MiB", "16 MiB - 128 MiB", "128 MiB - 1 GiB", ">= 1 GiB"}
+	analyticsAgeBounds  = []int64{1, 7, 30, 90, 365} // days
+	analyticsAgeLabels  = []string{"< 1 day", "1 - 7 days", "7 - 30 days", "30 - 90 days", "90 - 365 days", ">= 1 year"}
+)
+
+type analyticsEntry struct {
+	result    *schema.BucketAnalytics // Last completed scan
+	running   bool
+	startedAt time.Time
+}
+
+type analyticsManager struct {
+	mu      sync.Mutex
+	entries map[string]*analyticsEntry
+}
+
+var Analytics = &analyticsManager{entries: map[string]*analyticsEntry{}}
+
+// Get returns the last computed analytics of a bucket prefix. A new scan is
+// started in the background when there is no result yet, when it is older
+// than ANALYTICS_TTL, or when refresh is requested.
+func (a *analyticsManager) Get(cluster *garage, bucket string, prefix string, refresh bool) schema.BucketAnalytics {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cacheKey := cluster.Name + "/" + bucket + "/" + prefix
+	entry := a.entries[cacheKey]
+	if entry == nil {
+		entry = &analyticsEntry{}
+		a.entries[cacheKey] = entry
+	}
+
+	ttl, err := time.ParseDuration(GetEnv("ANALYTICS_TTL", "6h"))
+	if err != nil {
+		ttl = 6 * time.Hour
+	}
+	stale := entry.result == nil || time.Since(*entry.result.CompletedAt) > ttl
+
+	if !entry.running && (stale || refresh) {
+		entry.running = true
+		entry.startedAt = time.Now()
+		go a.run(cacheKey, cluster, bucket, prefix, entry.startedAt)
+	}
+
+	result := schema.BucketAnalytics{Bucket: bucket, Prefix: prefix}
+	if entry.result != nil {
+		result = *entry.result
+	}
+	result.Running = entry.running
+	if entry.running {
+		result.StartedAt = &entry.startedAt
+	}
+
+	return result
+}
+
+func (a *analyticsManager) run(cacheKey string, cluster *garage, bucket string, prefix string, startedAt time.Time) {
+	result, err := scanBucketAnalytics(cluster, bucket, prefix)
+	if err != nil {
+		log.Printf("Analytics: cannot scan bucket %s: %v", bucket, err)
+		result = &schema.BucketAnalytics{Bucket: bucket, Prefix: prefix, Error: err.Error()}
+	}
+
+	completedAt := time.Now()
+	result.StartedAt = &startedAt
+	result.CompletedAt = &completedAt
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry := a.entries[cacheKey]
+	entry.running = false
+	entry.result = result
+}
+
+func scanBucketAnalytics(cluster *garage, bucket string, prefix string) (*schema.BucketAnalytics, error) {
+	client, err := cluster.NewS3Client(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &schema.BucketAnalytics{
+		Bucket:        bucket,
+		Prefix:        prefix,
+		SizeHistogram: newHistogram(analyticsSizeBounds, analyticsSizeLabels, 1),
+		AgeHistogram:  newHistogram(analyticsAgeBounds, analyticsAgeLabels, 24*60*60),
+	}
+
+	prefixes := map[string]*schema.AnalyticsGroup{}
+	extensions := map[string]*schema.AnalyticsGroup{}
+	contentTypes := map[string]*schema.AnalyticsGroup{}
+	largest := &largestObjects{}
+	now := time.Now()
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(client.Name),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			size := aws.ToInt64(object.Size)
+			modified := aws.ToTime(object.LastModified)
+
+			result.Objects++
+			result.Bytes += size
+
+			child := ""
+			if segment, _, found := strings.Cut(strings.TrimPrefix(key, prefix), "/"); found {
+				child = prefix + segment + "/"
+			}
+			ext := strings.ToLower(path.Ext(key))
+			contentType, _, _ := strings.Cut(mime.TypeByExtension(ext), ";")
+
+			addToGroup(prefixes, child, size)
+			addToGroup(extensions, ext, size)
+			addToGroup(contentTypes, contentType, size)
+			addToHistogram(result.SizeHistogram, size, size)
+			addToHistogram(result.AgeHistogram, int64(now.Sub(modified).Seconds()), size)
+
+			heap.Push(largest, schema.IndexedObject{
+				Key:          key,
+				Size:         size,
+				ETag:         aws.ToString(object.ETag),
+				LastModified: modified,
+				ContentType:  contentType,
+			})
+			if largest.Len() > analyticsTopN {
+				heap.Pop(largest)
+			}
+		}
+	}
+
+	result.Prefixes = sortGroups(prefixes)
+	result.Extensions = sortGroups(extensions)
+	result.ContentTypes = sortGroups(contentTypes)
+
+	result.Largest = make([]schema.IndexedObject, largest.Len())
+	for i := len(result.Largest) - 1; i >= 0; i-- {
+		result.Largest[i] = heap.Pop(largest).(schema.IndexedObject)
+	}
+
+	return result, nil
+}
+
+func addToGroup(groups map[string]*schema.AnalyticsGroup, name string, size int64) {
+	group := groups[name]
+	if group == nil {
+		group = &schema.AnalyticsGroup{Name: name}
+		groups[name] = group
+	}
+	group.Objects++
+	group.Bytes += size
+}
+
+// sortGroups returns the groups ordered by total size, largest first.
+func sortGroups(groups map[string]*schema.AnalyticsGroup) []schema.AnalyticsGroup {
+	res := make([]schema.AnalyticsGroup, 0, len(groups))
+	for _, group := range groups {
+		res = append(res, *group)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Bytes == res[j].Bytes {
+			return res[i].Name < res[j].Name
+		}
+		return res[i].Bytes > res[j].Bytes
+	})
+	return res
+}
+
+func newHistogram(bounds []int64, labels []string, unit int64) []schema.AnalyticsHistogram {
+	res := make([]schema.AnalyticsHistogram, len(labels))
+	for i := range res {
+		res[i].Label = labels[i]
+		if i > 0 {
+			res[i].Min = bounds[i-1] * unit
+		}
+		if i < len(bounds) {
+			max := bounds[i] * unit
+			res[i].Max = &max
+		}
+	}
+	return res
+}
+
+func addToHistogram(histogram []schema.AnalyticsHistogram, value int64, size int64) {
+	for i := range histogram {
+		if histogram[i].Max == nil || value < *histogram[i].Max {
+			histogram[i].Objects++
+			histogram[i].Bytes += size
+			return
+		}
+	}
+}
+
+// largestObjects is a min-heap on the object size, holding the top N objects.
+type largestObjects []schema.IndexedObject
+
+func (h largestObjects) Len() int           { return len(h) }
+func (h largestObjects) Less(i, j int) bool { return h[i].Size < h[j].Size }
+func (h largestObjects) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *largestObjects) Push(x any)        { *h = append(*h, x.(schema.IndexedObject)) }
+func (h *largestObjects) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
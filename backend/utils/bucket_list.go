@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"context"
+	"khairul169/garage-webui/schema"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BucketListCache caches the bucket list of a cluster and the details of
+// each bucket. Entries older than BUCKET_LIST_TTL are still served, and
+// refreshed in the background, until BUCKET_LIST_MAX_STALE.
+type BucketListCache struct {
+	mu             sync.Mutex
+	cluster        *garage
+	list           []schema.GetBucketsRes
+	listFetchedAt  time.Time
+	listRefreshing bool
+	details        map[string]*bucketDetail
+}
+
+type bucketDetail struct {
+	bucket     *schema.Bucket
+	fetchedAt  time.Time
+	refreshing bool
+}
+
+// BucketListFreshness tells how old the served data is, FetchedAt is the
+// oldest fetch time of the returned entries.
+type BucketListFreshness struct {
+	FetchedAt time.Time
+	Stale     bool
+}
+
+func (f *BucketListFreshness) add(fetchedAt time.Time, stale bool) {
+	if f.FetchedAt.IsZero() || fetchedAt.Before(f.FetchedAt) {
+		f.FetchedAt = fetchedAt
+	}
+	f.Stale = f.Stale || stale
+}
+
+func (g *garage) BucketList() *BucketListCache {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.bucketList == nil {
+		g.bucketList = &BucketListCache{cluster: g, details: map[string]*bucketDetail{}}
+	}
+	return g.bucketList
+}
+
+func getBucketListTTL() (time.Duration, time.Duration) {
+	ttl, err := time.ParseDuration(GetEnv("BUCKET_LIST_TTL", "30s"))
+	if err != nil {
+		ttl = 30 * time.Second
+	}
+	maxStale, err := time.ParseDuration(GetEnv("BUCKET_LIST_MAX_STALE", "10m"))
+	if err != nil {
+		maxStale = 10 * time.Minute
+	}
+	return ttl, max(ttl, maxStale)
+}
+
+func getBucketListConcurrency() int {
+	n, err := strconv.Atoi(GetEnv("BUCKET_LIST_CONCURRENCY", "8"))
+	if err != nil || n <= 0 {
+		return 8
+	}
+	return n
+}
+
+// List returns the buckets of the cluster, without details.
+func (c *BucketListCache) List(ctx context.Context) ([]schema.GetBucketsRes, BucketListFreshness, error) {
+	ttl, maxStale := getBucketListTTL()
+
+	c.mu.Lock()
+	age := time.Since(c.listFetchedAt)
+	if c.list != nil && age < maxStale {
+		stale := age >= ttl
+		if stale && !c.listRefreshing {
+			c.listRefreshing = true
+			go c.refreshList()
+		}
+		res := BucketListFreshness{FetchedAt: c.listFetchedAt, Stale: stale}
+		list := c.list
+		c.mu.Unlock()
+		return list, res, nil
+	}
+	c.mu.Unlock()
+
+	list, err := c.cluster.Client().ListBuckets(ctx)
+	if err != nil {
+		return nil, BucketListFreshness{}, err
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	c.list = list
+	c.listFetchedAt = now
+	c.mu.Unlock()
+
+	return list, BucketListFreshness{FetchedAt: now}, nil
+}
+
+func (c *BucketListCache) refreshList() {
+	list, err := c.cluster.Client().ListBuckets(context.Background())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.listRefreshing = false
+	if err != nil {
+		log.Printf("Cannot refresh bucket list of cluster %s: %v", c.cluster.Name, err)
+		return
+	}
+	c.list = list
+	c.listFetchedAt = time.Now()
+}
+
+// Details returns the details of the given buckets, in the same order.
+// Missing entries are fetched with bounded concurrency, buckets which cannot
+// be fetched are returned with their listed aliases only.
+func (c *BucketListCache) Details(ctx context.Context, buckets []schema.GetBucketsRes) ([]schema.Bucket, BucketListFreshness) {
+	ttl, maxStale := getBucketListTTL()
+	res := make([]schema.Bucket, len(buckets))
+	var freshness BucketListFreshness
+	var missing, stale []int
+
+	c.mu.Lock()
+	for i, bucket := range buckets {
+		entry := c.details[bucket.ID]
+		if entry == nil || time.Since(entry.fetchedAt) >= maxStale {
+			missing = append(missing, i)
+			continue
+		}
+
+		res[i] = *entry.bucket
+		isStale := time.Since(entry.fetchedAt) >= ttl
+		freshness.add(entry.fetchedAt, isStale)
+		if isStale && !entry.refreshing {
+			entry.refreshing = true
+			stale = append(stale, i)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(stale) > 0 {
+		ids := make([]string, 0, len(stale))
+		for _, i := range stale {
+			ids = append(ids, buckets[i].ID)
+		}
+		go c.fetchDetails(context.Background(), ids)
+	}
+
+	if len(missing) > 0 {
+		ids := make([]string, 0, len(missing))
+		for _, i := range missing {
+			ids = append(ids, buckets[i].ID)
+		}
+		fetched := c.fetchDetails(ctx, ids)
+
+		for _, i := range missing {
+			entry := fetched[buckets[i].ID]
+			if entry == nil {
+				res[i] = schema.Bucket{ID: buckets[i].ID, GlobalAliases: buckets[i].GlobalAliases}
+				continue
+			}
+			res[i] = *entry.bucket
+			freshness.add(entry.fetchedAt, false)
+		}
+	}
+
+	for i := range res {
+		res[i].LocalAliases = buckets[i].LocalAliases
+	}
+
+	return res, freshness
+}
+
+// fetchDetails fetches bucket details with at most BUCKET_LIST_CONCURRENCY
+// requests in flight and stores them in the cache.
+func (c *BucketListCache) fetchDetails(ctx context.Context, ids []string) map[string]*bucketDetail {
+	res := make(map[string]*bucketDetail, len(ids))
+	sem := make(chan struct{}, getBucketListConcurrency())
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			bucket, err := c.cluster.Client().GetBucketInfo(ctx, id)
+			if err != nil {
+				log.Printf("Cannot get bucket %s of cluster %s: %v", id, c.cluster.Name, err)
+				return
+			}
+
+			mu.Lock()
+			res[id] = &bucketDetail{bucket: bucket, fetchedAt: time.Now()}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range ids {
+		if entry, ok := res[id]; ok {
+			c.details[id] = entry
+		} else if entry, ok := c.details[id]; ok {
+			entry.refreshing = false
+		}
+	}
+
+	return res
+}
+
+// Invalidate drops the cached list and the details of a bucket, or of every
+// bucket when id is empty.
+func (c *BucketListCache) Invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.list = nil
+	if id == "" {
+		clear(c.details)
+	} else {
+		delete(c.details, id)
+	}
+}
+
+// InvalidateList drops the cached list, keeping the bucket details.
+func (c *BucketListCache) InvalidateList() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.list = nil
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ChecksumMetadataKey is the user metadata key (x-amz-meta-sha256) holding
+// the hex encoded SHA-256 of the full object content.
+const ChecksumMetadataKey = "sha256"
+
+type Checksum struct {
+	ContentMD5 string // base64 encoded MD5 digest
+	SHA256     string // base64 encoded SHA-256 digest
+}
+
+// GetChecksum reads client supplied checksums from the request headers
+// (Content-MD5 and x-amz-checksum-sha256). Both base64 and hex encoded
+// digests are accepted, they are normalized to base64 as expected by S3.
+func GetChecksum(r *http.Request) (*Checksum, error) {
+	return ParseChecksum(r.Header.Get("Content-MD5"), r.Header.Get("X-Amz-Checksum-Sha256"))
+}
+
+func ParseChecksum(contentMD5 string, sha256sum string) (*Checksum, error) {
+	var err error
+	checksum := &Checksum{}
+
+	if checksum.ContentMD5, err = normalizeDigest(contentMD5, md5.Size); err != nil {
+		return nil, fmt.Errorf("invalid md5 checksum: %w", err)
+	}
+	if checksum.SHA256, err = normalizeDigest(sha256sum, sha256.Size); err != nil {
+		return nil, fmt.Errorf("invalid sha256 checksum: %w", err)
+	}
+
+	return checksum, nil
+}
+
+// SHA256Hex returns the hex encoded form of the supplied SHA-256 checksum.
+func (c *Checksum) SHA256Hex() string {
+	if c.SHA256 == "" {
+		return ""
+	}
+	data, _ := base64.StdEncoding.DecodeString(c.SHA256)
+	return hex.EncodeToString(data)
+}
+
+func normalizeDigest(value string, size int) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+
+	if len(value) == size*2 {
+		if data, err := hex.DecodeString(value); err == nil {
+			return base64.StdEncoding.EncodeToString(data), nil
+		}
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	if len(data) != size {
+		return "", errors.New("unexpected digest length")
+	}
+
+	return value, nil
+}
+
+// HashReader streams r through a SHA-256 hash and returns the hex digest and
+// the number of bytes read.
+func HashReader(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", n, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
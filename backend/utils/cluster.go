@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// ClusterHeader selects the cluster of an API request, requests may also be
+// prefixed with /clusters/{name}.
+const ClusterHeader = "X-Garage-Cluster"
+
+const defaultClusterName = "default"
+
+var clusterNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+var ErrClusterNotFound = errors.New("cluster not found")
+
+type clusterRegistry struct {
+	mu       sync.RWMutex
+	clusters []*garage
+}
+
+var Clusters = &clusterRegistry{clusters: []*garage{Garage}}
+
+// LoadClusters loads the additional clusters listed in the CLUSTERS_PATH
+// TOML file. The default cluster is named after CLUSTER_NAME.
+func LoadClusters() error {
+	Garage.Name = GetEnv("CLUSTER_NAME", defaultClusterName)
+	if !clusterNameRegex.MatchString(Garage.Name) {
+		return fmt.Errorf("invalid cluster name %q", Garage.Name)
+	}
+
+	path := os.Getenv("CLUSTERS_PATH")
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file schema.ClustersFile
+	if err := toml.Unmarshal(data, &file); err != nil {
+		return err
+	}
+
+	clusters := []*garage{Garage}
+	names := map[string]bool{Garage.Name: true}
+
+	for _, settings := range file.Clusters {
+		if !clusterNameRegex.MatchString(settings.Name) {
+			return fmt.Errorf("invalid cluster name %q", settings.Name)
+		}
+		if names[settings.Name] {
+			return fmt.Errorf("duplicate cluster name %q", settings.Name)
+		}
+		names[settings.Name] = true
+
+		cluster := &garage{Name: settings.Name, Settings: settings}
+		if err := cluster.LoadConfig(); err != nil {
+			return fmt.Errorf("cannot load config of cluster %s: %w", settings.Name, err)
+		}
+		if cluster.Settings.AdminEndpoint == "" && cluster.Config.Admin.APIBindAddr == "" {
+			return fmt.Errorf("cluster %s has no admin endpoint", settings.Name)
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	Clusters.mu.Lock()
+	Clusters.clusters = clusters
+	Clusters.mu.Unlock()
+
+	return nil
+}
+
+func (c *clusterRegistry) List() []*garage {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]*garage{}, c.clusters...)
+}
+
+// Get returns a cluster by name, an empty name is the default cluster.
+func (c *clusterRegistry) Get(name string) (*garage, error) {
+	if name == "" {
+		return Garage, nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, cluster := range c.clusters {
+		if cluster.Name == name {
+			return cluster, nil
+		}
+	}
+	return nil, ErrClusterNotFound
+}
+
+type clusterContextKey struct{}
+
+func WithCluster(ctx context.Context, cluster *garage) context.Context {
+	return context.WithValue(ctx, clusterContextKey{}, cluster)
+}
+
+// GetRequestCluster returns the cluster selected for a request, or the
+// default cluster.
+func GetRequestCluster(r *http.Request) *garage {
+	if cluster, ok := r.Context().Value(clusterContextKey{}).(*garage); ok {
+		return cluster
+	}
+	return Garage
+}
+
+// GetOverview returns the health and capacity of a cluster.
+func (g *garage) GetOverview(ctx context.Context) schema.ClusterOverview {
+	res := schema.ClusterOverview{
+		Name:       g.Name,
+		Default:    g.IsDefault(),
+		S3Endpoint: g.GetS3Endpoint(),
+	}
+
+	health, err := g.Client().GetClusterHealth(ctx)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Health = health
+
+	status, err := g.Client().GetClusterStatus(ctx)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	res.LayoutVersion = status.LayoutVersion
+	for _, node := range status.Nodes {
+		res.Nodes++
+		if node.IsUp {
+			res.NodesUp++
+		}
+		if node.Role == nil || node.Role.Capacity == nil {
+			continue
+		}
+		res.Capacity += *node.Role.Capacity
+		if node.DataPartition != nil {
+			res.DataAvailable += node.DataPartition.Available
+			res.DataTotal += node.DataPartition.Total
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const maxCORSRules = 100
+
+var corsMethods = []string{"GET", "PUT", "POST", "DELETE", "HEAD"}
+
+// corsHeaderRegex matches an HTTP header name, optionally with one wildcard.
+var corsHeaderRegex = regexp.MustCompile(`^[!#$%&'*+\-.^_` + "`" + `|~0-9A-Za-z]+$`)
+
+// ValidateCORSRules checks CORS rules the way S3 does, so invalid rules are
+// reported before being sent. Methods are normalized to upper case.
+func ValidateCORSRules(rules []schema.CORSRule) error {
+	if len(rules) == 0 {
+		return errors.New("at least one CORS rule is required")
+	}
+	if len(rules) > maxCORSRules {
+		return fmt.Errorf("at most %d CORS rules are allowed", maxCORSRules)
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		name := rule.ID
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		if len(rule.ID) > 255 {
+			return fmt.Errorf("rule %s: id is longer than 255 characters", name)
+		}
+
+		if len(rule.AllowedOrigins) == 0 {
+			return fmt.Errorf("rule %s: at least one allowed origin is required", name)
+		}
+		for _, origin := range rule.AllowedOrigins {
+			if err := validateCORSOrigin(origin); err != nil {
+				return fmt.Errorf("rule %s: %w", name, err)
+			}
+		}
+
+		if len(rule.AllowedMethods) == 0 {
+			return fmt.Errorf("rule %s: at least one allowed method is required", name)
+		}
+		for j, method := range rule.AllowedMethods {
+			method = strings.ToUpper(method)
+			if !slices.Contains(corsMethods, method) {
+				return fmt.Errorf("rule %s: invalid method %q, expected one of %s", name, method, strings.Join(corsMethods, ", "))
+			}
+			rule.AllowedMethods[j] = method
+		}
+
+		for _, header := range rule.AllowedHeaders {
+			if !corsHeaderRegex.MatchString(header) || strings.Count(header, "*") > 1 {
+				return fmt.Errorf("rule %s: invalid allowed header %q", name, header)
+			}
+		}
+		for _, header := range rule.ExposeHeaders {
+			if !corsHeaderRegex.MatchString(header) || strings.Contains(header, "*") {
+				return fmt.Errorf("rule %s: invalid expose header %q", name, header)
+			}
+		}
+
+		if rule.MaxAgeSeconds != nil && *rule.MaxAgeSeconds < 0 {
+			return fmt.Errorf("rule %s: max age cannot be negative", name)
+		}
+	}
+
+	return nil
+}
+
+// validateCORSOrigin accepts "*" or a scheme://host[:port] origin with at
+// most one wildcard.
+func validateCORSOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	if strings.Count(origin, "*") > 1 {
+		return fmt.Errorf("origin %q has more than one wildcard", origin)
+	}
+
+	u, err := url.Parse(strings.Replace(origin, "*", "wildcard", 1))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("invalid origin %q, origins cannot have a path, query or credentials", origin)
+	}
+
+	return nil
+}
+
+// ToS3CORSRules converts CORS rules to their S3 API types.
+func ToS3CORSRules(rules []schema.CORSRule) []types.CORSRule {
+	res := make([]types.CORSRule, 0, len(rules))
+	for _, rule := range rules {
+		s3Rule := types.CORSRule{
+			AllowedOrigins: rule.AllowedOrigins,
+			AllowedMethods: rule.AllowedMethods,
+			AllowedHeaders: rule.AllowedHeaders,
+			ExposeHeaders:  rule.ExposeHeaders,
+			MaxAgeSeconds:  rule.MaxAgeSeconds,
+		}
+		if rule.ID != "" {
+			s3Rule.ID = &rule.ID
+		}
+		res = append(res, s3Rule)
+	}
+	return res
+}
+
+// FromS3CORSRules converts CORS rules from their S3 API types.
+func FromS3CORSRules(rules []types.CORSRule) []schema.CORSRule {
+	res := make([]schema.CORSRule, 0, len(rules))
+	for _, rule := range rules {
+		schemaRule := schema.CORSRule{
+			AllowedOrigins: rule.AllowedOrigins,
+			AllowedMethods: rule.AllowedMethods,
+			AllowedHeaders: rule.AllowedHeaders,
+			ExposeHeaders:  rule.ExposeHeaders,
+			MaxAgeSeconds:  rule.MaxAgeSeconds,
+		}
+		if rule.ID != nil {
+			schemaRule.ID = *rule.ID
+		}
+		res = append(res, schemaRule)
+	}
+	return res
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// WriteFileAtomic replaces a file with data, so readers and crashes see
+// either the previous content or the new one. The data is synced to disk
+// before the file is renamed in place. A file that cannot be replaced, such
+// as a file bind-mounted in a container, is overwritten in place instead.
+func WriteFileAtomic(file string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(file)
+	tmp, err := os.CreateTemp(dir, filepath.Base(file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		if errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.EXDEV) {
+			return writeFileInPlace(file, data, perm)
+		}
+		return err
+	}
+
+	// Persist the rename, not supported on every platform
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// writeFileInPlace overwrites the content of a file, readers may see a
+// partial content while it is written.
+func writeFileInPlace(file string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RotateBackups keeps the current content of a file as file.1, shifting the
+// previous backups up to file.<count>. The backups are only readable by the
+// owner.
+func RotateBackups(file string, count int) error {
+	if count <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil
+	}
+
+	for i := count - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", file, i), fmt.Sprintf("%s.%d", file, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// A copy, as a hard link would share the content of a file overwritten
+	// in place. The previous backup may be such a link, it is removed first.
+	backup := file + ".1"
+	os.Remove(backup)
+	return copyFile(file, backup)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := out.Chmod(0600); err != nil {
+		out.Close()
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -1,28 +1,48 @@
 package utils
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
-	"io"
+	"khairul169/garage-webui/garageapi"
 	"khairul169/garage-webui/schema"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pelletier/go-toml/v2"
 )
 
+// garage is a Garage cluster managed by the WebUI. The default cluster is
+// configured with garage.toml and environment variables, others with the
+// clusters file (see LoadClusters).
 type garage struct {
-	Config schema.Config
+	Name     string
+	Config   schema.Config
+	Settings schema.ClusterConfig
+
+	mu         sync.Mutex
+	client     *garageapi.Client
+	clients    *S3ClientPool
+	bucketList *BucketListCache
 }
 
-var Garage = &garage{}
+var Garage = &garage{Name: defaultClusterName}
 
 func (g *garage) LoadConfig() error {
-	path := GetEnv("CONFIG_PATH", "/etc/garage.toml")
+	// Other clusters are configured from the clusters file, their
+	// garage.toml is optional
+	if !g.IsDefault() && g.Settings.ConfigPath == "" {
+		return nil
+	}
+
+	path := g.Settings.ConfigPath
+	if g.IsDefault() {
+		path = GetEnv("CONFIG_PATH", "/etc/garage.toml")
+	}
 	
 	// Skip loading config if path is empty
 	if path == "" {
@@ -47,8 +67,21 @@ func (g *garage) LoadConfig() error {
 	return nil
 }
 
+func (g *garage) IsDefault() bool {
+	return g == Garage
+}
+
+// getEnv returns the setting of a cluster, environment variables only apply
+// to the default cluster.
+func (g *garage) getEnv(key string, value string) string {
+	if value != "" || !g.IsDefault() {
+		return value
+	}
+	return os.Getenv(key)
+}
+
 func (g *garage) GetAdminEndpoint() string {
-	endpoint := os.Getenv("API_BASE_URL")
+	endpoint := g.getEnv("API_BASE_URL", g.Settings.AdminEndpoint)
 	if len(endpoint) > 0 {
 		return endpoint
 	}
@@ -65,7 +98,7 @@ func (g *garage) GetAdminEndpoint() string {
 }
 
 func (g *garage) GetS3Endpoint() string {
-	endpoint := os.Getenv("S3_ENDPOINT_URL")
+	endpoint := g.getEnv("S3_ENDPOINT_URL", g.Settings.S3Endpoint)
 	if len(endpoint) > 0 {
 		return endpoint
 	}
@@ -82,7 +115,7 @@ func (g *garage) GetS3Endpoint() string {
 }
 
 func (g *garage) GetS3Region() string {
-	endpoint := os.Getenv("S3_REGION")
+	endpoint := g.getEnv("S3_REGION", g.Settings.S3Region)
 	if len(endpoint) > 0 {
 		return endpoint
 	}
@@ -93,7 +126,7 @@ func (g *garage) GetS3Region() string {
 }
 
 func (g *garage) GetAdminKey() string {
-	key := os.Getenv("API_ADMIN_KEY")
+	key := g.getEnv("API_ADMIN_KEY", g.Settings.AdminToken)
 	if len(key) > 0 {
 		return key
 	}
@@ -107,78 +140,46 @@ type FetchOptions struct {
 	Headers map[string]string
 }
 
-func (g *garage) Fetch(url string, options *FetchOptions) ([]byte, error) {
-	var reqBody io.Reader
-	reqUrl := fmt.Sprintf("%s%s", g.GetAdminEndpoint(), url)
-	method := http.MethodGet
+// Client returns the admin API client of the configured endpoint.
+func (g *garage) Client() *garageapi.Client {
+	endpoint := g.GetAdminEndpoint()
+	token := g.GetAdminKey()
 
-	if len(options.Method) > 0 {
-		method = options.Method
-	}
-
-	if options.Body != nil {
-		body, err := json.Marshal(options.Body)
-		if err != nil {
-			return nil, err
-		}
-		reqBody = bytes.NewBuffer(body)
-	}
-
-	req, err := http.NewRequest(method, reqUrl, reqBody)
-	if err != nil {
-		return nil, err
-	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
 
-	if options.Params != nil {
-		q := req.URL.Query()
-		for k, v := range options.Params {
-			q.Add(k, v)
-		}
-		req.URL.RawQuery = q.Encode()
-	}
-
-	// Add auth token
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", g.GetAdminKey()))
-
-	if options.Headers != nil {
-		for k, v := range options.Headers {
-			req.Header.Add(k, v)
+	if g.client == nil || g.client.Endpoint != strings.TrimSuffix(endpoint, "/") || g.client.Token != token {
+		client := garageapi.NewClient(endpoint, token)
+		if timeout, err := time.ParseDuration(GetEnv("API_TIMEOUT", "")); err == nil && timeout > 0 {
+			client.HTTPClient.Timeout = timeout
 		}
+		g.client = client
 	}
+	return g.client
+}
 
-	client := &http.Client{}
-	res, err := client.Do(req)
+// Fetch calls an admin API endpoint and returns the raw response body.
+// Errors are returned as *garageapi.Error.
+func (g *garage) Fetch(ctx context.Context, path string, options *FetchOptions) ([]byte, error) {
+	reqUrl, err := url.Parse(path)
 	if err != nil {
 		return nil, err
 	}
-	if res.Body != nil {
-		defer res.Body.Close()
-	}
-
-	if res.StatusCode != 200 {
-		body, err := io.ReadAll(res.Body)
-		if err != nil {
-			return nil, err
-		}
 
-		var data map[string]interface{}
-
-		if err := json.Unmarshal(body, &data); err != nil {
-			return nil, err
-		}
-
-		message := fmt.Sprintf("unexpected status code: %d", res.StatusCode)
-		if data["message"] != nil {
-			message = fmt.Sprintf("%v", data["message"])
-		}
-
-		return nil, errors.New(message)
+	query := reqUrl.Query()
+	for k, v := range options.Params {
+		query.Add(k, v)
 	}
-
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
+	header := http.Header{}
+	for k, v := range options.Headers {
+		header.Add(k, v)
 	}
 
-	return body, nil
+	return g.Client().Do(ctx, &garageapi.Request{
+		Method: options.Method,
+		Path:   reqUrl.Path,
+		Query:  query,
+		Body:   options.Body,
+		Header: header,
+	}, nil)
 }
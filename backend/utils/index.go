@@ -0,0 +1,632 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"khairul169/garage-webui/schema"
+	"log"
+	"mime"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Indexer keeps a local copy of the object listing of every bucket in an
+// embedded database. Buckets are crawled periodically, and writes made
+// through the WebUI are applied to the index as they happen.
+type Indexer struct {
+	db       *bolt.DB
+	interval time.Duration
+	buckets  map[string]bool
+	events   chan indexEvent
+
+	mu       sync.Mutex
+	crawling map[string]bool
+}
+
+type IndexQuery struct {
+	Filter *ObjectFilter
+	Prefix string
+	Sort   string // "key", "size" or "date"
+	Desc   bool
+	Limit  int
+	Offset int
+}
+
+type indexEvent struct {
+	bucket string
+	key    string
+	remove bool
+	prefix bool
+}
+
+type indexRecord struct {
+	schema.IndexedObject
+	Gen uint64 `json:"gen"`
+}
+
+var (
+	indexObjectsKey = []byte("objects")
+	indexSizeKey    = []byte("size")
+	indexDateKey    = []byte("date")
+	indexMetaKey    = []byte("meta")
+	indexGenKey     = []byte("gen")
+	indexCountKey   = []byte("count")
+	indexedAtKey    = []byte("indexed_at")
+)
+
+var ErrIndexDisabled = errors.New("key index is not enabled")
+
+// Index is nil unless INDEX_PATH is set, every method is a no-op on a nil
+// indexer so callers don't have to check whether it is enabled.
+var Index *Indexer
+
+func InitIndexer() error {
+	path := GetEnv("INDEX_PATH", "")
+	if path == "" {
+		return nil
+	}
+
+	interval, err := time.ParseDuration(GetEnv("INDEX_INTERVAL", "1h"))
+	if err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return err
+	}
+
+	var buckets map[string]bool
+	if list := GetEnv("INDEX_BUCKETS", ""); list != "" {
+		buckets = map[string]bool{}
+		for _, name := range strings.Split(list, ",") {
+			buckets[strings.TrimSpace(name)] = true
+		}
+	}
+
+	Index = &Indexer{
+		db:       db,
+		interval: interval,
+		buckets:  buckets,
+		events:   make(chan indexEvent, 1024),
+		crawling: map[string]bool{},
+	}
+
+	go Index.processEvents()
+	go Index.run()
+
+	return nil
+}
+
+func (ix *Indexer) run() {
+	ticker := time.NewTicker(ix.interval)
+	defer ticker.Stop()
+
+	for {
+		ix.crawlAll()
+		<-ticker.C
+	}
+}
+
+func (ix *Indexer) crawlAll() {
+	buckets, err := Garage.Client().ListBuckets(context.Background())
+	if err != nil {
+		log.Println("Index: cannot list buckets:", err)
+		return
+	}
+
+	ids := map[string]bool{}
+	for _, bucket := range buckets {
+		if ix.isIndexed(bucket.ID, bucket.GlobalAliases) {
+			ids[bucket.ID] = true
+		}
+	}
+
+	for id := range ids {
+		if err := ix.crawl(id); err != nil {
+			log.Printf("Index: cannot crawl bucket %s: %v", id, err)
+		}
+	}
+
+	// Drop buckets which have been removed from the cluster
+	ix.db.Update(func(tx *bolt.Tx) error {
+		var stale [][]byte
+		tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if !ids[string(name)] {
+				stale = append(stale, name)
+			}
+			return nil
+		})
+		for _, name := range stale {
+			tx.DeleteBucket(name)
+		}
+		return nil
+	})
+}
+
+// isIndexed reports whether a bucket is allowed by INDEX_BUCKETS, which may
+// list either bucket ids or global aliases.
+func (ix *Indexer) isIndexed(id string, aliases []string) bool {
+	if ix.buckets == nil || ix.buckets[id] {
+		return true
+	}
+	for _, alias := range aliases {
+		if ix.buckets[alias] {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the id of a bucket, the index is keyed by bucket id.
+func (ix *Indexer) resolve(bucket string) (*schema.Bucket, error) {
+	if ix == nil {
+		return nil, ErrIndexDisabled
+	}
+	return GetBucketInfo(bucket)
+}
+
+// crawl lists every object of a bucket, by id, into the index. Each crawl uses a new
+// generation, entries not seen by the crawl are removed once it completes.
+func (ix *Indexer) crawl(bucket string) error {
+	ix.mu.Lock()
+	if ix.crawling[bucket] {
+		ix.mu.Unlock()
+		return nil
+	}
+	ix.crawling[bucket] = true
+	ix.mu.Unlock()
+
+	defer func() {
+		ix.mu.Lock()
+		delete(ix.crawling, bucket)
+		ix.mu.Unlock()
+	}()
+
+	client, err := NewS3Client(bucket)
+	if err != nil {
+		return err
+	}
+
+	var gen uint64
+	err = ix.db.Update(func(tx *bolt.Tx) error {
+		b, err := createIndexBucket(tx, bucket)
+		if err != nil {
+			return err
+		}
+		meta := b.Bucket(indexMetaKey)
+		gen = getMetaUint(meta, indexGenKey) + 1
+		return meta.Put(indexGenKey, binary.BigEndian.AppendUint64(nil, gen))
+	})
+	if err != nil {
+		return err
+	}
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(client.Name),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return err
+		}
+
+		err = ix.db.Update(func(tx *bolt.Tx) error {
+			b, err := createIndexBucket(tx, bucket)
+			if err != nil {
+				return err
+			}
+
+			for _, object := range page.Contents {
+				obj := schema.IndexedObject{
+					Key:          aws.ToString(object.Key),
+					Size:         aws.ToInt64(object.Size),
+					ETag:         aws.ToString(object.ETag),
+					LastModified: aws.ToTime(object.LastModified),
+				}
+
+				// Listings don't include the content type, keep the one known
+				// from a previous write event when the object is unchanged.
+				if prev := getIndexRecord(b, obj.Key); prev != nil && prev.ETag == obj.ETag {
+					obj.ContentType = prev.ContentType
+				} else {
+					obj.ContentType = mime.TypeByExtension(path.Ext(obj.Key))
+				}
+
+				if err := putIndexRecord(b, obj, gen); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return ix.db.Update(func(tx *bolt.Tx) error {
+		b, err := createIndexBucket(tx, bucket)
+		if err != nil {
+			return err
+		}
+
+		var stale []string
+		b.Bucket(indexObjectsKey).ForEach(func(k, v []byte) error {
+			var record indexRecord
+			if err := json.Unmarshal(v, &record); err != nil || record.Gen != gen {
+				stale = append(stale, string(k))
+			}
+			return nil
+		})
+		for _, key := range stale {
+			if err := deleteIndexRecord(b, key); err != nil {
+				return err
+			}
+		}
+
+		now, _ := time.Now().MarshalBinary()
+		return b.Bucket(indexMetaKey).Put(indexedAtKey, now)
+	})
+}
+
+func (ix *Indexer) processEvents() {
+	for ev := range ix.events {
+		if err := ix.handleEvent(ev); err != nil {
+			log.Printf("Index: cannot update %s/%s: %v", ev.bucket, ev.key, err)
+		}
+	}
+}
+
+func (ix *Indexer) handleEvent(ev indexEvent) error {
+	if ev.remove {
+		return ix.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(ev.bucket))
+			if b == nil {
+				return nil
+			}
+			if !ev.prefix {
+				return deleteIndexRecord(b, ev.key)
+			}
+
+			var keys []string
+			c := b.Bucket(indexObjectsKey).Cursor()
+			for k, _ := c.Seek([]byte(ev.key)); k != nil && bytes.HasPrefix(k, []byte(ev.key)); k, _ = c.Next() {
+				keys = append(keys, string(k))
+			}
+			for _, key := range keys {
+				if err := deleteIndexRecord(b, key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	client, err := NewS3Client(ev.bucket)
+	if err != nil {
+		return err
+	}
+
+	object, err := client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(client.Name),
+		Key:    aws.String(ev.key),
+	})
+	if err != nil {
+		return err
+	}
+
+	return ix.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ev.bucket))
+		if b == nil {
+			// Not crawled yet, the object will be picked up by the crawler
+			return nil
+		}
+
+		return putIndexRecord(b, schema.IndexedObject{
+			Key:          ev.key,
+			Size:         aws.ToInt64(object.ContentLength),
+			ETag:         aws.ToString(object.ETag),
+			LastModified: aws.ToTime(object.LastModified),
+			ContentType:  aws.ToString(object.ContentType),
+		}, getMetaUint(b.Bucket(indexMetaKey), indexGenKey))
+	})
+}
+
+func (ix *Indexer) send(ev indexEvent) {
+	if ix == nil {
+		return
+	}
+
+	select {
+	case ix.events <- ev:
+	default:
+		// Queue is full, the next crawl will catch up with the change
+	}
+}
+
+// Refresh updates the index entry of an object after it has been written
+// through client. Only the buckets of the default cluster are indexed, writes
+// to other clusters are ignored.
+func (ix *Indexer) Refresh(client *S3Bucket, key string) {
+	ix.notify(client, indexEvent{key: key})
+}
+
+// Remove deletes an object from the index.
+func (ix *Indexer) Remove(client *S3Bucket, key string) {
+	ix.notify(client, indexEvent{key: key, remove: true})
+}
+
+// RemovePrefix deletes every object starting with prefix from the index.
+func (ix *Indexer) RemovePrefix(client *S3Bucket, prefix string) {
+	ix.notify(client, indexEvent{key: prefix, remove: true, prefix: true})
+}
+
+func (ix *Indexer) notify(client *S3Bucket, ev indexEvent) {
+	if client.cluster == nil || !client.cluster.IsDefault() {
+		return
+	}
+	ev.bucket = client.ID
+	ix.send(ev)
+}
+
+// Reindex starts crawling a bucket in the background.
+func (ix *Indexer) Reindex(bucket string) error {
+	info, err := ix.resolve(bucket)
+	if err != nil {
+		return err
+	}
+	if !ix.isIndexed(info.ID, info.GlobalAliases) {
+		return errors.New("bucket is not indexed")
+	}
+
+	go func() {
+		if err := ix.crawl(info.ID); err != nil {
+			log.Printf("Index: cannot crawl bucket %s: %v", bucket, err)
+		}
+	}()
+	return nil
+}
+
+func (ix *Indexer) Status(bucket string) (schema.IndexStatus, error) {
+	status := schema.IndexStatus{Bucket: bucket}
+	info, err := ix.resolve(bucket)
+	if err != nil {
+		return status, err
+	}
+
+	ix.mu.Lock()
+	status.Indexing = ix.crawling[info.ID]
+	ix.mu.Unlock()
+
+	err = ix.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(info.ID))
+		if b == nil {
+			return nil
+		}
+
+		status.Objects = int(getMetaUint(b.Bucket(indexMetaKey), indexCountKey))
+		if data := b.Bucket(indexMetaKey).Get(indexedAtKey); data != nil {
+			var t time.Time
+			if err := t.UnmarshalBinary(data); err == nil {
+				status.IndexedAt = &t
+			}
+		}
+		return nil
+	})
+
+	return status, err
+}
+
+// Query returns the indexed objects matching the query, sorted by key, size
+// or last modified date.
+func (ix *Indexer) Query(bucket string, query IndexQuery) (*schema.IndexQueryResult, error) {
+	info, err := ix.resolve(bucket)
+	if err != nil {
+		return nil, err
+	}
+	status, err := ix.Status(info.ID)
+	if err != nil {
+		return nil, err
+	}
+	status.Bucket = bucket
+
+	result := &schema.IndexQueryResult{
+		Objects: []schema.IndexedObject{},
+		Status:  status,
+	}
+	prefix := []byte(query.Prefix)
+	skipped := 0
+
+	visit := func(record *indexRecord) bool {
+		obj := record.IndexedObject
+		if !strings.HasPrefix(obj.Key, query.Prefix) {
+			return true
+		}
+		if query.Filter != nil && !query.Filter.Match(obj.Key, obj.Size, obj.LastModified) {
+			return true
+		}
+		if skipped < query.Offset {
+			skipped++
+			return true
+		}
+		if len(result.Objects) >= query.Limit {
+			result.HasMore = true
+			return false
+		}
+		result.Objects = append(result.Objects, obj)
+		return true
+	}
+
+	err = ix.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(info.ID))
+		if b == nil {
+			return nil
+		}
+		objects := b.Bucket(indexObjectsKey)
+
+		switch query.Sort {
+		case "size", "date":
+			sortKey := indexSizeKey
+			if query.Sort == "date" {
+				sortKey = indexDateKey
+			}
+
+			c := b.Bucket(sortKey).Cursor()
+			k, _ := c.First()
+			if query.Desc {
+				k, _ = c.Last()
+			}
+			for ; k != nil; k = nextKey(c, query.Desc) {
+				record := decodeIndexRecord(objects.Get(k[8:]))
+				if record != nil && !visit(record) {
+					break
+				}
+			}
+
+		default:
+			c := objects.Cursor()
+			var k, v []byte
+			if !query.Desc {
+				k, v = c.Seek(prefix)
+			} else if end := prefixUpperBound(prefix); end == nil {
+				k, v = c.Last()
+			} else if k, v = c.Seek(end); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+
+			for ; k != nil && bytes.HasPrefix(k, prefix); k, v = nextEntry(c, query.Desc) {
+				record := decodeIndexRecord(v)
+				if record != nil && !visit(record) {
+					break
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+func createIndexBucket(tx *bolt.Tx, bucket string) (*bolt.Bucket, error) {
+	b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range [][]byte{indexObjectsKey, indexSizeKey, indexDateKey, indexMetaKey} {
+		if _, err := b.CreateBucketIfNotExists(name); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func getMetaUint(meta *bolt.Bucket, key []byte) uint64 {
+	if data := meta.Get(key); len(data) == 8 {
+		return binary.BigEndian.Uint64(data)
+	}
+	return 0
+}
+
+func addMetaUint(meta *bolt.Bucket, key []byte, delta int) error {
+	value := int64(getMetaUint(meta, key)) + int64(delta)
+	return meta.Put(key, binary.BigEndian.AppendUint64(nil, uint64(max(value, 0))))
+}
+
+func getIndexRecord(b *bolt.Bucket, key string) *indexRecord {
+	return decodeIndexRecord(b.Bucket(indexObjectsKey).Get([]byte(key)))
+}
+
+func decodeIndexRecord(data []byte) *indexRecord {
+	if data == nil {
+		return nil
+	}
+	var record indexRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil
+	}
+	return &record
+}
+
+func putIndexRecord(b *bolt.Bucket, obj schema.IndexedObject, gen uint64) error {
+	if err := deleteIndexRecord(b, obj.Key); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(indexRecord{IndexedObject: obj, Gen: gen})
+	if err != nil {
+		return err
+	}
+
+	if err := b.Bucket(indexObjectsKey).Put([]byte(obj.Key), data); err != nil {
+		return err
+	}
+	if err := addMetaUint(b.Bucket(indexMetaKey), indexCountKey, 1); err != nil {
+		return err
+	}
+	if err := b.Bucket(indexSizeKey).Put(getSortKey(uint64(obj.Size), obj.Key), nil); err != nil {
+		return err
+	}
+	return b.Bucket(indexDateKey).Put(getSortKey(uint64(obj.LastModified.UnixNano()), obj.Key), nil)
+}
+
+func deleteIndexRecord(b *bolt.Bucket, key string) error {
+	prev := getIndexRecord(b, key)
+	if prev == nil {
+		return nil
+	}
+
+	if err := b.Bucket(indexSizeKey).Delete(getSortKey(uint64(prev.Size), key)); err != nil {
+		return err
+	}
+	if err := b.Bucket(indexDateKey).Delete(getSortKey(uint64(prev.LastModified.UnixNano()), key)); err != nil {
+		return err
+	}
+	if err := addMetaUint(b.Bucket(indexMetaKey), indexCountKey, -1); err != nil {
+		return err
+	}
+	return b.Bucket(indexObjectsKey).Delete([]byte(key))
+}
+
+// getSortKey prefixes the object key with a big endian value so entries of
+// the secondary indexes are ordered by that value.
+func getSortKey(value uint64, key string) []byte {
+	return append(binary.BigEndian.AppendUint64(nil, value), key...)
+}
+
+// prefixUpperBound returns the smallest key greater than every key starting
+// with prefix, or nil if there is none.
+func prefixUpperBound(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+func nextKey(c *bolt.Cursor, desc bool) []byte {
+	k, _ := nextEntry(c, desc)
+	return k
+}
+
+func nextEntry(c *bolt.Cursor, desc bool) ([]byte, []byte) {
+	if desc {
+		return c.Prev()
+	}
+	return c.Next()
+}
@@ -0,0 +1,513 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// ToS3LifecycleRules converts lifecycle rules to their S3 API types. The
+// conditions of a filter are merged into an And operator when there are
+// several of them.
+func ToS3LifecycleRules(rules []schema.LifecycleRule) ([]types.LifecycleRule, error) {
+	res := make([]types.LifecycleRule, 0, len(rules))
+	for _, rule := range rules {
+		awsRule := types.LifecycleRule{
+			Status: types.ExpirationStatus(rule.Status),
+		}
+
+		if rule.ID != "" {
+			awsRule.ID = &rule.ID
+		}
+
+		filter, err := getLifecycleFilter(&rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.ID, err)
+		}
+		awsRule.Filter = filter.toS3()
+
+		if rule.Expiration != nil {
+			awsRule.Expiration = &types.LifecycleExpiration{
+				Days:                      rule.Expiration.Days,
+				ExpiredObjectDeleteMarker: rule.Expiration.ExpiredObjectDeleteMarker,
+			}
+			if rule.Expiration.Date != nil {
+				date, err := ParseLifecycleDate(*rule.Expiration.Date)
+				if err != nil {
+					return nil, fmt.Errorf("rule %q: %w", rule.ID, err)
+				}
+				awsRule.Expiration.Date = &date
+			}
+		}
+
+		if rule.NoncurrentVersionExpiration != nil {
+			awsRule.NoncurrentVersionExpiration = &types.NoncurrentVersionExpiration{
+				NoncurrentDays: rule.NoncurrentVersionExpiration.NoncurrentDays,
+			}
+		}
+
+		if rule.AbortIncompleteMultipartUpload != nil {
+			awsRule.AbortIncompleteMultipartUpload = &types.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: rule.AbortIncompleteMultipartUpload.DaysAfterInitiation,
+			}
+		}
+
+		res = append(res, awsRule)
+	}
+
+	return res, nil
+}
+
+// PutLifecycleRules replaces the lifecycle configuration of a bucket.
+func PutLifecycleRules(ctx context.Context, client *S3Bucket, rules []schema.LifecycleRule) error {
+	awsRules, err := ToS3LifecycleRules(rules)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String(client.Name),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{
+			Rules: awsRules,
+		},
+	})
+	return err
+}
+
+// FromS3LifecycleRules converts lifecycle rules from their S3 API types.
+func FromS3LifecycleRules(awsRules []types.LifecycleRule) []schema.LifecycleRule {
+	rules := make([]schema.LifecycleRule, 0, len(awsRules))
+	for _, rule := range awsRules {
+		schemaRule := schema.LifecycleRule{
+			ID:     aws.ToString(rule.ID),
+			Status: string(rule.Status),
+		}
+
+		if rule.Prefix != nil {
+			schemaRule.Prefix = rule.Prefix
+		}
+
+		if rule.Filter != nil {
+			filter := &schema.LifecycleFilter{}
+
+			// Handle Filter members based on AWS SDK types union
+			switch v := rule.Filter.(type) {
+			case *types.LifecycleRuleFilterMemberPrefix:
+				filter.Prefix = v.Value
+				// Also set the top-level Prefix field for frontend compatibility
+				if schemaRule.Prefix == nil {
+					schemaRule.Prefix = &v.Value
+				}
+			case *types.LifecycleRuleFilterMemberTag:
+				filter.Tags = []schema.LifecycleTag{fromS3Tag(v.Value)}
+			case *types.LifecycleRuleFilterMemberObjectSizeGreaterThan:
+				filter.ObjectSizeGreaterThan = &v.Value
+			case *types.LifecycleRuleFilterMemberObjectSizeLessThan:
+				filter.ObjectSizeLessThan = &v.Value
+			case *types.LifecycleRuleFilterMemberAnd:
+				and := &schema.LifecycleFilterAnd{
+					ObjectSizeGreaterThan: v.Value.ObjectSizeGreaterThan,
+					ObjectSizeLessThan:    v.Value.ObjectSizeLessThan,
+				}
+				if v.Value.Prefix != nil {
+					and.Prefix = *v.Value.Prefix
+					// Also set the top-level Prefix field for frontend compatibility
+					if schemaRule.Prefix == nil {
+						schemaRule.Prefix = v.Value.Prefix
+					}
+				}
+				if v.Value.Tags != nil {
+					and.Tags = make([]schema.LifecycleTag, 0, len(v.Value.Tags))
+					for _, tag := range v.Value.Tags {
+						and.Tags = append(and.Tags, fromS3Tag(tag))
+					}
+				}
+				filter.And = and
+			}
+			schemaRule.Filter = filter
+		}
+
+		if rule.Expiration != nil {
+			schemaRule.Expiration = &schema.LifecycleExpiration{
+				Days:                      rule.Expiration.Days,
+				ExpiredObjectDeleteMarker: rule.Expiration.ExpiredObjectDeleteMarker,
+			}
+			if rule.Expiration.Date != nil {
+				dateStr := rule.Expiration.Date.UTC().Format("2006-01-02")
+				schemaRule.Expiration.Date = &dateStr
+			}
+		}
+
+		if rule.NoncurrentVersionExpiration != nil {
+			schemaRule.NoncurrentVersionExpiration = &schema.NoncurrentVersionExpiration{
+				NoncurrentDays: rule.NoncurrentVersionExpiration.NoncurrentDays,
+			}
+		}
+
+		if rule.AbortIncompleteMultipartUpload != nil {
+			schemaRule.AbortIncompleteMultipartUpload = &schema.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: rule.AbortIncompleteMultipartUpload.DaysAfterInitiation,
+			}
+		}
+
+		rules = append(rules, schemaRule)
+	}
+
+	return rules
+}
+
+func fromS3Tag(tag types.Tag) schema.LifecycleTag {
+	return schema.LifecycleTag{Key: aws.ToString(tag.Key), Value: aws.ToString(tag.Value)}
+}
+
+// lifecycleFilter holds every condition of a rule, merged from its legacy
+// prefix, its filter and the And operator of the filter.
+type lifecycleFilter struct {
+	prefix      string
+	tags        []schema.LifecycleTag
+	greaterThan *int64
+	lessThan    *int64
+}
+
+// getLifecycleFilter merges the conditions of a rule, which must not
+// contradict each other.
+func getLifecycleFilter(rule *schema.LifecycleRule) (*lifecycleFilter, error) {
+	var prefixes []string
+	var greaterThan, lessThan []*int64
+	res := &lifecycleFilter{}
+
+	if rule.Prefix != nil && *rule.Prefix != "" {
+		prefixes = append(prefixes, *rule.Prefix)
+	}
+	if filter := rule.Filter; filter != nil {
+		prefixes = append(prefixes, filter.Prefix)
+		res.tags = append(res.tags, filter.Tags...)
+		greaterThan = append(greaterThan, filter.ObjectSizeGreaterThan)
+		lessThan = append(lessThan, filter.ObjectSizeLessThan)
+
+		if and := filter.And; and != nil {
+			prefixes = append(prefixes, and.Prefix)
+			res.tags = append(res.tags, and.Tags...)
+			greaterThan = append(greaterThan, and.ObjectSizeGreaterThan)
+			lessThan = append(lessThan, and.ObjectSizeLessThan)
+		}
+	}
+
+	for _, prefix := range prefixes {
+		if prefix == "" {
+			continue
+		}
+		if res.prefix != "" && prefix != res.prefix {
+			return nil, fmt.Errorf("conflicting prefixes %q and %q", res.prefix, prefix)
+		}
+		res.prefix = prefix
+	}
+
+	var err error
+	if res.greaterThan, err = mergeLifecycleSize(greaterThan, "object size greater than"); err != nil {
+		return nil, err
+	}
+	if res.lessThan, err = mergeLifecycleSize(lessThan, "object size less than"); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]bool{}
+	for _, tag := range res.tags {
+		if keys[tag.Key] {
+			return nil, fmt.Errorf("duplicate tag key %q", tag.Key)
+		}
+		keys[tag.Key] = true
+	}
+
+	return res, nil
+}
+
+func mergeLifecycleSize(values []*int64, name string) (*int64, error) {
+	var res *int64
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		if res != nil && *res != *value {
+			return nil, fmt.Errorf("conflicting %s values %d and %d", name, *res, *value)
+		}
+		res = value
+	}
+	return res, nil
+}
+
+// toS3 returns the filter as its S3 union type: a single condition is sent
+// as is, several ones in an And operator.
+func (f *lifecycleFilter) toS3() types.LifecycleRuleFilter {
+	conditions := len(f.tags)
+	if f.prefix != "" {
+		conditions++
+	}
+	if f.greaterThan != nil {
+		conditions++
+	}
+	if f.lessThan != nil {
+		conditions++
+	}
+
+	switch {
+	case conditions > 1:
+		and := types.LifecycleRuleAndOperator{
+			ObjectSizeGreaterThan: f.greaterThan,
+			ObjectSizeLessThan:    f.lessThan,
+		}
+		if f.prefix != "" {
+			and.Prefix = aws.String(f.prefix)
+		}
+		for _, tag := range f.tags {
+			and.Tags = append(and.Tags, types.Tag{Key: aws.String(tag.Key), Value: aws.String(tag.Value)})
+		}
+		return &types.LifecycleRuleFilterMemberAnd{Value: and}
+	case len(f.tags) == 1:
+		tag := f.tags[0]
+		return &types.LifecycleRuleFilterMemberTag{Value: types.Tag{Key: aws.String(tag.Key), Value: aws.String(tag.Value)}}
+	case f.greaterThan != nil:
+		return &types.LifecycleRuleFilterMemberObjectSizeGreaterThan{Value: *f.greaterThan}
+	case f.lessThan != nil:
+		return &types.LifecycleRuleFilterMemberObjectSizeLessThan{Value: *f.lessThan}
+	default:
+		// An empty prefix applies the rule to every object
+		return &types.LifecycleRuleFilterMemberPrefix{Value: f.prefix}
+	}
+}
+
+// matches reports whether an object matches the filter. Garage has no
+// object tagging, so no object matches a tag condition.
+func (f *lifecycleFilter) matches(key string, size int64) bool {
+	if len(f.tags) > 0 || !strings.HasPrefix(key, f.prefix) {
+		return false
+	}
+	if f.greaterThan != nil && size <= *f.greaterThan {
+		return false
+	}
+	if f.lessThan != nil && size >= *f.lessThan {
+		return false
+	}
+	return true
+}
+
+const maxLifecycleRules = 1000
+
+// ValidateLifecycleRules checks lifecycle rules before they are sent, with
+// the restrictions of Garage: noncurrent versions and delete markers are not
+// supported.
+func ValidateLifecycleRules(rules []schema.LifecycleRule) error {
+	if len(rules) > maxLifecycleRules {
+		return fmt.Errorf("at most %d lifecycle rules are allowed", maxLifecycleRules)
+	}
+
+	ids := map[string]bool{}
+	for i, rule := range rules {
+		name := rule.ID
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		if len(rule.ID) > 255 {
+			return fmt.Errorf("rule %s: id is longer than 255 characters", name)
+		}
+		if rule.ID != "" {
+			if ids[rule.ID] {
+				return fmt.Errorf("rule %s: duplicate id", name)
+			}
+			ids[rule.ID] = true
+		}
+
+		if rule.Status != "Enabled" && rule.Status != "Disabled" {
+			return fmt.Errorf("rule %s: status must be Enabled or Disabled", name)
+		}
+
+		filter, err := getLifecycleFilter(&rule)
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", name, err)
+		}
+		if (filter.greaterThan != nil && *filter.greaterThan < 0) || (filter.lessThan != nil && *filter.lessThan <= 0) {
+			return fmt.Errorf("rule %s: invalid object size filter", name)
+		}
+		if filter.greaterThan != nil && filter.lessThan != nil && *filter.greaterThan >= *filter.lessThan {
+			return fmt.Errorf("rule %s: object size greater than must be less than object size less than", name)
+		}
+
+		if rule.NoncurrentVersionExpiration != nil {
+			return fmt.Errorf("rule %s: noncurrent version expiration is not supported by Garage", name)
+		}
+		if rule.Expiration == nil && rule.AbortIncompleteMultipartUpload == nil {
+			return fmt.Errorf("rule %s: an expiration or an abort of incomplete multipart uploads is required", name)
+		}
+
+		if exp := rule.Expiration; exp != nil {
+			if exp.ExpiredObjectDeleteMarker != nil {
+				return fmt.Errorf("rule %s: expired object delete markers are not supported by Garage", name)
+			}
+			if (exp.Days == nil) == (exp.Date == nil) {
+				return fmt.Errorf("rule %s: expiration requires either days or a date", name)
+			}
+			if exp.Days != nil && *exp.Days <= 0 {
+				return fmt.Errorf("rule %s: expiration days must be positive", name)
+			}
+			if exp.Date != nil {
+				if _, err := ParseLifecycleDate(*exp.Date); err != nil {
+					return fmt.Errorf("rule %s: %w", name, err)
+				}
+			}
+		}
+
+		if abort := rule.AbortIncompleteMultipartUpload; abort != nil {
+			if abort.DaysAfterInitiation == nil || *abort.DaysAfterInitiation <= 0 {
+				return fmt.Errorf("rule %s: days after initiation must be positive", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ParseLifecycleDate parses an expiration date, either as YYYY-MM-DD or
+// RFC3339. S3 requires dates at midnight UTC.
+func ParseLifecycleDate(value string) (time.Time, error) {
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		date, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+
+	date = date.UTC()
+	if !date.Equal(date.Truncate(24 * time.Hour)) {
+		return time.Time{}, fmt.Errorf("date %q must be at midnight UTC", value)
+	}
+	return date, nil
+}
+
+// getLifecycleDeadline returns when an action scheduled days after t runs:
+// lifecycle rules are applied at midnight UTC.
+func getLifecycleDeadline(t time.Time, days int32) time.Time {
+	return t.UTC().Add(time.Duration(days) * 24 * time.Hour).Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// LifecycleDryRun scans a bucket and reports what each rule would expire or
+// abort by the end of today, in 7 days and in 30 days. Rules are expected to
+// be valid.
+func LifecycleDryRun(ctx context.Context, client *S3Bucket, rules []schema.LifecycleRule, now time.Time) (*schema.LifecycleDryRun, error) {
+	today := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	horizons := []time.Time{today, today.AddDate(0, 0, 7), today.AddDate(0, 0, 30)}
+
+	res := &schema.LifecycleDryRun{Rules: make([]schema.LifecycleRuleImpact, len(rules))}
+	filters := make([]*lifecycleFilter, len(rules))
+	dates := make([]*time.Time, len(rules))
+
+	for i := range rules {
+		rule := &rules[i]
+		res.Rules[i] = schema.LifecycleRuleImpact{ID: rule.ID, Status: rule.Status}
+		filter, err := getLifecycleFilter(rule)
+		if err != nil {
+			return nil, err
+		}
+		filters[i] = filter
+		if rule.Expiration != nil && rule.Expiration.Date != nil {
+			date, err := ParseLifecycleDate(*rule.Expiration.Date)
+			if err != nil {
+				return nil, err
+			}
+			dates[i] = &date
+		}
+	}
+
+	add := func(impact *schema.LifecycleRuleImpact, deadline time.Time, objects, bytes, uploads int64) {
+		for j, horizon := range horizons {
+			if deadline.After(horizon) {
+				continue
+			}
+			target := []*schema.LifecycleImpact{&impact.Today, &impact.In7Days, &impact.In30Days}[j]
+			target.Objects += objects
+			target.Bytes += bytes
+			target.Uploads += uploads
+		}
+	}
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(client.Name),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			size := aws.ToInt64(object.Size)
+			res.Objects++
+			res.Bytes += size
+
+			for i := range rules {
+				exp := rules[i].Expiration
+				if exp == nil || !filters[i].matches(key, size) {
+					continue
+				}
+
+				deadline := aws.ToTime(object.LastModified)
+				if dates[i] != nil {
+					deadline = *dates[i]
+				} else if exp.Days != nil {
+					deadline = getLifecycleDeadline(deadline, *exp.Days)
+				} else {
+					continue
+				}
+				add(&res.Rules[i], deadline, 1, size, 0)
+			}
+		}
+	}
+
+	input := &s3.ListMultipartUploadsInput{Bucket: aws.String(client.Name)}
+	for {
+		page, err := client.ListMultipartUploads(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, upload := range page.Uploads {
+			res.Uploads++
+			for i := range rules {
+				abort := rules[i].AbortIncompleteMultipartUpload
+				if abort == nil || abort.DaysAfterInitiation == nil || !strings.HasPrefix(aws.ToString(upload.Key), filters[i].prefix) {
+					continue
+				}
+				add(&res.Rules[i], getLifecycleDeadline(aws.ToTime(upload.Initiated), *abort.DaysAfterInitiation), 0, 0, 1)
+			}
+		}
+
+		if !aws.ToBool(page.IsTruncated) {
+			break
+		}
+		input.KeyMarker = page.NextKeyMarker
+		input.UploadIdMarker = page.NextUploadIdMarker
+	}
+
+	return res, nil
+}
+
+// IsNoSuchLifecycleConfiguration reports whether err is returned for a
+// bucket without lifecycle configuration.
+func IsNoSuchLifecycleConfiguration(err error) bool {
+	return hasS3ErrorCode(err, "NoSuchLifecycleConfiguration")
+}
+
+func hasS3ErrorCode(err error, code string) bool {
+	var ae smithy.APIError
+	return errors.As(err, &ae) && ae.ErrorCode() == code
+}
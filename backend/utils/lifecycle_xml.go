@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const s3XMLNamespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// lifecycleXML is the standard S3 lifecycle configuration document, as
+// used by PutBucketLifecycleConfiguration and the AWS tools.
+type lifecycleXML struct {
+	XMLName xml.Name           `xml:"LifecycleConfiguration"`
+	Xmlns   string             `xml:"xmlns,attr,omitempty"`
+	Rules   []lifecycleRuleXML `xml:"Rule"`
+}
+
+type lifecycleRuleXML struct {
+	ID                             string                    `xml:"ID,omitempty"`
+	Prefix                         *string                   `xml:"Prefix"`
+	Filter                         *lifecycleFilterXML       `xml:"Filter"`
+	Status                         string                    `xml:"Status"`
+	Expiration                     *lifecycleExpirationXML   `xml:"Expiration"`
+	NoncurrentVersionExpiration    *noncurrentExpirationXML  `xml:"NoncurrentVersionExpiration"`
+	AbortIncompleteMultipartUpload *abortIncompleteUploadXML `xml:"AbortIncompleteMultipartUpload"`
+}
+
+type lifecycleFilterXML struct {
+	Prefix                *string                `xml:"Prefix"`
+	Tag                   *lifecycleTagXML       `xml:"Tag"`
+	ObjectSizeGreaterThan *int64                 `xml:"ObjectSizeGreaterThan"`
+	ObjectSizeLessThan    *int64                 `xml:"ObjectSizeLessThan"`
+	And                   *lifecycleFilterAndXML `xml:"And"`
+}
+
+type lifecycleFilterAndXML struct {
+	Prefix                *string           `xml:"Prefix"`
+	Tags                  []lifecycleTagXML `xml:"Tag"`
+	ObjectSizeGreaterThan *int64            `xml:"ObjectSizeGreaterThan"`
+	ObjectSizeLessThan    *int64            `xml:"ObjectSizeLessThan"`
+}
+
+type lifecycleTagXML struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+type lifecycleExpirationXML struct {
+	Date                      string `xml:"Date,omitempty"`
+	Days                      *int32 `xml:"Days"`
+	ExpiredObjectDeleteMarker *bool  `xml:"ExpiredObjectDeleteMarker"`
+}
+
+type noncurrentExpirationXML struct {
+	NoncurrentDays *int32 `xml:"NoncurrentDays"`
+}
+
+type abortIncompleteUploadXML struct {
+	DaysAfterInitiation *int32 `xml:"DaysAfterInitiation"`
+}
+
+// EncodeLifecycleXML returns lifecycle rules as a standard S3 lifecycle
+// configuration document.
+func EncodeLifecycleXML(rules []types.LifecycleRule) ([]byte, error) {
+	doc := lifecycleXML{Xmlns: s3XMLNamespace, Rules: make([]lifecycleRuleXML, 0, len(rules))}
+
+	for _, rule := range rules {
+		xmlRule := lifecycleRuleXML{
+			ID:     aws.ToString(rule.ID),
+			Prefix: rule.Prefix,
+			Status: string(rule.Status),
+		}
+
+		switch v := rule.Filter.(type) {
+		case *types.LifecycleRuleFilterMemberPrefix:
+			xmlRule.Filter = &lifecycleFilterXML{Prefix: aws.String(v.Value)}
+		case *types.LifecycleRuleFilterMemberTag:
+			xmlRule.Filter = &lifecycleFilterXML{Tag: toXMLTag(v.Value)}
+		case *types.LifecycleRuleFilterMemberObjectSizeGreaterThan:
+			xmlRule.Filter = &lifecycleFilterXML{ObjectSizeGreaterThan: aws.Int64(v.Value)}
+		case *types.LifecycleRuleFilterMemberObjectSizeLessThan:
+			xmlRule.Filter = &lifecycleFilterXML{ObjectSizeLessThan: aws.Int64(v.Value)}
+		case *types.LifecycleRuleFilterMemberAnd:
+			and := &lifecycleFilterAndXML{
+				Prefix:                v.Value.Prefix,
+				ObjectSizeGreaterThan: v.Value.ObjectSizeGreaterThan,
+				ObjectSizeLessThan:    v.Value.ObjectSizeLessThan,
+			}
+			for _, tag := range v.Value.Tags {
+				and.Tags = append(and.Tags, *toXMLTag(tag))
+			}
+			xmlRule.Filter = &lifecycleFilterXML{And: and}
+		}
+
+		if exp := rule.Expiration; exp != nil {
+			xmlRule.Expiration = &lifecycleExpirationXML{
+				Days:                      exp.Days,
+				ExpiredObjectDeleteMarker: exp.ExpiredObjectDeleteMarker,
+			}
+			if exp.Date != nil {
+				xmlRule.Expiration.Date = exp.Date.UTC().Format(time.RFC3339)
+			}
+		}
+		if exp := rule.NoncurrentVersionExpiration; exp != nil {
+			xmlRule.NoncurrentVersionExpiration = &noncurrentExpirationXML{NoncurrentDays: exp.NoncurrentDays}
+		}
+		if abort := rule.AbortIncompleteMultipartUpload; abort != nil {
+			xmlRule.AbortIncompleteMultipartUpload = &abortIncompleteUploadXML{DaysAfterInitiation: abort.DaysAfterInitiation}
+		}
+
+		doc.Rules = append(doc.Rules, xmlRule)
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// DecodeLifecycleXML parses a standard S3 lifecycle configuration document.
+func DecodeLifecycleXML(data []byte) ([]types.LifecycleRule, error) {
+	var doc lifecycleXML
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid lifecycle configuration: %w", err)
+	}
+
+	rules := make([]types.LifecycleRule, 0, len(doc.Rules))
+	for i, xmlRule := range doc.Rules {
+		rule := types.LifecycleRule{
+			Prefix: xmlRule.Prefix,
+			Status: types.ExpirationStatus(xmlRule.Status),
+		}
+		if xmlRule.ID != "" {
+			rule.ID = aws.String(xmlRule.ID)
+		}
+
+		if filter := xmlRule.Filter; filter != nil {
+			conditions := 0
+			for _, set := range []bool{filter.Prefix != nil, filter.Tag != nil, filter.ObjectSizeGreaterThan != nil, filter.ObjectSizeLessThan != nil, filter.And != nil} {
+				if set {
+					conditions++
+				}
+			}
+			if conditions > 1 {
+				return nil, fmt.Errorf("rule #%d: a filter has a single condition, use And to combine them", i+1)
+			}
+
+			switch {
+			case filter.Tag != nil:
+				rule.Filter = &types.LifecycleRuleFilterMemberTag{Value: filter.Tag.toS3()}
+			case filter.ObjectSizeGreaterThan != nil:
+				rule.Filter = &types.LifecycleRuleFilterMemberObjectSizeGreaterThan{Value: *filter.ObjectSizeGreaterThan}
+			case filter.ObjectSizeLessThan != nil:
+				rule.Filter = &types.LifecycleRuleFilterMemberObjectSizeLessThan{Value: *filter.ObjectSizeLessThan}
+			case filter.And != nil:
+				and := types.LifecycleRuleAndOperator{
+					Prefix:                filter.And.Prefix,
+					ObjectSizeGreaterThan: filter.And.ObjectSizeGreaterThan,
+					ObjectSizeLessThan:    filter.And.ObjectSizeLessThan,
+				}
+				for _, tag := range filter.And.Tags {
+					and.Tags = append(and.Tags, tag.toS3())
+				}
+				rule.Filter = &types.LifecycleRuleFilterMemberAnd{Value: and}
+			default:
+				rule.Filter = &types.LifecycleRuleFilterMemberPrefix{Value: aws.ToString(filter.Prefix)}
+			}
+		}
+
+		if exp := xmlRule.Expiration; exp != nil {
+			rule.Expiration = &types.LifecycleExpiration{
+				Days:                      exp.Days,
+				ExpiredObjectDeleteMarker: exp.ExpiredObjectDeleteMarker,
+			}
+			if exp.Date != "" {
+				date, err := ParseLifecycleDate(exp.Date)
+				if err != nil {
+					return nil, fmt.Errorf("rule #%d: %w", i+1, err)
+				}
+				rule.Expiration.Date = &date
+			}
+		}
+		if exp := xmlRule.NoncurrentVersionExpiration; exp != nil {
+			rule.NoncurrentVersionExpiration = &types.NoncurrentVersionExpiration{NoncurrentDays: exp.NoncurrentDays}
+		}
+		if abort := xmlRule.AbortIncompleteMultipartUpload; abort != nil {
+			rule.AbortIncompleteMultipartUpload = &types.AbortIncompleteMultipartUpload{DaysAfterInitiation: abort.DaysAfterInitiation}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func toXMLTag(tag types.Tag) *lifecycleTagXML {
+	return &lifecycleTagXML{Key: aws.ToString(tag.Key), Value: aws.ToString(tag.Value)}
+}
+
+func (t lifecycleTagXML) toS3() types.Tag {
+	return types.Tag{Key: aws.String(t.Key), Value: aws.String(t.Value)}
+}
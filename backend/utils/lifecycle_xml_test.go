@@ -0,0 +1,329 @@
+package utils
+
+import (
+	"encoding/json"
+	"khairul169/garage-webui/schema"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func testLifecycleRules() []schema.LifecycleRule {
+	return []schema.LifecycleRule{
+		{
+			ID:         "expire-logs",
+			Status:     "Enabled",
+			Filter:     &schema.LifecycleFilter{Prefix: "logs/"},
+			Expiration: &schema.LifecycleExpiration{Days: aws.Int32(30)},
+		},
+		{
+			ID:         "expire-on-date",
+			Status:     "Enabled",
+			Filter:     &schema.LifecycleFilter{Prefix: "tmp/"},
+			Expiration: &schema.LifecycleExpiration{Date: aws.String("2030-01-15")},
+		},
+		{
+			ID:         "large-objects",
+			Status:     "Disabled",
+			Filter:     &schema.LifecycleFilter{ObjectSizeGreaterThan: aws.Int64(1 << 30)},
+			Expiration: &schema.LifecycleExpiration{Days: aws.Int32(7)},
+		},
+		{
+			ID:         "small-objects",
+			Status:     "Enabled",
+			Filter:     &schema.LifecycleFilter{ObjectSizeLessThan: aws.Int64(1024)},
+			Expiration: &schema.LifecycleExpiration{Days: aws.Int32(1)},
+		},
+		{
+			ID:     "sized-backups",
+			Status: "Enabled",
+			Filter: &schema.LifecycleFilter{And: &schema.LifecycleFilterAnd{
+				Prefix:                "backups/",
+				ObjectSizeGreaterThan: aws.Int64(100),
+				ObjectSizeLessThan:    aws.Int64(1 << 20),
+			}},
+			Expiration:                     &schema.LifecycleExpiration{Date: aws.String("2031-06-01")},
+			AbortIncompleteMultipartUpload: &schema.AbortIncompleteMultipartUpload{DaysAfterInitiation: aws.Int32(3)},
+		},
+		{
+			ID:         "tagged",
+			Status:     "Enabled",
+			Filter:     &schema.LifecycleFilter{Tags: []schema.LifecycleTag{{Key: "env", Value: "dev"}}},
+			Expiration: &schema.LifecycleExpiration{Days: aws.Int32(14)},
+		},
+		{
+			ID:     "tagged-logs",
+			Status: "Enabled",
+			Filter: &schema.LifecycleFilter{And: &schema.LifecycleFilterAnd{
+				Prefix: "logs/",
+				Tags:   []schema.LifecycleTag{{Key: "env", Value: "dev"}, {Key: "team", Value: "ops"}},
+			}},
+			Expiration: &schema.LifecycleExpiration{Days: aws.Int32(3)},
+		},
+		{
+			ID:                             "legacy-prefix",
+			Status:                         "Enabled",
+			Prefix:                         aws.String("old/"),
+			AbortIncompleteMultipartUpload: &schema.AbortIncompleteMultipartUpload{DaysAfterInitiation: aws.Int32(2)},
+		},
+	}
+}
+
+// normalizeLifecycleRules converts rules to S3 and back, the way they are
+// read from Garage, and returns them as JSON for comparison.
+func normalizeLifecycleRules(t *testing.T, rules []schema.LifecycleRule) string {
+	t.Helper()
+	awsRules, err := ToS3LifecycleRules(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(FromS3LifecycleRules(awsRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLifecycleXMLRoundTrip(t *testing.T) {
+	rules := testLifecycleRules()
+	if err := ValidateLifecycleRules(rules); err != nil {
+		t.Fatal(err)
+	}
+
+	awsRules, err := ToS3LifecycleRules(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := EncodeLifecycleXML(awsRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeLifecycleXML(data)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, data)
+	}
+	if !reflect.DeepEqual(decoded, awsRules) {
+		t.Errorf("decoded rules differ\ngot:  %+v\nwant: %+v\n%s", decoded, awsRules, data)
+	}
+
+	// Encoding the decoded document gives the same document
+	again, err := EncodeLifecycleXML(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("re-encoded document differs\ngot:\n%s\nwant:\n%s", again, data)
+	}
+
+	got, err := json.Marshal(FromS3LifecycleRules(decoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := normalizeLifecycleRules(t, rules); string(got) != want {
+		t.Errorf("schema rules differ\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestLifecycleXMLDecodeEncode(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<LifecycleConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Rule>
+    <ID>on-date</ID>
+    <Filter><Prefix>tmp/</Prefix></Filter>
+    <Status>Enabled</Status>
+    <Expiration><Date>2030-01-15T00:00:00Z</Date></Expiration>
+  </Rule>
+  <Rule>
+    <ID>sizes</ID>
+    <Filter>
+      <And>
+        <Prefix>media/</Prefix>
+        <ObjectSizeGreaterThan>1048576</ObjectSizeGreaterThan>
+        <ObjectSizeLessThan>1073741824</ObjectSizeLessThan>
+      </And>
+    </Filter>
+    <Status>Enabled</Status>
+    <Expiration><Days>90</Days></Expiration>
+  </Rule>
+  <Rule>
+    <ID>greater</ID>
+    <Filter><ObjectSizeGreaterThan>10</ObjectSizeGreaterThan></Filter>
+    <Status>Disabled</Status>
+    <Expiration><Days>1</Days></Expiration>
+  </Rule>
+  <Rule>
+    <ID>legacy</ID>
+    <Prefix>old/</Prefix>
+    <Status>Enabled</Status>
+    <AbortIncompleteMultipartUpload><DaysAfterInitiation>5</DaysAfterInitiation></AbortIncompleteMultipartUpload>
+  </Rule>
+</LifecycleConfiguration>`
+
+	rules, err := DecodeLifecycleXML([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 4 {
+		t.Fatalf("%d rules, want 4", len(rules))
+	}
+
+	date := time.Date(2030, 1, 15, 0, 0, 0, 0, time.UTC)
+	if got := rules[0].Expiration.Date; got == nil || !got.Equal(date) {
+		t.Errorf("date = %v", got)
+	}
+	and, ok := rules[1].Filter.(*types.LifecycleRuleFilterMemberAnd)
+	if !ok {
+		t.Fatalf("filter = %T, want And", rules[1].Filter)
+	}
+	if aws.ToString(and.Value.Prefix) != "media/" || aws.ToInt64(and.Value.ObjectSizeGreaterThan) != 1<<20 || aws.ToInt64(and.Value.ObjectSizeLessThan) != 1<<30 {
+		t.Errorf("and = %+v", and.Value)
+	}
+	if greater, ok := rules[2].Filter.(*types.LifecycleRuleFilterMemberObjectSizeGreaterThan); !ok || greater.Value != 10 {
+		t.Errorf("filter = %#v", rules[2].Filter)
+	}
+	if aws.ToString(rules[3].Prefix) != "old/" || rules[3].Filter != nil {
+		t.Errorf("legacy rule = %+v", rules[3])
+	}
+
+	schemaRules := FromS3LifecycleRules(rules)
+	if err := ValidateLifecycleRules(schemaRules); err != nil {
+		t.Fatal(err)
+	}
+	if d := schemaRules[0].Expiration.Date; d == nil || *d != "2030-01-15" {
+		t.Errorf("schema date = %v", d)
+	}
+	if p := schemaRules[3].Prefix; p == nil || *p != "old/" {
+		t.Errorf("schema legacy prefix = %v", p)
+	}
+
+	// Decode -> Encode -> Decode keeps the rules
+	data, err := EncodeLifecycleXML(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "<Date>2030-01-15T00:00:00Z</Date>") || !strings.Contains(string(data), "<Prefix>old/</Prefix>") {
+		t.Errorf("encoded document:\n%s", data)
+	}
+	again, err := DecodeLifecycleXML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, rules) {
+		t.Errorf("rules differ after a round trip\ngot:  %+v\nwant: %+v", again, rules)
+	}
+}
+
+func TestLifecycleXMLInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+		want string
+	}{
+		{"several filter conditions", `<Filter><Prefix>a/</Prefix><ObjectSizeLessThan>1</ObjectSizeLessThan></Filter>`, "single condition"},
+		{"date not at midnight", `<Expiration><Date>2030-01-15T10:00:00Z</Date></Expiration>`, "midnight"},
+		{"invalid date", `<Expiration><Date>tomorrow</Date></Expiration>`, "invalid date"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := `<LifecycleConfiguration><Rule><Status>Enabled</Status>` + tt.rule + `</Rule></LifecycleConfiguration>`
+			_, err := DecodeLifecycleXML([]byte(doc))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := DecodeLifecycleXML([]byte("<LifecycleConfiguration>")); err == nil {
+		t.Error("expected an error for a truncated document")
+	}
+}
+
+func TestLifecycleTagFilters(t *testing.T) {
+	doc := `<LifecycleConfiguration>
+  <Rule>
+    <Status>Enabled</Status>
+    <Filter><Tag><Key>env</Key><Value>dev</Value></Tag></Filter>
+    <Expiration><Days>1</Days></Expiration>
+  </Rule>
+  <Rule>
+    <Status>Enabled</Status>
+    <Filter><And><Prefix>a/</Prefix><Tag><Key>env</Key><Value>dev</Value></Tag><Tag><Key>team</Key><Value>ops</Value></Tag></And></Filter>
+    <Expiration><Days>1</Days></Expiration>
+  </Rule>
+</LifecycleConfiguration>`
+
+	rules, err := DecodeLifecycleXML([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag, ok := rules[0].Filter.(*types.LifecycleRuleFilterMemberTag); !ok || aws.ToString(tag.Value.Key) != "env" || aws.ToString(tag.Value.Value) != "dev" {
+		t.Errorf("filter = %#v", rules[0].Filter)
+	}
+
+	// Reading the rules keeps their tags, so writing them back doesn't
+	// widen them
+	schemaRules := FromS3LifecycleRules(rules)
+	if err := ValidateLifecycleRules(schemaRules); err != nil {
+		t.Fatal(err)
+	}
+	if tags := schemaRules[0].Filter.Tags; len(tags) != 1 || tags[0] != (schema.LifecycleTag{Key: "env", Value: "dev"}) {
+		t.Errorf("tags = %+v", tags)
+	}
+	if and := schemaRules[1].Filter.And; and == nil || and.Prefix != "a/" || len(and.Tags) != 2 {
+		t.Errorf("and = %+v", and)
+	}
+
+	awsRules, err := ToS3LifecycleRules(schemaRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(awsRules, rules) {
+		t.Errorf("rules differ after a round trip\ngot:  %+v\nwant: %+v", awsRules, rules)
+	}
+
+	// Garage objects have no tags, the dry run matches none
+	filter, err := getLifecycleFilter(&schemaRules[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.matches("a/file", 1) {
+		t.Error("an object matches a tag filter")
+	}
+
+	schemaRules[1].Filter.Tags = []schema.LifecycleTag{{Key: "env", Value: "prod"}}
+	if err := ValidateLifecycleRules(schemaRules); err == nil || !strings.Contains(err.Error(), "duplicate tag key") {
+		t.Errorf("err = %v, want a duplicate tag key", err)
+	}
+}
+
+func TestLifecycleFilterMerge(t *testing.T) {
+	// The legacy prefix, the filter and And conditions are merged
+	rule := schema.LifecycleRule{
+		Status: "Enabled",
+		Prefix: aws.String("logs/"),
+		Filter: &schema.LifecycleFilter{
+			Prefix: "logs/",
+			And:    &schema.LifecycleFilterAnd{ObjectSizeLessThan: aws.Int64(10)},
+		},
+		Expiration: &schema.LifecycleExpiration{Days: aws.Int32(1)},
+	}
+	awsRules, err := ToS3LifecycleRules([]schema.LifecycleRule{rule})
+	if err != nil {
+		t.Fatal(err)
+	}
+	and, ok := awsRules[0].Filter.(*types.LifecycleRuleFilterMemberAnd)
+	if !ok || aws.ToString(and.Value.Prefix) != "logs/" || aws.ToInt64(and.Value.ObjectSizeLessThan) != 10 {
+		t.Errorf("filter = %#v", awsRules[0].Filter)
+	}
+
+	rule.Filter.Prefix = "other/"
+	if err := ValidateLifecycleRules([]schema.LifecycleRule{rule}); err == nil || !strings.Contains(err.Error(), "conflicting prefixes") {
+		t.Errorf("err = %v, want conflicting prefixes", err)
+	}
+}
@@ -0,0 +1,248 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"log"
+	"sync"
+	"time"
+)
+
+// Rotated keys are kept for a while so in-flight requests can complete.
+const managedKeyGracePeriod = 10 * time.Minute
+
+// managedKey is an access key created and owned by the WebUI, which is
+// granted to buckets on demand instead of borrowing application keys.
+type managedKey struct {
+	mu       sync.Mutex
+	name     string
+	rotation time.Duration
+	key      *schema.KeyInfo
+}
+
+// ManagedKey is nil unless S3_KEY_MODE is set to "managed".
+var ManagedKey *managedKey
+
+func InitManagedKey() error {
+	if GetEnv("S3_KEY_MODE", "bucket") != "managed" {
+		return nil
+	}
+
+	rotation, err := time.ParseDuration(GetEnv("S3_KEY_ROTATION", "720h"))
+	if err != nil {
+		return fmt.Errorf("invalid S3_KEY_ROTATION: %w", err)
+	}
+
+	ManagedKey = &managedKey{
+		name:     GetEnv("S3_MANAGED_KEY_NAME", "garage-webui"),
+		rotation: rotation,
+	}
+
+	if _, err := ManagedKey.Get(context.Background()); err != nil {
+		log.Println("Cannot load the managed access key, retrying on first use:", err)
+	}
+
+	if rotation > 0 {
+		go ManagedKey.runRotation()
+	}
+
+	return nil
+}
+
+// Get returns the managed key, looking it up by name or creating it when
+// it doesn't exist yet.
+func (m *managedKey) Get(ctx context.Context) (*schema.KeyInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.key != nil {
+		return m.key, nil
+	}
+
+	keys, err := m.listKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		m.key, err = createKey(ctx, m.name)
+		return m.key, err
+	}
+
+	// Use the newest key, older ones are leftovers of a previous rotation
+	latest := keys[0]
+	for _, k := range keys[1:] {
+		if k.Created != nil && (latest.Created == nil || k.Created.After(*latest.Created)) {
+			latest = k
+		}
+	}
+
+	key, err := getKeyInfo(ctx, latest.ID)
+	if err != nil {
+		return nil, err
+	}
+	m.key = key
+
+	for _, k := range keys {
+		if k.ID != latest.ID {
+			m.deleteKeyLater(k.ID, 0)
+		}
+	}
+
+	return m.key, nil
+}
+
+// GrantBucket allows the managed key on a bucket if it isn't already, and
+// returns the key with the bucket name it can use. Buckets without a global
+// alias get a local alias in the namespace of the managed key.
+func (m *managedKey) GrantBucket(ctx context.Context, bucket *schema.Bucket) (*schema.KeyInfo, string, error) {
+	key, err := m.Get(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	granted := false
+	for _, k := range bucket.Keys {
+		if k.AccessKeyID == key.AccessKeyID && k.Permissions.Read && k.Permissions.Write && k.Permissions.Owner {
+			granted = true
+		}
+	}
+
+	if !granted {
+		if err := allowBucketKey(ctx, bucket.ID, key.AccessKeyID, schema.Permissions{Read: true, Write: true, Owner: true}); err != nil {
+			return nil, "", fmt.Errorf("cannot grant managed key: %w", err)
+		}
+	}
+
+	name := getBucketName(bucket, key.AccessKeyID)
+	if name == "" {
+		name = "webui-" + bucket.ID[:16]
+		_, err := Garage.Client().AddBucketAlias(ctx, &schema.BucketAliasRequest{
+			BucketID:    bucket.ID,
+			AccessKeyID: key.AccessKeyID,
+			LocalAlias:  name,
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot add local alias for managed key: %w", err)
+		}
+	}
+
+	return key, name, nil
+}
+
+// Rotate replaces the managed key with a new one holding the same bucket
+// permissions. The old key is deleted after a grace period.
+func (m *managedKey) Rotate(ctx context.Context) error {
+	current, err := m.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	old, err := getKeyInfo(ctx, current.AccessKeyID)
+	if err != nil {
+		return err
+	}
+
+	key, err := createKey(ctx, m.name)
+	if err != nil {
+		return err
+	}
+
+	for _, bucket := range old.Buckets {
+		if err := allowBucketKey(ctx, bucket.ID, key.AccessKeyID, bucket.Permissions); err != nil {
+			deleteKey(context.WithoutCancel(ctx), key.AccessKeyID)
+			return fmt.Errorf("cannot grant bucket %s to the new key: %w", bucket.ID, err)
+		}
+	}
+
+	m.mu.Lock()
+	m.key = key
+	m.mu.Unlock()
+
+	S3Clients.InvalidateAll()
+	m.deleteKeyLater(old.AccessKeyID, managedKeyGracePeriod)
+
+	log.Printf("Managed access key rotated: %s", key.AccessKeyID)
+	return nil
+}
+
+func (m *managedKey) runRotation() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.mu.Lock()
+		key := m.key
+		m.mu.Unlock()
+
+		if key == nil || key.Created == nil || time.Since(*key.Created) < m.rotation {
+			continue
+		}
+		if err := m.Rotate(context.Background()); err != nil {
+			log.Println("Cannot rotate the managed access key:", err)
+		}
+	}
+}
+
+func (m *managedKey) listKeys(ctx context.Context) ([]schema.ListKeysRes, error) {
+	keys, err := Garage.Client().ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]schema.ListKeysRes, 0, 1)
+	for _, k := range keys {
+		if k.Name == m.name {
+			res = append(res, k)
+		}
+	}
+	return res, nil
+}
+
+func createKey(ctx context.Context, name string) (*schema.KeyInfo, error) {
+	key, err := Garage.Client().CreateKey(ctx, &schema.CreateKeyRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	if key.SecretAccessKey == "" {
+		return nil, errors.New("created key has no secret")
+	}
+
+	return key, nil
+}
+
+func (m *managedKey) deleteKeyLater(id string, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		if err := deleteKey(context.Background(), id); err != nil {
+			log.Printf("Cannot delete old managed key %s: %v", id, err)
+		}
+	})
+}
+
+func getKeyInfo(ctx context.Context, id string) (*schema.KeyInfo, error) {
+	return Garage.Client().GetKeyInfo(ctx, id, true)
+}
+
+func allowBucketKey(ctx context.Context, bucketID string, accessKeyID string, permissions schema.Permissions) error {
+	_, err := Garage.Client().AllowBucketKey(ctx, &schema.BucketKeyPermRequest{
+		BucketID:    bucketID,
+		AccessKeyID: accessKeyID,
+		Permissions: permissions,
+	})
+	return err
+}
+
+func denyBucketKey(ctx context.Context, bucketID string, accessKeyID string, permissions schema.Permissions) error {
+	_, err := Garage.Client().DenyBucketKey(ctx, &schema.BucketKeyPermRequest{
+		BucketID:    bucketID,
+		AccessKeyID: accessKeyID,
+		Permissions: permissions,
+	})
+	return err
+}
+
+func deleteKey(ctx context.Context, id string) error {
+	return Garage.Client().DeleteKey(ctx, id)
+}
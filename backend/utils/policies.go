@@ -0,0 +1,422 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// PolicyStore holds the lifecycle policies, stored in the
+// LIFECYCLE_POLICIES_PATH file.
+type PolicyStore struct {
+	mu       sync.RWMutex
+	policies map[string]*schema.LifecyclePolicy
+	file     string
+}
+
+var ErrPolicyNotFound = errors.New("lifecycle policy not found")
+
+var Policies *PolicyStore
+
+func InitPolicyStore() error {
+	store := &PolicyStore{
+		policies: make(map[string]*schema.LifecyclePolicy),
+		file:     GetEnv("LIFECYCLE_POLICIES_PATH", "lifecycle-policies.json"),
+	}
+
+	if err := store.load(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	Policies = store
+	return nil
+}
+
+func (s *PolicyStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+
+	var policies []*schema.LifecyclePolicy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return err
+	}
+
+	for _, policy := range policies {
+		s.policies[policy.ID] = policy
+	}
+	return nil
+}
+
+func (s *PolicyStore) save() error {
+	policies := make([]*schema.LifecyclePolicy, 0, len(s.policies))
+	for _, policy := range s.policies {
+		policies = append(policies, policy)
+	}
+
+	data, err := json.MarshalIndent(policies, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.file, data, 0644)
+}
+
+func (s *PolicyStore) GetAll() []*schema.LifecyclePolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	policies := make([]*schema.LifecyclePolicy, 0, len(s.policies))
+	for _, policy := range s.policies {
+		policies = append(policies, policy)
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Name < policies[j].Name
+	})
+	return policies
+}
+
+func (s *PolicyStore) GetByID(id string) (*schema.LifecyclePolicy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	policy, ok := s.policies[id]
+	if !ok {
+		return nil, ErrPolicyNotFound
+	}
+	return policy, nil
+}
+
+func (s *PolicyStore) Create(policy *schema.LifecyclePolicy) (*schema.LifecyclePolicy, error) {
+	if err := validatePolicy(policy); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	policy.ID = id
+	policy.Version = 1
+	policy.History = []schema.LifecyclePolicyVersion{}
+	policy.CreatedAt = time.Now()
+	policy.UpdatedAt = policy.CreatedAt
+	s.policies[id] = policy
+
+	return policy, s.save()
+}
+
+// Update replaces a policy. The previous rules are kept in the history when
+// they change, under a new version.
+func (s *PolicyStore) Update(id string, policy *schema.LifecyclePolicy) (*schema.LifecyclePolicy, error) {
+	if err := validatePolicy(policy); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.policies[id]
+	if !ok {
+		return nil, ErrPolicyNotFound
+	}
+
+	policy.ID = id
+	policy.Version = current.Version
+	policy.History = current.History
+	policy.CreatedAt = current.CreatedAt
+	policy.UpdatedAt = time.Now()
+
+	if !equalLifecycleRules(policy.Rules, current.Rules) {
+		policy.History = append(policy.History, schema.LifecyclePolicyVersion{
+			Version:   current.Version,
+			Rules:     current.Rules,
+			CreatedAt: current.UpdatedAt,
+		})
+		policy.Version++
+	}
+	s.policies[id] = policy
+
+	return policy, s.save()
+}
+
+// SetAttachments replaces the buckets a policy is attached to, without
+// creating a new version.
+func (s *PolicyStore) SetAttachments(id string, attachments []schema.PolicyAttachment) (*schema.LifecyclePolicy, error) {
+	if err := validatePolicyAttachments(attachments); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.policies[id]
+	if !ok {
+		return nil, ErrPolicyNotFound
+	}
+
+	policy := *current
+	policy.Attachments = attachments
+	policy.UpdatedAt = time.Now()
+	s.policies[id] = &policy
+
+	return &policy, s.save()
+}
+
+func (s *PolicyStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.policies[id]; !ok {
+		return ErrPolicyNotFound
+	}
+	delete(s.policies, id)
+
+	return s.save()
+}
+
+func validatePolicy(policy *schema.LifecyclePolicy) error {
+	if policy.Name == "" {
+		return errors.New("policy name is required")
+	}
+	if len(policy.Rules) == 0 {
+		return errors.New("at least one lifecycle rule is required")
+	}
+	if err := ValidateLifecycleRules(policy.Rules); err != nil {
+		return err
+	}
+	if policy.Attachments == nil {
+		policy.Attachments = []schema.PolicyAttachment{}
+	}
+	return validatePolicyAttachments(policy.Attachments)
+}
+
+func validatePolicyAttachments(attachments []schema.PolicyAttachment) error {
+	for _, attachment := range attachments {
+		if (attachment.Bucket == "") == (attachment.Pattern == "") {
+			return errors.New("an attachment requires either a bucket or a pattern")
+		}
+		if _, err := path.Match(attachment.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", attachment.Pattern)
+		}
+	}
+	return nil
+}
+
+// matchesPolicyCluster reports whether the cluster of an attachment, empty
+// for the default cluster or "*" for every cluster, is g.
+func matchesPolicyCluster(cluster string, g *garage) bool {
+	return cluster == "*" || cluster == g.Name || (cluster == "" && g.IsDefault())
+}
+
+// matchesPolicyAttachment reports whether a bucket of the cluster is
+// selected by the attachment.
+func matchesPolicyAttachment(attachment *schema.PolicyAttachment, g *garage, bucket *schema.GetBucketsRes) bool {
+	if !matchesPolicyCluster(attachment.Cluster, g) {
+		return false
+	}
+
+	if attachment.Bucket != "" {
+		return attachment.Bucket == bucket.ID || slices.Contains(bucket.GlobalAliases, attachment.Bucket)
+	}
+	for _, alias := range bucket.GlobalAliases {
+		if ok, _ := path.Match(attachment.Pattern, alias); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isPolicyAttached(policy *schema.LifecyclePolicy, g *garage, bucket *schema.GetBucketsRes) bool {
+	for i := range policy.Attachments {
+		if matchesPolicyAttachment(&policy.Attachments[i], g, bucket) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPolicyDrift compares the lifecycle configuration of every bucket a
+// policy is attached to with its rules, on every cluster.
+func GetPolicyDrift(ctx context.Context, policy *schema.LifecyclePolicy) *schema.PolicyDriftReport {
+	report := &schema.PolicyDriftReport{
+		PolicyID: policy.ID,
+		Version:  policy.Version,
+		Buckets:  []schema.PolicyDrift{},
+	}
+	policies := Policies.GetAll()
+
+	for _, g := range Clusters.List() {
+		if !isPolicyClusterAttached(policy, g) {
+			continue
+		}
+
+		buckets, _, err := g.BucketList().List(ctx)
+		if err != nil {
+			report.Buckets = append(report.Buckets, schema.PolicyDrift{
+				Cluster: g.Name,
+				Status:  schema.PolicyError,
+				Error:   err.Error(),
+			})
+			continue
+		}
+
+		for i := range buckets {
+			bucket := &buckets[i]
+			if !isPolicyAttached(policy, g, bucket) {
+				continue
+			}
+
+			drift := schema.PolicyDrift{
+				Cluster:  g.Name,
+				BucketID: bucket.ID,
+				Bucket:   bucket.ID,
+				Actual:   []schema.LifecycleRule{},
+			}
+			if len(bucket.GlobalAliases) > 0 {
+				drift.Bucket = bucket.GlobalAliases[0]
+			}
+
+			for _, other := range policies {
+				if other.ID != policy.ID && isPolicyAttached(other, g, bucket) {
+					drift.Policies = append(drift.Policies, other.ID)
+				}
+			}
+			if len(drift.Policies) > 0 {
+				drift.Policies = append([]string{policy.ID}, drift.Policies...)
+				drift.Status = schema.PolicyConflict
+			}
+
+			g.compareLifecyclePolicy(ctx, policy, &drift)
+			report.Buckets = append(report.Buckets, drift)
+		}
+	}
+
+	return report
+}
+
+func isPolicyClusterAttached(policy *schema.LifecyclePolicy, g *garage) bool {
+	for _, attachment := range policy.Attachments {
+		if matchesPolicyCluster(attachment.Cluster, g) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *garage) compareLifecyclePolicy(ctx context.Context, policy *schema.LifecyclePolicy, drift *schema.PolicyDrift) {
+	client, err := g.NewS3Client(drift.BucketID)
+	if err != nil {
+		drift.Status = schema.PolicyError
+		drift.Error = err.Error()
+		return
+	}
+
+	result, err := client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(client.Name),
+	})
+	if err != nil && !IsNoSuchLifecycleConfiguration(err) {
+		drift.Status = schema.PolicyError
+		drift.Error = err.Error()
+		return
+	}
+	if result != nil {
+		drift.Actual = FromS3LifecycleRules(result.Rules)
+	}
+
+	if drift.Status == schema.PolicyConflict {
+		return
+	}
+
+	switch {
+	case len(drift.Actual) == 0:
+		drift.Status = schema.PolicyMissing
+	case equalLifecycleRules(drift.Actual, policy.Rules):
+		drift.Status = schema.PolicyInSync
+	default:
+		drift.Status = schema.PolicyDrifted
+	}
+}
+
+// equalLifecycleRules compares two sets of rules once converted the way they
+// are sent to S3, so the legacy prefix and a prefix filter are equal, and
+// regardless of their order.
+func equalLifecycleRules(a, b []schema.LifecycleRule) bool {
+	normalize := func(rules []schema.LifecycleRule) string {
+		awsRules, err := ToS3LifecycleRules(rules)
+		if err != nil {
+			return ""
+		}
+		rules = FromS3LifecycleRules(awsRules)
+		sort.SliceStable(rules, func(i, j int) bool {
+			return rules[i].ID < rules[j].ID
+		})
+		data, _ := json.Marshal(rules)
+		return string(data)
+	}
+
+	na := normalize(a)
+	return na != "" && na == normalize(b)
+}
+
+// ReconcilePolicy applies the rules of a policy to the attached buckets
+// which drifted from it, or are missing a configuration. Buckets with
+// conflicting policies are left untouched.
+func ReconcilePolicy(ctx context.Context, policy *schema.LifecyclePolicy, bucketIDs []string) *schema.PolicyDriftReport {
+	report := GetPolicyDrift(ctx, policy)
+
+	for i := range report.Buckets {
+		drift := &report.Buckets[i]
+		if drift.Status != schema.PolicyDrifted && drift.Status != schema.PolicyMissing {
+			continue
+		}
+		if len(bucketIDs) > 0 && !slices.Contains(bucketIDs, drift.BucketID) {
+			continue
+		}
+
+		err := reconcileBucket(ctx, drift, policy.Rules)
+		if err != nil {
+			drift.Reconcile = err.Error()
+			continue
+		}
+
+		drift.Reconcile = "applied"
+		drift.Status = schema.PolicyInSync
+		drift.Actual = policy.Rules
+	}
+
+	return report
+}
+
+func reconcileBucket(ctx context.Context, drift *schema.PolicyDrift, rules []schema.LifecycleRule) error {
+	g, err := Clusters.Get(drift.Cluster)
+	if err != nil {
+		return err
+	}
+
+	client, err := g.NewS3Client(drift.BucketID)
+	if err != nil {
+		return err
+	}
+
+	return PutLifecycleRules(ctx, client, rules)
+}
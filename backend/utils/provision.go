@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"regexp"
+	"strings"
+)
+
+var bucketNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// ProvisionError is returned when a provisioning step fails, once the
+// previous steps were undone. Resources of the steps which could not be
+// undone are left over and listed in Rollback.
+type ProvisionError struct {
+	Step     string
+	Err      error
+	Rollback []error
+}
+
+func (e *ProvisionError) Error() string {
+	msg := fmt.Sprintf("provisioning failed at step %q: %v", e.Step, e.Err)
+	if len(e.Rollback) > 0 {
+		msg += fmt.Sprintf("; rollback failed: %v", errors.Join(e.Rollback...))
+	}
+	return msg
+}
+
+func (e *ProvisionError) Unwrap() error {
+	return e.Err
+}
+
+// provisionSaga runs steps in order and undoes the completed ones, in
+// reverse order, when a step fails.
+type provisionSaga struct {
+	steps []provisionStep
+	done  []string
+}
+
+type provisionStep struct {
+	name string
+	do   func() error
+	undo func() error // nil when undone by a previous step
+}
+
+func (s *provisionSaga) add(name string, do func() error, undo func() error) {
+	s.steps = append(s.steps, provisionStep{name: name, do: do, undo: undo})
+}
+
+func (s *provisionSaga) execute() error {
+	for i, step := range s.steps {
+		if err := step.do(); err != nil {
+			return &ProvisionError{Step: step.name, Err: err, Rollback: s.rollback(i)}
+		}
+		s.done = append(s.done, step.name)
+	}
+	return nil
+}
+
+func (s *provisionSaga) rollback(failed int) []error {
+	var errs []error
+	for i := failed - 1; i >= 0; i-- {
+		step := s.steps[i]
+		if step.undo == nil {
+			continue
+		}
+		if err := step.undo(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", step.name, err))
+		}
+	}
+	return errs
+}
+
+// Provision creates a bucket from a template. The generated secret key is
+// only part of the result.
+func (g *garage) Provision(ctx context.Context, template *schema.BucketTemplate, req *schema.ProvisionRequest) (*schema.ProvisionResult, error) {
+	alias := strings.ReplaceAll(template.Alias, "{name}", req.Name)
+	if !bucketNameRegex.MatchString(alias) {
+		return nil, fmt.Errorf("invalid bucket name %q", alias)
+	}
+
+	if len(req.Users) > 0 && template.UserPermissions == nil {
+		return nil, errors.New("template has no user permissions")
+	}
+	for _, id := range req.Users {
+		if _, err := Users.GetByID(id); err != nil {
+			return nil, fmt.Errorf("user %s not found", id)
+		}
+	}
+
+	client := g.Client()
+	res := &schema.ProvisionResult{
+		Template: template.Name,
+		Cluster:  g.Name,
+		Bucket:   alias,
+		Users:    []string{},
+	}
+
+	// Undo steps also run when the request is canceled
+	undoCtx := context.Background()
+	saga := &provisionSaga{}
+
+	saga.add("create bucket", func() error {
+		bucket, err := client.CreateBucket(ctx, &schema.CreateBucketRequest{GlobalAlias: &alias})
+		if err != nil {
+			return err
+		}
+		res.BucketID = bucket.ID
+		return nil
+	}, func() error {
+		g.S3Clients().InvalidateBucket(res.BucketID)
+		return client.DeleteBucket(undoCtx, res.BucketID)
+	})
+
+	if template.Quotas != nil || template.WebsiteAccess != nil {
+		saga.add("update bucket", func() error {
+			_, err := client.UpdateBucket(ctx, res.BucketID, &schema.UpdateBucketRequest{
+				Quotas:        template.Quotas,
+				WebsiteAccess: template.WebsiteAccess,
+			})
+			return err
+		}, nil)
+	}
+
+	if template.Key != nil {
+		saga.add("create key", func() error {
+			key, err := client.CreateKey(ctx, &schema.CreateKeyRequest{
+				Name: strings.ReplaceAll(template.Key.Name, "{name}", req.Name),
+			})
+			if err != nil {
+				return err
+			}
+			res.AccessKeyID = key.AccessKeyID
+			res.SecretAccessKey = key.SecretAccessKey
+			return nil
+		}, func() error {
+			return client.DeleteKey(undoCtx, res.AccessKeyID)
+		})
+
+		saga.add("allow key", func() error {
+			_, err := client.AllowBucketKey(ctx, &schema.BucketKeyPermRequest{
+				BucketID:    res.BucketID,
+				AccessKeyID: res.AccessKeyID,
+				Permissions: template.Key.Permissions,
+			})
+			return err
+		}, nil)
+	}
+
+	if len(template.LifecycleRules) > 0 {
+		saga.add("put lifecycle", func() error {
+			bucket, err := g.NewS3Client(res.BucketID)
+			if err != nil {
+				return err
+			}
+			return PutLifecycleRules(ctx, bucket, template.LifecycleRules)
+		}, nil)
+	}
+
+	cluster := getPermissionCluster(g)
+	for _, id := range req.Users {
+		saga.add("grant user "+id, func() error {
+			perm := *template.UserPermissions
+			perm.Cluster = cluster
+			perm.BucketID = res.BucketID
+			perm.BucketName = alias
+			if err := Users.AddBucketPermission(id, &perm); err != nil {
+				return err
+			}
+			res.Users = append(res.Users, id)
+			return nil
+		}, func() error {
+			return Users.RemoveBucketPermission(id, cluster, res.BucketID)
+		})
+	}
+	if len(req.Users) > 0 {
+		saga.add("sync access keys", func() error {
+			for _, id := range req.Users {
+				if err := SyncUserKeyByID(ctx, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, nil)
+	}
+
+	err := saga.execute()
+	g.BucketList().InvalidateList()
+	if err != nil {
+		return nil, err
+	}
+
+	res.Steps = saga.done
+	return res, nil
+}
@@ -0,0 +1,422 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/garageapi"
+	"khairul169/garage-webui/schema"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	s3CredentialsTTL = time.Hour
+	bucketInfoTTL    = 5 * time.Minute
+
+	// Credentials rejected right after being fetched are not fetched again,
+	// so a request denied for a legitimate reason is only retried once.
+	s3CredentialsMinAge = 5 * time.Second
+)
+
+var bucketIDRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// S3Bucket is an S3 client bound to a bucket. Name is the bucket name to use
+// in S3 requests, either a global alias or a local alias of the client key.
+type S3Bucket struct {
+	*s3.Client
+	ID      string
+	Name    string
+	cluster *garage
+}
+
+type s3Credentials struct {
+	bucketID   string
+	bucketName string
+	value      aws.Credentials
+	fetchedAt  time.Time
+}
+
+type bucketEntry struct {
+	bucket    *schema.Bucket
+	fetchedAt time.Time
+}
+
+// S3ClientPool caches the S3 clients of a cluster and their credentials.
+// Entries are keyed by the credentials source, either "bucket:<id>" for the
+// shared key of a bucket or "key:<access key id>" for a user key.
+type S3ClientPool struct {
+	mu          sync.Mutex
+	cluster     *garage
+	buckets     map[string]*bucketEntry
+	credentials map[string]*s3Credentials
+	clients     map[string]*s3.Client
+}
+
+var s3HTTPClient = awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+	t.MaxIdleConns = 100
+	t.MaxIdleConnsPerHost = 32
+	t.IdleConnTimeout = 90 * time.Second
+})
+
+// S3Clients is the client pool of the default cluster.
+var S3Clients = Garage.S3Clients()
+
+func (g *garage) S3Clients() *S3ClientPool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.clients == nil {
+		g.clients = &S3ClientPool{
+			cluster:     g,
+			buckets:     map[string]*bucketEntry{},
+			credentials: map[string]*s3Credentials{},
+			clients:     map[string]*s3.Client{},
+		}
+	}
+	return g.clients
+}
+
+// NewS3Client returns a client of the default cluster using the shared
+// credentials of a bucket, addressed either by id or by alias.
+func NewS3Client(bucket string) (*S3Bucket, error) {
+	return Garage.NewS3Client(bucket)
+}
+
+func (g *garage) NewS3Client(bucket string) (*S3Bucket, error) {
+	info, err := g.GetBucketInfo(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := g.S3Clients()
+	client, creds, err := pool.get("bucket:"+info.ID, func() (*s3Credentials, error) {
+		return pool.fetchBucketCredentials(info)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get credentials for bucket %s: %w", bucket, err)
+	}
+
+	return &S3Bucket{Client: client, ID: info.ID, Name: creds.bucketName, cluster: g}, nil
+}
+
+// NewUserS3Client returns a client signing requests with the access key
+// linked to a user, so object operations are attributable to that user.
+// The shared bucket credentials are used for users without a key, unless
+// S3_SHARED_KEY_FALLBACK is disabled. User keys live in the default cluster,
+// other clusters always use the shared bucket credentials.
+func (g *garage) NewUserS3Client(userID string, bucket string) (*S3Bucket, error) {
+	if !g.IsDefault() {
+		return g.NewS3Client(bucket)
+	}
+
+	user, _ := Users.GetByID(userID)
+
+	if user == nil || user.AccessKeyID == "" {
+		if GetEnv("S3_SHARED_KEY_FALLBACK", "true") != "true" {
+			return nil, errors.New("no access key is linked to this user")
+		}
+		return g.NewS3Client(bucket)
+	}
+
+	info, err := g.GetBucketInfo(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	accessKeyID := user.AccessKeyID
+	name := getBucketName(info, accessKeyID)
+	if name == "" {
+		return nil, fmt.Errorf("bucket %s has no alias usable with the access key of %s", bucket, user.Username)
+	}
+
+	client, _, err := g.S3Clients().get("key:"+accessKeyID, func() (*s3Credentials, error) {
+		key, err := getKeyInfo(context.Background(), accessKeyID)
+		if err != nil {
+			return nil, err
+		}
+		return &s3Credentials{value: aws.Credentials{AccessKeyID: key.AccessKeyID, SecretAccessKey: key.SecretAccessKey}}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get credentials for user %s: %w", user.Username, err)
+	}
+
+	return &S3Bucket{Client: client, ID: info.ID, Name: name, cluster: g}, nil
+}
+
+// GetBucketInfo returns the cached bucket info of a bucket id or alias in
+// the default cluster.
+func GetBucketInfo(bucket string) (*schema.Bucket, error) {
+	return Garage.GetBucketInfo(bucket)
+}
+
+func (g *garage) GetBucketInfo(bucket string) (*schema.Bucket, error) {
+	return g.S3Clients().getBucket(bucket)
+}
+
+// InvalidateBucket drops the cached info and credentials of a bucket, by
+// id or alias.
+func (p *S3ClientPool) InvalidateBucket(bucket string) {
+	if bucket == "" {
+		return
+	}
+
+	p.mu.Lock()
+	for ref, entry := range p.buckets {
+		if ref == bucket || entry.bucket.ID == bucket || slices.Contains(entry.bucket.GlobalAliases, bucket) ||
+			slices.ContainsFunc(entry.bucket.Keys, func(k schema.KeyElement) bool { return slices.Contains(k.BucketLocalAliases, bucket) }) {
+			delete(p.buckets, ref)
+		}
+	}
+	p.mu.Unlock()
+
+	p.invalidate(func(c *s3Credentials) bool {
+		return c.bucketID == bucket || c.bucketName == bucket
+	})
+}
+
+// InvalidateAccessKey drops every cached credentials using an access key.
+func (p *S3ClientPool) InvalidateAccessKey(accessKeyID string) {
+	p.invalidate(func(c *s3Credentials) bool {
+		return accessKeyID != "" && c.value.AccessKeyID == accessKeyID
+	})
+}
+
+func (p *S3ClientPool) InvalidateAll() {
+	p.mu.Lock()
+	clear(p.buckets)
+	p.mu.Unlock()
+
+	p.invalidate(func(*s3Credentials) bool { return true })
+}
+
+func (p *S3ClientPool) invalidate(match func(c *s3Credentials) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for source, c := range p.credentials {
+		if match(c) {
+			delete(p.credentials, source)
+		}
+	}
+}
+
+// get returns the pooled client of a credentials source. The credentials
+// are resolved on every request attempt so invalidated entries are picked
+// up by existing clients. They are cached for every request, so they are
+// fetched without the context of the request needing them.
+func (p *S3ClientPool) get(source string, fetch func() (*s3Credentials, error)) (*s3.Client, *s3Credentials, error) {
+	creds, err := p.resolve(source, fetch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if client, ok := p.clients[source]; ok {
+		return client, creds, nil
+	}
+
+	provider := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		c, err := p.resolve(source, fetch)
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+		return c.value, nil
+	})
+
+	client := p.newS3Client(provider, &authRetryer{
+		RetryerV2: retry.NewStandard(),
+		refresh:   func() bool { return p.expire(source) },
+	})
+	p.clients[source] = client
+
+	return client, creds, nil
+}
+
+func (p *S3ClientPool) getBucket(bucket string) (*schema.Bucket, error) {
+	p.mu.Lock()
+	entry, ok := p.buckets[bucket]
+	p.mu.Unlock()
+
+	if ok && time.Since(entry.fetchedAt) < bucketInfoTTL {
+		return entry.bucket, nil
+	}
+
+	var info *schema.Bucket
+	var err error
+	if bucketIDRegex.MatchString(bucket) {
+		info, err = p.cluster.Client().GetBucketInfo(context.Background(), bucket)
+	} else {
+		info, err = p.cluster.Client().GetBucketByAlias(context.Background(), bucket)
+		if garageapi.IsNotFound(err) {
+			info, err = p.findLocalAlias(bucket, err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.buckets[bucket] = &bucketEntry{bucket: info, fetchedAt: time.Now()}
+	p.mu.Unlock()
+
+	return info, nil
+}
+
+// findLocalAlias looks up a bucket by the local alias of one of its keys.
+// Garage rejects searches matching several buckets, so an alias shared by
+// the keys of different buckets is not resolved.
+func (p *S3ClientPool) findLocalAlias(alias string, notFound error) (*schema.Bucket, error) {
+	info, err := p.cluster.Client().SearchBucket(context.Background(), alias)
+	if err != nil {
+		return nil, notFound
+	}
+
+	for _, k := range info.Keys {
+		if slices.Contains(k.BucketLocalAliases, alias) {
+			return info, nil
+		}
+	}
+	return nil, notFound
+}
+
+func (p *S3ClientPool) resolve(source string, fetch func() (*s3Credentials, error)) (*s3Credentials, error) {
+	p.mu.Lock()
+	c, ok := p.credentials[source]
+	p.mu.Unlock()
+
+	if ok && time.Since(c.fetchedAt) < s3CredentialsTTL {
+		return c, nil
+	}
+
+	c, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	c.fetchedAt = time.Now()
+
+	p.mu.Lock()
+	p.credentials[source] = c
+	p.mu.Unlock()
+
+	return c, nil
+}
+
+// expire drops the credentials of a source after an authentication error,
+// it reports whether the request should be retried with fresh credentials.
+func (p *S3ClientPool) expire(source string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, ok := p.credentials[source]
+	if ok && time.Since(c.fetchedAt) < s3CredentialsMinAge {
+		return false
+	}
+
+	delete(p.credentials, source)
+	return true
+}
+
+// authRetryer retries requests failing with an authentication error once
+// the cached credentials have been refreshed.
+type authRetryer struct {
+	aws.RetryerV2
+	refresh func() bool
+}
+
+func (r *authRetryer) IsErrorRetryable(err error) bool {
+	var ae smithy.APIError
+	if errors.As(err, &ae) && (ae.ErrorCode() == "InvalidAccessKeyId" || ae.ErrorCode() == "AccessDenied") {
+		return r.refresh()
+	}
+	return r.RetryerV2.IsErrorRetryable(err)
+}
+
+func (p *S3ClientPool) fetchBucketCredentials(bucket *schema.Bucket) (*s3Credentials, error) {
+	res := &s3Credentials{bucketID: bucket.ID}
+
+	// The managed key is only used on the default cluster
+	if ManagedKey != nil && p.cluster.IsDefault() {
+		key, name, err := ManagedKey.GrantBucket(context.Background(), bucket)
+		if err != nil {
+			return nil, err
+		}
+
+		res.bucketName = name
+		res.value = aws.Credentials{AccessKeyID: key.AccessKeyID, SecretAccessKey: key.SecretAccessKey}
+		return res, nil
+	}
+
+	for _, k := range bucket.Keys {
+		name := getBucketName(bucket, k.AccessKeyID)
+		if !k.Permissions.Read || !k.Permissions.Write || name == "" {
+			continue
+		}
+
+		key, err := p.cluster.Client().GetKeyInfo(context.Background(), k.AccessKeyID, true)
+		if err != nil {
+			return nil, err
+		}
+
+		res.bucketName = name
+		res.value = aws.Credentials{AccessKeyID: key.AccessKeyID, SecretAccessKey: key.SecretAccessKey}
+		return res, nil
+	}
+
+	return nil, errors.New("no key with read and write access is allowed on this bucket")
+}
+
+// getBucketName returns the name an access key can address a bucket with
+// in S3 requests: its global alias, or a local alias of that key.
+func getBucketName(bucket *schema.Bucket, accessKeyID string) string {
+	if len(bucket.GlobalAliases) > 0 {
+		return bucket.GlobalAliases[0]
+	}
+	for _, k := range bucket.Keys {
+		if k.AccessKeyID == accessKeyID && len(k.BucketLocalAliases) > 0 {
+			return k.BucketLocalAliases[0]
+		}
+	}
+	return ""
+}
+
+func (p *S3ClientPool) newS3Client(creds aws.CredentialsProvider, retryer aws.Retryer) *s3.Client {
+	// Determine endpoint and whether to disable HTTPS
+	endpoint := p.cluster.GetS3Endpoint()
+	region := p.cluster.GetS3Region()
+	disableHTTPS := !strings.HasPrefix(endpoint, "https://")
+
+	// AWS config without BaseEndpoint
+	awsConfig := aws.Config{
+		Credentials: creds,
+		Region:      region,
+		HTTPClient:  s3HTTPClient,
+		Retryer:     func() aws.Retryer { return retryer },
+	}
+
+	// Build S3 client with custom endpoint resolver for proper signing
+	client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		o.UsePathStyle = true
+		o.EndpointOptions.DisableHTTPS = disableHTTPS
+		o.EndpointResolver = s3.EndpointResolverFunc(func(region string, opts s3.EndpointResolverOptions) (aws.Endpoint, error) {
+			return aws.Endpoint{
+				URL:           endpoint,
+				SigningRegion: region,
+			}, nil
+		})
+	})
+
+	return client
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ObjectFilter struct {
+	query schema.ObjectSearchQuery
+	match func(key string) bool
+}
+
+func NewObjectFilter(query schema.ObjectSearchQuery) (*ObjectFilter, error) {
+	filter := &ObjectFilter{query: query}
+	pattern := query.Query
+
+	if !query.CaseSensitive {
+		pattern = strings.ToLower(pattern)
+	}
+
+	switch query.Mode {
+	case "", "substring":
+		filter.match = func(key string) bool {
+			return strings.Contains(key, pattern)
+		}
+
+	case "glob":
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern: %w", err)
+		}
+		// Patterns without a slash are matched against the file name only
+		matchName := !strings.Contains(pattern, "/")
+		filter.match = func(key string) bool {
+			if matchName {
+				key = path.Base(key)
+			}
+			ok, _ := path.Match(pattern, key)
+			return ok
+		}
+
+	case "regex":
+		if !query.CaseSensitive {
+			pattern = "(?i)" + query.Query
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex pattern: %w", err)
+		}
+		filter.match = re.MatchString
+
+	default:
+		return nil, fmt.Errorf("unknown search mode: %s", query.Mode)
+	}
+
+	return filter, nil
+}
+
+// Match reports whether an object satisfies every condition of the query.
+func (f *ObjectFilter) Match(key string, size int64, lastModified time.Time) bool {
+	q := f.query
+
+	if q.MinSize != nil && size < *q.MinSize {
+		return false
+	}
+	if q.MaxSize != nil && size > *q.MaxSize {
+		return false
+	}
+	if q.ModifiedAfter != nil && lastModified.Before(*q.ModifiedAfter) {
+		return false
+	}
+	if q.ModifiedBefore != nil && lastModified.After(*q.ModifiedBefore) {
+		return false
+	}
+	if q.Query == "" {
+		return true
+	}
+
+	if !q.CaseSensitive && q.Mode != "regex" {
+		key = strings.ToLower(key)
+	}
+	return f.match(key)
+}
+
+// ParseObjectSearchQuery reads the search conditions from the url query.
+// Dates may be either RFC 3339 timestamps or plain YYYY-MM-DD dates, both
+// bounds are inclusive so a plain modifiedBefore date includes its whole day.
+func ParseObjectSearchQuery(values url.Values) (schema.ObjectSearchQuery, error) {
+	var err error
+	query := schema.ObjectSearchQuery{
+		Prefix:        values.Get("prefix"),
+		Query:         values.Get("q"),
+		Mode:          values.Get("mode"),
+		CaseSensitive: values.Get("case") == "1",
+	}
+
+	if query.MinSize, err = parseOptionalInt(values.Get("minSize")); err != nil {
+		return query, errors.New("invalid minSize")
+	}
+	if query.MaxSize, err = parseOptionalInt(values.Get("maxSize")); err != nil {
+		return query, errors.New("invalid maxSize")
+	}
+	if query.ModifiedAfter, err = parseOptionalTime(values.Get("modifiedAfter"), false); err != nil {
+		return query, errors.New("invalid modifiedAfter")
+	}
+	if query.ModifiedBefore, err = parseOptionalTime(values.Get("modifiedBefore"), true); err != nil {
+		return query, errors.New("invalid modifiedBefore")
+	}
+
+	return query, nil
+}
+
+func parseOptionalInt(value string) (*int64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// parseOptionalTime parses a timestamp or a date, which is the start of the
+// day, or its last instant with endOfDay.
+func parseOptionalTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return &t, nil
+	}
+	t, err = time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return &t, nil
+}
@@ -0,0 +1,727 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidState = errors.New("invalid state")
+	ErrPlanChanged  = errors.New("the plan changed since it was confirmed, review it again")
+)
+
+// EncodeStateYAML returns a state as a YAML document. The state is encoded
+// through JSON, so field names follow the JSON API.
+func EncodeStateYAML(state *schema.ClusterState) ([]byte, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML, decoding it keeps the order of the fields
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	setBlockStyle(&node)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), encoder.Close()
+}
+
+func setBlockStyle(node *yaml.Node) {
+	node.Style = 0
+	// Quote the strings YAML 1.1 tools read as booleans
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && slices.Contains(yaml11Bools, strings.ToLower(node.Value)) {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	for _, child := range node.Content {
+		setBlockStyle(child)
+	}
+}
+
+var yaml11Bools = []string{"y", "n", "yes", "no", "on", "off"}
+
+// DecodeStateYAML parses a YAML state document, rejecting unknown fields.
+func DecodeStateYAML(data []byte) (*schema.ClusterState, error) {
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state: %w", err)
+	}
+
+	var state schema.ClusterState
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&state); err != nil {
+		return nil, fmt.Errorf("invalid state: %w", err)
+	}
+	return &state, nil
+}
+
+// ExportState returns the live state of the buckets of the cluster and of
+// the WebUI users. Passwords and secret keys are not exported.
+func (g *garage) ExportState(ctx context.Context) (*schema.ClusterState, error) {
+	state := &schema.ClusterState{
+		Buckets: []schema.BucketState{},
+		Users:   []schema.UserState{},
+	}
+
+	buckets, err := g.Client().ListBuckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range buckets {
+		bucket, err := g.exportBucketState(ctx, item.ID)
+		if err != nil {
+			return nil, fmt.Errorf("bucket %s: %w", item.ID, err)
+		}
+		state.Buckets = append(state.Buckets, *bucket)
+	}
+	sort.Slice(state.Buckets, func(i, j int) bool {
+		return getBucketStateRef(&state.Buckets[i]) < getBucketStateRef(&state.Buckets[j])
+	})
+
+	for _, user := range Users.GetAll() {
+		state.Users = append(state.Users, schema.UserState{
+			Username:          user.Username,
+			Role:              user.Role,
+			BucketPermissions: exportBucketPermissions(user.BucketPermissions),
+			BucketAllowance:   user.BucketAllowance,
+		})
+	}
+	sort.Slice(state.Users, func(i, j int) bool {
+		return state.Users[i].Username < state.Users[j].Username
+	})
+
+	return state, nil
+}
+
+func (g *garage) exportBucketState(ctx context.Context, id string) (*schema.BucketState, error) {
+	info, err := g.Client().GetBucketInfo(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &schema.BucketState{}
+	if len(info.GlobalAliases) > 0 {
+		res.Name = info.GlobalAliases[0]
+		res.Aliases = info.GlobalAliases[1:]
+	} else {
+		res.ID = info.ID
+	}
+
+	if info.Quotas.MaxSize > 0 || info.Quotas.MaxObjects > 0 {
+		res.Quotas = &info.Quotas
+	}
+	if info.WebsiteAccess {
+		res.Website = &info.WebsiteConfig
+	}
+
+	for _, key := range info.Keys {
+		p := key.Permissions
+		if !p.Read && !p.Write && !p.Owner {
+			continue
+		}
+		res.Grants = append(res.Grants, schema.KeyGrant{
+			KeyID:   key.AccessKeyID,
+			KeyName: key.Name,
+			Read:    p.Read,
+			Write:   p.Write,
+			Owner:   p.Owner,
+		})
+	}
+	sort.Slice(res.Grants, func(i, j int) bool {
+		return res.Grants[i].KeyID < res.Grants[j].KeyID
+	})
+
+	// A bucket without usable credentials doesn't fail the whole export
+	if err := g.exportBucketRules(ctx, info.ID, res); err != nil {
+		res.Lifecycle = nil
+		res.CORS = nil
+		res.Skipped = err.Error()
+	}
+
+	return res, nil
+}
+
+// exportBucketRules reads the lifecycle and CORS rules of a bucket, which
+// are only available through the S3 API.
+func (g *garage) exportBucketRules(ctx context.Context, id string, res *schema.BucketState) error {
+	client, err := g.NewS3Client(id)
+	if err != nil {
+		return err
+	}
+
+	lifecycle, err := client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(client.Name),
+	})
+	if err != nil && !IsNoSuchLifecycleConfiguration(err) {
+		return err
+	}
+	if lifecycle != nil && len(lifecycle.Rules) > 0 {
+		res.Lifecycle = FromS3LifecycleRules(lifecycle.Rules)
+	}
+
+	cors, err := client.GetBucketCors(ctx, &s3.GetBucketCorsInput{
+		Bucket: aws.String(client.Name),
+	})
+	if err != nil && !hasS3ErrorCode(err, "NoSuchCORSConfiguration") {
+		return err
+	}
+	if cors != nil && len(cors.CORSRules) > 0 {
+		res.CORS = FromS3CORSRules(cors.CORSRules)
+	}
+
+	return nil
+}
+
+// exportBucketPermissions drops the bucket ids of grants, which are resolved
+// again from the bucket names when applied.
+func exportBucketPermissions(perms []*schema.BucketPermission) []*schema.BucketPermission {
+	res := make([]*schema.BucketPermission, 0, len(perms))
+	for _, perm := range perms {
+		p := *perm
+		p.BucketID = ""
+		if p.Cluster == Garage.Name {
+			p.Cluster = ""
+		}
+		res = append(res, &p)
+	}
+	return res
+}
+
+func getBucketStateRef(bucket *schema.BucketState) string {
+	if bucket.Name != "" {
+		return bucket.Name
+	}
+	return bucket.ID
+}
+
+// planChange is a change of a plan with the call applying it.
+type planChange struct {
+	schema.StateChange
+	apply func(ctx context.Context) error
+}
+
+type statePlanner struct {
+	g        *garage
+	warnings []string
+	changes  []planChange
+	users    []planChange // Applied once the buckets exist
+	deletes  []planChange // Bucket deletions, applied last
+}
+
+func (p *statePlanner) add(action schema.StateAction, kind, target, detail string, apply func(ctx context.Context) error) {
+	p.changes = append(p.changes, planChange{
+		StateChange: schema.StateChange{Action: action, Kind: kind, Target: target, Detail: detail},
+		apply:       apply,
+	})
+}
+
+// StateOptions tunes the plan of a desired state.
+type StateOptions struct {
+	KeepUserID string // The user applying the state, never deleted
+	PruneUsers bool   // Delete the users missing from the desired state
+}
+
+// PlanState computes the changes bringing the live state to the desired
+// one. Buckets missing from the desired state are deleted. Users are shared
+// by every cluster, the missing ones are only deleted with PruneUsers.
+func (g *garage) PlanState(ctx context.Context, desired *schema.ClusterState, opts StateOptions) (*schema.StatePlan, error) {
+	plan, _, err := g.planState(ctx, desired, opts)
+	return plan, err
+}
+
+func (g *garage) planState(ctx context.Context, desired *schema.ClusterState, opts StateOptions) (*schema.StatePlan, []planChange, error) {
+	if err := validateState(desired); err != nil {
+		return nil, nil, err
+	}
+
+	current, err := g.ExportState(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := &statePlanner{g: g}
+	existing := map[string]*schema.BucketState{}
+	for i := range current.Buckets {
+		bucket := &current.Buckets[i]
+		existing[getBucketStateRef(bucket)] = bucket
+	}
+
+	seen := map[string]bool{}
+	for i := range desired.Buckets {
+		bucket := &desired.Buckets[i]
+		ref := getBucketStateRef(bucket)
+		seen[ref] = true
+		if err := p.planBucket(ctx, bucket, existing[ref]); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, bucket := range current.Buckets {
+		ref := getBucketStateRef(&bucket)
+		if seen[ref] {
+			continue
+		}
+		p.deletes = append(p.deletes, planChange{
+			StateChange: schema.StateChange{Action: schema.StateDelete, Kind: "bucket", Target: ref},
+			apply: func(ctx context.Context) error {
+				return g.DeleteBucket(ctx, ref)
+			},
+		})
+	}
+
+	if err := p.planUsers(desired.Users, current.Users, opts); err != nil {
+		return nil, nil, err
+	}
+
+	changes := slices.Concat(p.changes, p.users, p.deletes)
+	plan := &schema.StatePlan{
+		Cluster:  g.Name,
+		Changes:  make([]schema.StateChange, 0, len(changes)),
+		Warnings: p.warnings,
+	}
+	for _, change := range changes {
+		plan.Changes = append(plan.Changes, change.StateChange)
+	}
+
+	// The id covers the desired state too, as the details of a change do
+	// not list every field, e.g. the permissions of a user
+	hash := sha256.New()
+	json.NewEncoder(hash).Encode(desired)
+	json.NewEncoder(hash).Encode(plan)
+	plan.ID = hex.EncodeToString(hash.Sum(nil)[:8])
+
+	return plan, changes, nil
+}
+
+// ApplyState applies the plan of a desired state if its id is still the
+// confirmed one. Every change is attempted, the state converges when the
+// apply is repeated.
+func (g *garage) ApplyState(ctx context.Context, desired *schema.ClusterState, opts StateOptions, confirm string) (*schema.StateApplyResult, error) {
+	plan, changes, err := g.planState(ctx, desired, opts)
+	if err != nil {
+		return nil, err
+	}
+	if confirm != plan.ID {
+		return nil, ErrPlanChanged
+	}
+
+	res := &schema.StateApplyResult{
+		Plan:    plan,
+		Applied: []schema.StateChange{},
+		Errors:  []string{},
+	}
+	for _, change := range changes {
+		if err := change.apply(ctx); err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("%s %s %s: %v", change.Action, change.Kind, change.Target, err))
+			continue
+		}
+		res.Applied = append(res.Applied, change.StateChange)
+	}
+
+	g.BucketList().InvalidateList()
+	return res, nil
+}
+
+func validateState(state *schema.ClusterState) error {
+	refs := map[string]bool{}
+	for i := range state.Buckets {
+		bucket := &state.Buckets[i]
+		ref := getBucketStateRef(bucket)
+		if ref == "" {
+			return fmt.Errorf("%w: a bucket requires a name or an id", ErrInvalidState)
+		}
+		if bucket.Name != "" && !bucketNameRegex.MatchString(bucket.Name) {
+			return fmt.Errorf("%w: invalid bucket name %q", ErrInvalidState, bucket.Name)
+		}
+		for _, alias := range bucket.Aliases {
+			if !bucketNameRegex.MatchString(alias) {
+				return fmt.Errorf("%w: bucket %s: invalid alias %q", ErrInvalidState, ref, alias)
+			}
+		}
+		if bucket.Name == "" && len(bucket.Aliases) > 0 {
+			return fmt.Errorf("%w: bucket %s: aliases require a name", ErrInvalidState, ref)
+		}
+		if refs[ref] {
+			return fmt.Errorf("%w: duplicate bucket %s", ErrInvalidState, ref)
+		}
+		refs[ref] = true
+
+		if len(bucket.Lifecycle) > 0 {
+			if err := ValidateLifecycleRules(bucket.Lifecycle); err != nil {
+				return fmt.Errorf("%w: bucket %s: lifecycle: %w", ErrInvalidState, ref, err)
+			}
+		}
+		if len(bucket.CORS) > 0 {
+			if err := ValidateCORSRules(bucket.CORS); err != nil {
+				return fmt.Errorf("%w: bucket %s: cors: %w", ErrInvalidState, ref, err)
+			}
+		}
+	}
+
+	usernames := map[string]bool{}
+	for _, user := range state.Users {
+		if user.Username == "" {
+			return fmt.Errorf("%w: a user requires a username", ErrInvalidState)
+		}
+		if usernames[user.Username] {
+			return fmt.Errorf("%w: duplicate user %s", ErrInvalidState, user.Username)
+		}
+		usernames[user.Username] = true
+		if user.Role != schema.RoleAdmin && user.Role != schema.RoleUser {
+			return fmt.Errorf("%w: user %s: invalid role %q", ErrInvalidState, user.Username, user.Role)
+		}
+	}
+
+	return nil
+}
+
+func (p *statePlanner) planBucket(ctx context.Context, desired *schema.BucketState, current *schema.BucketState) error {
+	g := p.g
+	ref := getBucketStateRef(desired)
+
+	// The id of a created bucket is only known once applied
+	id := desired.ID
+	bucketID := func() string { return id }
+
+	if current == nil {
+		if desired.Name == "" {
+			return fmt.Errorf("%w: bucket %s does not exist, new buckets require a name", ErrInvalidState, ref)
+		}
+		name := desired.Name
+		p.add(schema.StateCreate, "bucket", ref, "", func(ctx context.Context) error {
+			bucket, err := g.Client().CreateBucket(ctx, &schema.CreateBucketRequest{GlobalAlias: &name})
+			if err != nil {
+				return err
+			}
+			id = bucket.ID
+			return nil
+		})
+		current = &schema.BucketState{Name: desired.Name}
+	} else if id == "" {
+		info, err := g.GetBucketInfo(ref)
+		if err != nil {
+			return fmt.Errorf("bucket %s: %w", ref, err)
+		}
+		id = info.ID
+	}
+
+	for _, alias := range desired.Aliases {
+		if slices.Contains(current.Aliases, alias) {
+			continue
+		}
+		p.add(schema.StateCreate, "alias", ref, alias, func(ctx context.Context) error {
+			_, err := g.Client().AddBucketAlias(ctx, &schema.BucketAliasRequest{BucketID: bucketID(), GlobalAlias: alias})
+			return err
+		})
+	}
+	for _, alias := range current.Aliases {
+		if slices.Contains(desired.Aliases, alias) {
+			continue
+		}
+		p.add(schema.StateDelete, "alias", ref, alias, func(ctx context.Context) error {
+			_, err := g.Client().RemoveBucketAlias(ctx, &schema.BucketAliasRequest{BucketID: bucketID(), GlobalAlias: alias})
+			return err
+		})
+	}
+
+	if quotas := getStateQuotas(desired.Quotas); quotas != getStateQuotas(current.Quotas) {
+		p.add(getStateAction(desired.Quotas != nil, current.Quotas != nil), "quotas", ref,
+			fmt.Sprintf("max_size=%d max_objects=%d", quotas.MaxSize, quotas.MaxObjects),
+			func(ctx context.Context) error {
+				req := &schema.UpdateBucketQuotas{}
+				if quotas.MaxSize > 0 {
+					req.MaxSize = &quotas.MaxSize
+				}
+				if quotas.MaxObjects > 0 {
+					req.MaxObjects = &quotas.MaxObjects
+				}
+				_, err := g.Client().UpdateBucket(ctx, bucketID(), &schema.UpdateBucketRequest{Quotas: req})
+				return err
+			})
+	}
+
+	if !equalJSON(desired.Website, current.Website) {
+		req := &schema.UpdateWebsiteAccess{Enabled: desired.Website != nil}
+		detail := "disabled"
+		if desired.Website != nil {
+			req.IndexDocument = desired.Website.IndexDocument
+			req.ErrorDocument = desired.Website.ErrorDocument
+			detail = "index=" + req.IndexDocument
+		}
+		p.add(getStateAction(desired.Website != nil, current.Website != nil), "website", ref, detail, func(ctx context.Context) error {
+			_, err := g.UpdateWebsite(ctx, bucketID(), req)
+			return err
+		})
+	}
+
+	// The S3 settings are changed with the credentials of a key of the
+	// bucket, which a new bucket only gets from its grants
+	p.planGrants(ref, bucketID, desired.Grants, current.Grants)
+	p.planBucketRules(ref, bucketID, desired, current)
+
+	return nil
+}
+
+// planBucketRules plans the lifecycle and CORS rules, unless they could not
+// be read.
+func (p *statePlanner) planBucketRules(ref string, bucketID func() string, desired, current *schema.BucketState) {
+	g := p.g
+	for _, skipped := range []string{current.Skipped, desired.Skipped} {
+		if skipped != "" {
+			p.warnings = append(p.warnings, fmt.Sprintf("bucket %s: lifecycle and cors rules left untouched: %s", ref, skipped))
+			return
+		}
+	}
+
+	if len(desired.Lifecycle) != len(current.Lifecycle) || (len(desired.Lifecycle) > 0 && !equalLifecycleRules(desired.Lifecycle, current.Lifecycle)) {
+		rules := desired.Lifecycle
+		p.add(getStateAction(len(rules) > 0, len(current.Lifecycle) > 0), "lifecycle", ref, fmt.Sprintf("%d rules", len(rules)), func(ctx context.Context) error {
+			client, err := g.NewS3Client(bucketID())
+			if err != nil {
+				return err
+			}
+			if len(rules) == 0 {
+				_, err = client.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(client.Name)})
+				return err
+			}
+			return PutLifecycleRules(ctx, client, rules)
+		})
+	}
+
+	if !equalJSON(desired.CORS, current.CORS) {
+		rules := desired.CORS
+		p.add(getStateAction(len(rules) > 0, len(current.CORS) > 0), "cors", ref, fmt.Sprintf("%d rules", len(rules)), func(ctx context.Context) error {
+			client, err := g.NewS3Client(bucketID())
+			if err != nil {
+				return err
+			}
+			if len(rules) == 0 {
+				_, err = client.DeleteBucketCors(ctx, &s3.DeleteBucketCorsInput{Bucket: aws.String(client.Name)})
+				return err
+			}
+			_, err = client.PutBucketCors(ctx, &s3.PutBucketCorsInput{
+				Bucket:            aws.String(client.Name),
+				CORSConfiguration: &types.CORSConfiguration{CORSRules: ToS3CORSRules(rules)},
+			})
+			return err
+		})
+	}
+}
+
+func (p *statePlanner) planGrants(ref string, bucketID func() string, desired, current []schema.KeyGrant) {
+	g := p.g
+	grants := map[string]schema.Permissions{}
+	for _, grant := range current {
+		grants[grant.KeyID] = schema.Permissions{Read: grant.Read, Write: grant.Write, Owner: grant.Owner}
+	}
+
+	keys := map[string]bool{}
+	for _, grant := range desired {
+		keys[grant.KeyID] = true
+		want := schema.Permissions{Read: grant.Read, Write: grant.Write, Owner: grant.Owner}
+		have, ok := grants[grant.KeyID]
+		if ok && have == want {
+			continue
+		}
+
+		allow := schema.Permissions{Read: want.Read && !have.Read, Write: want.Write && !have.Write, Owner: want.Owner && !have.Owner}
+		deny := schema.Permissions{Read: have.Read && !want.Read, Write: have.Write && !want.Write, Owner: have.Owner && !want.Owner}
+		keyID := grant.KeyID
+
+		p.add(getStateAction(true, ok), "grant", ref, fmt.Sprintf("%s %s", keyID, formatPermissions(want)), func(ctx context.Context) error {
+			if allow.Read || allow.Write || allow.Owner {
+				if _, err := g.Client().AllowBucketKey(ctx, &schema.BucketKeyPermRequest{BucketID: bucketID(), AccessKeyID: keyID, Permissions: allow}); err != nil {
+					return err
+				}
+			}
+			if deny.Read || deny.Write || deny.Owner {
+				if _, err := g.Client().DenyBucketKey(ctx, &schema.BucketKeyPermRequest{BucketID: bucketID(), AccessKeyID: keyID, Permissions: deny}); err != nil {
+					return err
+				}
+			}
+			g.S3Clients().InvalidateBucket(bucketID())
+			return nil
+		})
+	}
+
+	for _, grant := range current {
+		if keys[grant.KeyID] {
+			continue
+		}
+		keyID := grant.KeyID
+		p.add(schema.StateDelete, "grant", ref, keyID, func(ctx context.Context) error {
+			_, err := g.Client().DenyBucketKey(ctx, &schema.BucketKeyPermRequest{
+				BucketID:    bucketID(),
+				AccessKeyID: keyID,
+				Permissions: schema.Permissions{Read: true, Write: true, Owner: true},
+			})
+			g.S3Clients().InvalidateBucket(bucketID())
+			return err
+		})
+	}
+}
+
+func (p *statePlanner) planUsers(desired, current []schema.UserState, opts StateOptions) error {
+	existing := map[string]*schema.UserState{}
+	for i := range current {
+		existing[current[i].Username] = &current[i]
+	}
+
+	for _, user := range desired {
+		perms := exportBucketPermissions(user.BucketPermissions)
+		have := existing[user.Username]
+
+		if have == nil {
+			if user.Password == "" {
+				return fmt.Errorf("%w: user %s does not exist, new users require a password", ErrInvalidState, user.Username)
+			}
+			req := &schema.CreateUserRequest{
+				Username:          user.Username,
+				Password:          user.Password,
+				Role:              user.Role,
+				BucketPermissions: perms,
+				BucketAllowance:   user.BucketAllowance,
+			}
+			p.users = append(p.users, planChange{
+				StateChange: schema.StateChange{Action: schema.StateCreate, Kind: "user", Target: user.Username, Detail: string(user.Role)},
+				apply: func(ctx context.Context) error {
+					_, err := Users.Create(req)
+					return err
+				},
+			})
+			continue
+		}
+
+		if have.Role == user.Role && equalJSON(have.BucketPermissions, perms) && equalJSON(have.BucketAllowance, user.BucketAllowance) {
+			continue
+		}
+
+		req := &schema.UpdateUserRequest{
+			Role:              user.Role,
+			BucketPermissions: perms,
+			BucketAllowance:   user.BucketAllowance,
+		}
+		if req.BucketAllowance == nil {
+			// A zero allowance removes it
+			req.BucketAllowance = &schema.BucketAllowance{}
+		}
+		username := user.Username
+		p.users = append(p.users, planChange{
+			StateChange: schema.StateChange{Action: schema.StateUpdate, Kind: "user", Target: username, Detail: string(user.Role)},
+			apply: func(ctx context.Context) error {
+				u, err := Users.GetByUsername(username)
+				if err != nil {
+					return err
+				}
+				if u, err = Users.Update(u.ID, req); err != nil {
+					return err
+				}
+				return SyncUserKey(ctx, u)
+			},
+		})
+	}
+
+	if !opts.PruneUsers {
+		return nil
+	}
+
+	names := map[string]bool{}
+	for _, user := range desired {
+		names[user.Username] = true
+	}
+	for _, user := range current {
+		if names[user.Username] {
+			continue
+		}
+		u, err := Users.GetByUsername(user.Username)
+		if err != nil || u.ID == opts.KeepUserID {
+			continue
+		}
+		id := u.ID
+		p.users = append(p.users, planChange{
+			StateChange: schema.StateChange{Action: schema.StateDelete, Kind: "user", Target: user.Username},
+			apply: func(ctx context.Context) error {
+				return Users.Delete(id)
+			},
+		})
+	}
+
+	return nil
+}
+
+func getStateQuotas(quotas *schema.Quotas) schema.Quotas {
+	if quotas == nil {
+		return schema.Quotas{}
+	}
+	return *quotas
+}
+
+func getStateAction(desired, current bool) schema.StateAction {
+	switch {
+	case !current:
+		return schema.StateCreate
+	case !desired:
+		return schema.StateDelete
+	default:
+		return schema.StateUpdate
+	}
+}
+
+func formatPermissions(p schema.Permissions) string {
+	var res []string
+	if p.Read {
+		res = append(res, "read")
+	}
+	if p.Write {
+		res = append(res, "write")
+	}
+	if p.Owner {
+		res = append(res, "owner")
+	}
+	if len(res) == 0 {
+		return "none"
+	}
+	return strings.Join(res, ",")
+}
+
+// equalJSON compares two values by their JSON encoding, so nil and empty
+// slices are equal.
+func equalJSON(a, b any) bool {
+	da, _ := json.Marshal(a)
+	db, _ := json.Marshal(b)
+	normalize := func(data []byte) string {
+		s := string(data)
+		if s == "[]" || s == "{}" {
+			return "null"
+		}
+		return s
+	}
+	return normalize(da) == normalize(db)
+}
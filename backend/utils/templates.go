@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TemplateStore holds the bucket provisioning templates, stored in the
+// TEMPLATES_PATH file.
+type TemplateStore struct {
+	mu        sync.RWMutex
+	templates map[string]*schema.BucketTemplate
+	file      string
+}
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+var Templates *TemplateStore
+
+func InitTemplateStore() error {
+	store := &TemplateStore{
+		templates: make(map[string]*schema.BucketTemplate),
+		file:      GetEnv("TEMPLATES_PATH", "templates.json"),
+	}
+
+	if err := store.load(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	Templates = store
+	return nil
+}
+
+func (s *TemplateStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+
+	var templates []*schema.BucketTemplate
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return err
+	}
+
+	for _, template := range templates {
+		s.templates[template.ID] = template
+	}
+	return nil
+}
+
+func (s *TemplateStore) save() error {
+	templates := make([]*schema.BucketTemplate, 0, len(s.templates))
+	for _, template := range s.templates {
+		templates = append(templates, template)
+	}
+
+	data, err := json.MarshalIndent(templates, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.file, data, 0644)
+}
+
+func (s *TemplateStore) GetAll() []*schema.BucketTemplate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	templates := make([]*schema.BucketTemplate, 0, len(s.templates))
+	for _, template := range s.templates {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates
+}
+
+func (s *TemplateStore) GetByID(id string) (*schema.BucketTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	template, ok := s.templates[id]
+	if !ok {
+		return nil, ErrTemplateNotFound
+	}
+	return template, nil
+}
+
+func (s *TemplateStore) Create(template *schema.BucketTemplate) (*schema.BucketTemplate, error) {
+	if err := validateTemplate(template); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	template.ID = id
+	template.CreatedAt = time.Now()
+	template.UpdatedAt = template.CreatedAt
+	s.templates[id] = template
+
+	return template, s.save()
+}
+
+func (s *TemplateStore) Update(id string, template *schema.BucketTemplate) (*schema.BucketTemplate, error) {
+	if err := validateTemplate(template); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.templates[id]
+	if !ok {
+		return nil, ErrTemplateNotFound
+	}
+
+	template.ID = id
+	template.CreatedAt = current.CreatedAt
+	template.UpdatedAt = time.Now()
+	s.templates[id] = template
+
+	return template, s.save()
+}
+
+func (s *TemplateStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.templates[id]; !ok {
+		return ErrTemplateNotFound
+	}
+	delete(s.templates, id)
+
+	return s.save()
+}
+
+func validateTemplate(template *schema.BucketTemplate) error {
+	if template.Name == "" {
+		return errors.New("template name is required")
+	}
+
+	if template.Alias == "" {
+		template.Alias = "{name}"
+	}
+	if !strings.Contains(template.Alias, "{name}") {
+		return errors.New("alias must contain {name}")
+	}
+
+	if template.Key != nil {
+		if template.Key.Name == "" {
+			template.Key.Name = "{name}"
+		}
+		p := template.Key.Permissions
+		if !p.Read && !p.Write && !p.Owner {
+			return errors.New("key must be granted at least one permission")
+		}
+	}
+
+	if err := ValidateLifecycleRules(template.LifecycleRules); err != nil {
+		return fmt.Errorf("lifecycle: %w", err)
+	}
+
+	return nil
+}
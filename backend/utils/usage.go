@@ -0,0 +1,383 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"khairul169/garage-webui/schema"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// UsageCollector periodically records the usage of every bucket of every
+// cluster in an embedded time-series database. Samples are kept at three
+// resolutions: raw samples for usageRawRetention, hourly averages for
+// usageHourRetention and daily averages for USAGE_RETENTION.
+type UsageCollector struct {
+	db        *bolt.DB
+	interval  time.Duration
+	retention time.Duration
+}
+
+// usageRecord is a stored point, downsampled points accumulate the samples
+// of their period and are averaged when read.
+type usageRecord struct {
+	Count             int64 `json:"count"`
+	Bytes             int64 `json:"bytes"`
+	Objects           int64 `json:"objects"`
+	UnfinishedUploads int64 `json:"unfinishedUploads"`
+	UnfinishedBytes   int64 `json:"unfinishedBytes"`
+	MaxSize           int64 `json:"maxSize"`
+	MaxObjects        int64 `json:"maxObjects"`
+}
+
+const (
+	usageRawRetention  = 48 * time.Hour
+	usageHourRetention = 90 * 24 * time.Hour
+	usageForecastRange = 30 * 24 * time.Hour
+)
+
+var (
+	usageRawKey  = []byte("raw")
+	usageHourKey = []byte("hour")
+	usageDayKey  = []byte("day")
+)
+
+var ErrUsageDisabled = errors.New("usage history is not enabled")
+
+// Usage is nil unless USAGE_PATH is set.
+var Usage *UsageCollector
+
+func InitUsageCollector() error {
+	path := GetEnv("USAGE_PATH", "")
+	if path == "" {
+		return nil
+	}
+
+	interval, err := time.ParseDuration(GetEnv("USAGE_INTERVAL", "5m"))
+	if err != nil {
+		return err
+	}
+	retention, err := time.ParseDuration(GetEnv("USAGE_RETENTION", "17520h"))
+	if err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return err
+	}
+
+	Usage = &UsageCollector{
+		db:        db,
+		interval:  interval,
+		retention: max(retention, usageHourRetention),
+	}
+
+	go Usage.run()
+
+	return nil
+}
+
+func (u *UsageCollector) run() {
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, cluster := range Clusters.List() {
+			if err := u.collect(cluster); err != nil {
+				log.Printf("Usage: cannot collect cluster %s: %v", cluster.Name, err)
+			}
+		}
+		if err := u.prune(); err != nil {
+			log.Println("Usage: cannot prune history:", err)
+		}
+		<-ticker.C
+	}
+}
+
+// collect records a sample of every bucket of a cluster. The bucket details
+// are fetched fresh, which also refreshes the bucket list cache.
+func (u *UsageCollector) collect(cluster *garage) error {
+	ctx := context.Background()
+
+	buckets, err := cluster.Client().ListBuckets(ctx)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(buckets))
+	for _, bucket := range buckets {
+		ids = append(ids, bucket.ID)
+	}
+	details := cluster.BucketList().fetchDetails(ctx, ids)
+	now := time.Now()
+
+	return u.db.Update(func(tx *bolt.Tx) error {
+		for id, detail := range details {
+			bucket := detail.bucket
+			sample := usageRecord{
+				Count:             1,
+				Bytes:             bucket.Bytes,
+				Objects:           bucket.Objects,
+				UnfinishedUploads: bucket.UnfinishedUploads,
+				UnfinishedBytes:   bucket.UnfinishedMultipartUploadBytes,
+				MaxSize:           bucket.Quotas.MaxSize,
+				MaxObjects:        bucket.Quotas.MaxObjects,
+			}
+
+			b, err := createUsageBucket(tx, getUsageBucketKey(cluster, id))
+			if err != nil {
+				return err
+			}
+			if err := putUsageRecord(b.Bucket(usageRawKey), now, sample); err != nil {
+				return err
+			}
+			if err := addUsageRecord(b.Bucket(usageHourKey), now.Truncate(time.Hour), sample); err != nil {
+				return err
+			}
+			utc := now.UTC()
+			day := time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, time.UTC)
+			if err := addUsageRecord(b.Bucket(usageDayKey), day, sample); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// prune drops the points older than the retention of their resolution, and
+// the history of buckets without any point left.
+func (u *UsageCollector) prune() error {
+	now := time.Now()
+	retentions := map[string]time.Duration{
+		string(usageRawKey):  usageRawRetention,
+		string(usageHourKey): usageHourRetention,
+		string(usageDayKey):  u.retention,
+	}
+
+	return u.db.Update(func(tx *bolt.Tx) error {
+		var empty [][]byte
+
+		err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			points := 0
+			for resolution, retention := range retentions {
+				tier := b.Bucket([]byte(resolution))
+				if tier == nil {
+					continue
+				}
+
+				cutoff := getUsageKey(now.Add(-retention))
+				c := tier.Cursor()
+				for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.First() {
+					if err := c.Delete(); err != nil {
+						return err
+					}
+				}
+				points += tier.Stats().KeyN
+			}
+			if points == 0 {
+				empty = append(empty, append([]byte{}, name...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, name := range empty {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetResolution returns the finest resolution still covering from.
+func (u *UsageCollector) GetResolution(from time.Time) string {
+	age := time.Since(from)
+	switch {
+	case age <= usageRawRetention:
+		return string(usageRawKey)
+	case age <= usageHourRetention:
+		return string(usageHourKey)
+	}
+	return string(usageDayKey)
+}
+
+// History returns the usage points of a bucket, by id, between from and to.
+func (u *UsageCollector) History(cluster *garage, bucketID string, from time.Time, to time.Time, resolution string) ([]schema.UsagePoint, error) {
+	if u == nil {
+		return nil, ErrUsageDisabled
+	}
+
+	switch resolution {
+	case string(usageRawKey), string(usageHourKey), string(usageDayKey):
+	default:
+		return nil, errors.New("invalid resolution, expected raw, hour or day")
+	}
+
+	points := []schema.UsagePoint{}
+	err := u.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(getUsageBucketKey(cluster, bucketID))
+		if b == nil {
+			return nil
+		}
+		tier := b.Bucket([]byte(resolution))
+		if tier == nil {
+			return nil
+		}
+
+		end := getUsageKey(to)
+		c := tier.Cursor()
+		for k, v := c.Seek(getUsageKey(from)); k != nil && bytes.Compare(k, end) <= 0; k, v = c.Next() {
+			var record usageRecord
+			if err := json.Unmarshal(v, &record); err != nil || record.Count == 0 {
+				continue
+			}
+			points = append(points, record.toPoint(time.Unix(int64(binary.BigEndian.Uint64(k)), 0)))
+		}
+		return nil
+	})
+
+	return points, err
+}
+
+// Forecast extrapolates when a bucket will reach its size quota, with a
+// linear regression of its size over the last 30 days.
+func (u *UsageCollector) Forecast(cluster *garage, bucketID string) (*schema.UsageForecast, error) {
+	if u == nil {
+		return nil, ErrUsageDisabled
+	}
+
+	now := time.Now()
+	from := now.Add(-usageForecastRange)
+	points, err := u.History(cluster, bucketID, from, now, string(usageHourKey))
+	if err != nil {
+		return nil, err
+	}
+	if len(points) < 2 {
+		if points, err = u.History(cluster, bucketID, from, now, string(usageRawKey)); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &schema.UsageForecast{Bucket: bucketID, Samples: len(points)}
+	if len(points) == 0 {
+		return res, nil
+	}
+
+	last := points[len(points)-1]
+	res.Bytes = last.Bytes
+	res.MaxSize = last.MaxSize
+	if len(points) < 2 {
+		return res, nil
+	}
+
+	slope := getLinearSlope(points)
+	res.GrowthPerDay = slope * 86400
+
+	if res.MaxSize > 0 {
+		if res.Bytes >= res.MaxSize {
+			res.QuotaReachedAt = &last.Time
+		} else if slope > 0 {
+			eta := last.Time.Add(time.Duration(float64(res.MaxSize-res.Bytes) / slope * float64(time.Second)))
+			res.QuotaReachedAt = &eta
+		}
+	}
+
+	return res, nil
+}
+
+// getLinearSlope returns the least squares slope of bytes over time, in
+// bytes per second.
+func getLinearSlope(points []schema.UsagePoint) float64 {
+	t0 := points[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, p := range points {
+		x := p.Time.Sub(t0).Seconds()
+		y := float64(p.Bytes)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	n := float64(len(points))
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denom
+}
+
+func (r *usageRecord) toPoint(t time.Time) schema.UsagePoint {
+	p := schema.UsagePoint{
+		Time:              t,
+		Bytes:             r.Bytes / r.Count,
+		Objects:           r.Objects / r.Count,
+		UnfinishedUploads: r.UnfinishedUploads / r.Count,
+		UnfinishedBytes:   r.UnfinishedBytes / r.Count,
+		MaxSize:           r.MaxSize,
+		MaxObjects:        r.MaxObjects,
+	}
+	if p.MaxSize > 0 {
+		p.SizeUsage = float64(p.Bytes) / float64(p.MaxSize)
+	}
+	if p.MaxObjects > 0 {
+		p.ObjectsUsage = float64(p.Objects) / float64(p.MaxObjects)
+	}
+	return p
+}
+
+func getUsageBucketKey(cluster *garage, bucketID string) []byte {
+	return []byte(cluster.Name + "/" + bucketID)
+}
+
+func getUsageKey(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(max(t.Unix(), 0)))
+}
+
+func createUsageBucket(tx *bolt.Tx, name []byte) (*bolt.Bucket, error) {
+	b, err := tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, tier := range [][]byte{usageRawKey, usageHourKey, usageDayKey} {
+		if _, err := b.CreateBucketIfNotExists(tier); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func putUsageRecord(b *bolt.Bucket, t time.Time, record usageRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return b.Put(getUsageKey(t), data)
+}
+
+// addUsageRecord adds a sample to the downsampled point of a period.
+func addUsageRecord(b *bolt.Bucket, period time.Time, sample usageRecord) error {
+	var record usageRecord
+	if data := b.Get(getUsageKey(period)); data != nil {
+		json.Unmarshal(data, &record)
+	}
+
+	record.Count += sample.Count
+	record.Bytes += sample.Bytes
+	record.Objects += sample.Objects
+	record.UnfinishedUploads += sample.UnfinishedUploads
+	record.UnfinishedBytes += sample.UnfinishedBytes
+	record.MaxSize = sample.MaxSize
+	record.MaxObjects = sample.MaxObjects
+
+	return putUsageRecord(b, period, record)
+}
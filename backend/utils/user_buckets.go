@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/garageapi"
+	"khairul169/garage-webui/schema"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrBucketCreationNotAllowed = errors.New("bucket creation is not allowed for this user")
+	ErrBucketAllowanceExceeded  = errors.New("bucket allowance exceeded")
+)
+
+// userBucketsMu serializes self-service creations, so concurrent requests
+// cannot exceed an allowance.
+var userBucketsMu sync.Mutex
+
+// CreateUserBucket creates a bucket on behalf of a user, within their bucket
+// allowance, and grants them every permission on it.
+func (g *garage) CreateUserBucket(ctx context.Context, userID string, req *schema.CreateUserBucketRequest) (*schema.Bucket, error) {
+	userBucketsMu.Lock()
+	defer userBucketsMu.Unlock()
+
+	user, err := Users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bucketNameRegex.MatchString(req.Name) {
+		return nil, fmt.Errorf("invalid bucket name %q", req.Name)
+	}
+	if req.MaxSize < 0 || req.MaxObjects < 0 {
+		return nil, errors.New("quotas cannot be negative")
+	}
+
+	if user.Role != schema.RoleAdmin {
+		if err := checkBucketAllowance(user, req); err != nil {
+			return nil, err
+		}
+	}
+
+	client := g.Client()
+	cluster := getPermissionCluster(g)
+
+	var bucket *schema.Bucket
+	saga := &provisionSaga{}
+
+	saga.add("create bucket", func() error {
+		bucket, err = client.CreateBucket(ctx, &schema.CreateBucketRequest{GlobalAlias: &req.Name})
+		return err
+	}, func() error {
+		return client.DeleteBucket(context.Background(), bucket.ID)
+	})
+
+	if req.MaxSize > 0 || req.MaxObjects > 0 {
+		saga.add("set quotas", func() error {
+			quotas := &schema.UpdateBucketQuotas{}
+			if req.MaxSize > 0 {
+				quotas.MaxSize = &req.MaxSize
+			}
+			if req.MaxObjects > 0 {
+				quotas.MaxObjects = &req.MaxObjects
+			}
+			bucket, err = client.UpdateBucket(ctx, bucket.ID, &schema.UpdateBucketRequest{Quotas: quotas})
+			return err
+		}, nil)
+	}
+
+	saga.add("grant user", func() error {
+		return Users.AddBucketPermission(user.ID, &schema.BucketPermission{
+			Cluster:         cluster,
+			BucketID:        bucket.ID,
+			BucketName:      req.Name,
+			Read:            true,
+			Write:           true,
+			Delete:          true,
+			ManageLifecycle: true,
+			ManageCORS:      true,
+			ManageWebsite:   true,
+			DeleteBucket:    true,
+			Owned:           true,
+		})
+	}, func() error {
+		return Users.RemoveBucketPermission(user.ID, cluster, bucket.ID)
+	})
+
+	saga.add("sync access key", func() error {
+		return SyncUserKeyByID(ctx, user.ID)
+	}, nil)
+
+	err = saga.execute()
+	g.BucketList().InvalidateList()
+	if err != nil {
+		return nil, err
+	}
+
+	return bucket, nil
+}
+
+// checkBucketAllowance checks a new bucket against the allowance of a user.
+// Buckets which no longer exist do not count.
+func checkBucketAllowance(user *schema.User, req *schema.CreateUserBucketRequest) error {
+	allowance := user.BucketAllowance
+	if allowance == nil || allowance.MaxBuckets <= 0 {
+		return ErrBucketCreationNotAllowed
+	}
+
+	prefix := strings.ReplaceAll(allowance.NamePrefix, "{username}", user.Username)
+	if !strings.HasPrefix(req.Name, prefix) {
+		return fmt.Errorf("bucket name must start with %q", prefix)
+	}
+	if allowance.MaxTotalSize > 0 && req.MaxSize <= 0 {
+		return errors.New("max_size is required")
+	}
+
+	count := 0
+	var totalSize int64
+	for _, perm := range user.BucketPermissions {
+		if !perm.Owned {
+			continue
+		}
+
+		cluster, err := Clusters.Get(perm.Cluster)
+		if err != nil {
+			continue
+		}
+		bucket, err := cluster.GetBucketInfo(perm.BucketID)
+		if garageapi.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		count++
+		totalSize += bucket.Quotas.MaxSize
+	}
+
+	if count >= allowance.MaxBuckets {
+		return fmt.Errorf("%w: at most %d buckets", ErrBucketAllowanceExceeded, allowance.MaxBuckets)
+	}
+	if allowance.MaxTotalSize > 0 && totalSize+req.MaxSize > allowance.MaxTotalSize {
+		return fmt.Errorf("%w: %d bytes of size quota left", ErrBucketAllowanceExceeded, max(allowance.MaxTotalSize-totalSize, 0))
+	}
+
+	return nil
+}
+
+// DeleteBucket deletes an empty bucket, by id or alias, and revokes the
+// permissions granted on it.
+func (g *garage) DeleteBucket(ctx context.Context, bucket string) error {
+	info, err := g.GetBucketInfo(bucket)
+	if err != nil {
+		return err
+	}
+
+	if err := g.Client().DeleteBucket(ctx, info.ID); err != nil {
+		return err
+	}
+
+	g.S3Clients().InvalidateBucket(info.ID)
+	g.BucketList().Invalidate(info.ID)
+
+	return Users.RevokeBucket(getPermissionCluster(g), info.ID)
+}
@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"khairul169/garage-webui/schema"
+)
+
+// LinkUserKey links an existing Garage access key to a user.
+func LinkUserKey(ctx context.Context, user *schema.User, accessKeyID string) (*schema.User, error) {
+	key, err := getKeyInfo(ctx, accessKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get key: %w", err)
+	}
+
+	if err := RevokeUserKey(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return Users.SetAccessKey(user.ID, key.AccessKeyID, false)
+}
+
+// ProvisionUserKey creates a dedicated access key for a user with bucket
+// permissions mirroring the user's BucketPermissions.
+func ProvisionUserKey(ctx context.Context, user *schema.User) (*schema.User, error) {
+	if err := RevokeUserKey(ctx, user); err != nil {
+		return nil, err
+	}
+
+	key, err := createKey(ctx, "webui-user-"+user.Username)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create key: %w", err)
+	}
+
+	user, err = Users.SetAccessKey(user.ID, key.AccessKeyID, true)
+	if err != nil {
+		deleteKey(context.WithoutCancel(ctx), key.AccessKeyID)
+		return nil, err
+	}
+
+	return user, SyncUserKey(ctx, user)
+}
+
+// RevokeUserKey unlinks the access key of a user, deleting it when it was
+// provisioned by the WebUI.
+func RevokeUserKey(ctx context.Context, user *schema.User) error {
+	if user.AccessKeyID == "" {
+		return nil
+	}
+
+	if user.AccessKeyManaged {
+		if err := deleteKey(ctx, user.AccessKeyID); err != nil {
+			return fmt.Errorf("cannot delete key: %w", err)
+		}
+	}
+
+	S3Clients.InvalidateAccessKey(user.AccessKeyID)
+	_, err := Users.SetAccessKey(user.ID, "", false)
+	return err
+}
+
+// SyncUserKey updates the bucket permissions of a provisioned key to match
+// the user's BucketPermissions. Linked keys are managed by the admin. A "*"
+// grant covers the buckets existing at the time of the sync, buckets created
+// later are added on the next sync of the user.
+func SyncUserKey(ctx context.Context, user *schema.User) error {
+	if user.AccessKeyID == "" || !user.AccessKeyManaged {
+		return nil
+	}
+
+	desired, err := getUserKeyPermissions(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	key, err := getKeyInfo(ctx, user.AccessKeyID)
+	if err != nil {
+		return err
+	}
+
+	current := map[string]schema.Permissions{}
+	for _, bucket := range key.Buckets {
+		current[bucket.ID] = bucket.Permissions
+	}
+
+	for bucketID, perm := range desired {
+		if current[bucketID] == perm {
+			continue
+		}
+		if err := allowBucketKey(ctx, bucketID, key.AccessKeyID, perm); err != nil {
+			return err
+		}
+		revoked := schema.Permissions{
+			Read:  current[bucketID].Read && !perm.Read,
+			Write: current[bucketID].Write && !perm.Write,
+			Owner: current[bucketID].Owner && !perm.Owner,
+		}
+		if revoked != (schema.Permissions{}) {
+			if err := denyBucketKey(ctx, bucketID, key.AccessKeyID, revoked); err != nil {
+				return err
+			}
+		}
+	}
+
+	for bucketID, perm := range current {
+		if _, ok := desired[bucketID]; !ok {
+			if err := denyBucketKey(ctx, bucketID, key.AccessKeyID, perm); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SyncUserKeyByID updates the provisioned key of a user after a change of
+// their bucket permissions.
+func SyncUserKeyByID(ctx context.Context, id string) error {
+	user, err := Users.GetByID(id)
+	if err != nil {
+		return err
+	}
+	return SyncUserKey(ctx, user)
+}
+
+// getUserKeyPermissions maps the user's BucketPermissions to Garage key
+// permissions, indexed by bucket id.
+func getUserKeyPermissions(ctx context.Context, user *schema.User) (map[string]schema.Permissions, error) {
+	res := map[string]schema.Permissions{}
+	perms := user.BucketPermissions
+
+	// Admins have access to every bucket
+	if user.Role == schema.RoleAdmin {
+		perms = []*schema.BucketPermission{{BucketName: "*", Read: true, Write: true, ManageLifecycle: true, ManageCORS: true}}
+	}
+
+	for _, perm := range perms {
+		// User keys are created in the default cluster
+		if !matchesCluster(perm, Garage) {
+			continue
+		}
+
+		keyPerm := schema.Permissions{
+			Read:  perm.Read,
+			Write: perm.Write || perm.Delete,
+			Owner: perm.ManageLifecycle || perm.ManageCORS || perm.DeleteBucket,
+		}
+
+		var ids []string
+		if perm.BucketName == "*" {
+			buckets, err := Garage.Client().ListBuckets(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, bucket := range buckets {
+				ids = append(ids, bucket.ID)
+			}
+		} else if perm.BucketID != "" {
+			ids = append(ids, perm.BucketID)
+		} else {
+			bucket, err := GetBucketInfo(perm.BucketName)
+			if err != nil {
+				return nil, fmt.Errorf("cannot get bucket %s: %w", perm.BucketName, err)
+			}
+			ids = append(ids, bucket.ID)
+		}
+
+		for _, id := range ids {
+			p := res[id]
+			res[id] = schema.Permissions{
+				Read:  p.Read || keyPerm.Read,
+				Write: p.Write || keyPerm.Write,
+				Owner: p.Owner || keyPerm.Owner,
+			}
+		}
+	}
+
+	for id, perm := range res {
+		if perm == (schema.Permissions{}) {
+			delete(res, id)
+		}
+	}
+
+	return res, nil
+}
@@ -3,214 +3,106 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"khairul169/garage-webui/schema"
-	"os"
-	"sync"
+	"slices"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-type UserStore struct {
-	mu    sync.RWMutex
-	users map[string]*schema.User
-	file  string
+// UserStore holds the WebUI users and their bucket permissions. It is
+// backed by a JSON file or a SQLite database, selected by USER_STORE.
+type UserStore interface {
+	GetAll() []*schema.User
+	GetByID(id string) (*schema.User, error)
+	GetByUsername(username string) (*schema.User, error)
+	Create(req *schema.CreateUserRequest) (*schema.User, error)
+	Update(id string, req *schema.UpdateUserRequest) (*schema.User, error)
+	Delete(id string) error
+	ValidateCredentials(username, password string) (*schema.User, error)
+
+	// SetAccessKey links a Garage access key to a user, an empty id unlinks it.
+	SetAccessKey(id string, accessKeyID string, managed bool) (*schema.User, error)
+
+	// AddBucketPermission grants a resolved bucket permission to a user.
+	AddBucketPermission(id string, perm *schema.BucketPermission) error
+	// SetBucketPermission grants a resolved bucket permission to a user,
+	// replacing their grant on the same bucket.
+	SetBucketPermission(id string, perm *schema.BucketPermission) error
+	// RemoveBucketPermission revokes the permissions of a user on a bucket,
+	// by cluster and bucket id, "*" revokes the grant on every bucket.
+	RemoveBucketPermission(id string, cluster string, bucketID string) error
+	// RevokeBucket removes the grants of every user on a deleted bucket.
+	RevokeBucket(cluster string, bucketID string) error
+	// MigrateBucketPermissions binds name based grants to bucket ids and
+	// refreshes the display alias of id based grants. Grants of buckets
+	// that cannot be resolved are kept as is.
+	MigrateBucketPermissions() error
+
+	// HasBucketPermission checks if user has any permission for a bucket of
+	// a cluster.
+	HasBucketPermission(cluster *garage, userID, bucket string) bool
+	// HasListedBucketPermission checks if user has any permission for a
+	// bucket of a ListBuckets response, without fetching the bucket info.
+	HasListedBucketPermission(cluster *garage, userID string, bucket *schema.GetBucketsRes) bool
+	// HasBucketPermissionDetailed checks if user has specific permission for
+	// a bucket.
+	HasBucketPermissionDetailed(cluster *garage, userID, bucket, action string) bool
 }
 
-var Users *UserStore
+var Users UserStore
 
+// InitUserStore opens the user store, and creates the default admin when
+// there are no users.
 func InitUserStore() error {
-	store := &UserStore{
-		users: make(map[string]*schema.User),
-		file:  "users.json",
-	}
-
-	// Load users from file
-	if err := store.load(); err != nil && !os.IsNotExist(err) {
+	if err := OpenUserStore(); err != nil {
 		return err
 	}
 
 	// Create default admin if no users exist
-	if len(store.users) == 0 {
-		adminPass := GetEnv("ADMIN_PASSWORD", "admin")
-		hash, err := bcrypt.GenerateFromPassword([]byte(adminPass), bcrypt.DefaultCost)
-		if err != nil {
+	if len(Users.GetAll()) == 0 {
+		_, err := Users.Create(&schema.CreateUserRequest{
+			Username: "admin",
+			Password: GetEnv("ADMIN_PASSWORD", "admin"),
+			Role:     schema.RoleAdmin,
+		})
+		// Another process may have created it meanwhile
+		if err != nil && len(Users.GetAll()) == 0 {
 			return err
 		}
-
-		id, _ := generateID()
-		admin := &schema.User{
-			ID:           id,
-			Username:     "admin",
-			PasswordHash: string(hash),
-			Role:         schema.RoleAdmin,
-			CreatedAt:    time.Now(),
-			UpdatedAt:    time.Now(),
-			BucketPermissions: []*schema.BucketPermission{},
-		}
-		store.users[id] = admin
-		store.save()
 	}
 
-	Users = store
 	return nil
 }
 
-func (s *UserStore) load() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	data, err := os.ReadFile(s.file)
-	if err != nil {
-		return err
-	}
-
-	// First try to unmarshal with new format
-	var users []*schema.User
-	if err := json.Unmarshal(data, &users); err != nil {
-		// If failed, try legacy format and migrate
-		var legacyUsers []map[string]interface{}
-		if err := json.Unmarshal(data, &legacyUsers); err != nil {
-			return err
-		}
-
-		// Convert legacy format to new format
-		for _, legacyUser := range legacyUsers {
-			user := &schema.User{
-				ID:           legacyUser["id"].(string),
-				Username:     legacyUser["username"].(string),
-				PasswordHash: legacyUser["password_hash"].(string),
-				Role:         schema.UserRole(legacyUser["role"].(string)),
-			}
-
-			// Parse timestamps
-			if createdAt, ok := legacyUser["created_at"].(string); ok {
-				if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
-					user.CreatedAt = t
-				}
-			}
-			if updatedAt, ok := legacyUser["updated_at"].(string); ok {
-				if t, err := time.Parse(time.RFC3339, updatedAt); err == nil {
-					user.UpdatedAt = t
-				}
-			}
-
-			// Convert old bucket_permissions (string array) to new format (object array)
-			user.BucketPermissions = []*schema.BucketPermission{}
-			if perms, ok := legacyUser["bucket_permissions"].([]interface{}); ok {
-				for _, perm := range perms {
-					if bucketName, ok := perm.(string); ok {
-						// Create permission with all rights for existing permissions
-						user.BucketPermissions = append(user.BucketPermissions, &schema.BucketPermission{
-							BucketName:      bucketName,
-							Read:            true,
-							Write:           true,
-							Delete:          true,
-							ManageLifecycle: true,
-							DeleteBucket:    false, // Don't grant delete bucket by default
-						})
-					}
-				}
-			}
-
-			users = append(users, user)
-		}
-	}
-
-	needsSave := false
-	for _, user := range users {
-		// If user doesn't have password hash, set default password
-		if user.PasswordHash == "" {
-			defaultPass := "admin"
-			if user.Username != "admin" {
-				defaultPass = user.Username
-			}
-			hash, err := bcrypt.GenerateFromPassword([]byte(defaultPass), bcrypt.DefaultCost)
-			if err != nil {
-				return err
-			}
-			user.PasswordHash = string(hash)
-			needsSave = true
-		}
-
-		// Ensure BucketPermissions is initialized
-		if user.BucketPermissions == nil {
-			user.BucketPermissions = []*schema.BucketPermission{}
-			needsSave = true
-		}
-
-		s.users[user.ID] = user
-	}
+// OpenUserStore opens the user store of USER_STORE as is.
+func OpenUserStore() error {
+	var err error
 
-	// Save if we migrated or added password hashes
-	if needsSave {
-		s.save()
+	switch store := GetEnv("USER_STORE", "json"); store {
+	case "json":
+		Users, err = NewJSONUserStore(GetUsersPath())
+	case "sqlite":
+		Users, err = NewSQLiteUserStore(GetEnv("USERS_DB_PATH", "users.db"))
+	default:
+		err = fmt.Errorf("invalid USER_STORE %q, must be json or sqlite", store)
 	}
-
-	return nil
-}
-
-func (s *UserStore) save() error {
-	users := make([]*schema.User, 0, len(s.users))
-	for _, user := range s.users {
-		users = append(users, user)
-	}
-
-	data, err := json.MarshalIndent(users, "", "  ")
 	if err != nil {
-		return err
+		Users = nil
 	}
-
-	return os.WriteFile(s.file, data, 0644)
+	return err
 }
 
-func (s *UserStore) GetAll() []*schema.User {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	users := make([]*schema.User, 0, len(s.users))
-	for _, user := range s.users {
-		users = append(users, user)
-	}
-	return users
+// GetUsersPath returns the path of the JSON users file, which is also
+// imported once by the SQLite store.
+func GetUsersPath() string {
+	return GetEnv("USERS_PATH", "users.json")
 }
 
-func (s *UserStore) GetByID(id string) (*schema.User, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	user, ok := s.users[id]
-	if !ok {
-		return nil, errors.New("user not found")
-	}
-	return user, nil
-}
-
-func (s *UserStore) GetByUsername(username string) (*schema.User, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	for _, user := range s.users {
-		if user.Username == username {
-			return user, nil
-		}
-	}
-	return nil, errors.New("user not found")
-}
-
-func (s *UserStore) Create(req *schema.CreateUserRequest) (*schema.User, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Check if username exists
-	for _, user := range s.users {
-		if user.Username == req.Username {
-			return nil, errors.New("username already exists")
-		}
-	}
-
+// newUser returns the user of a creation request, with a hashed password.
+func newUser(req *schema.CreateUserRequest) (*schema.User, error) {
 	// Hash password
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -223,39 +115,30 @@ func (s *UserStore) Create(req *schema.CreateUserRequest) (*schema.User, error)
 	}
 
 	user := &schema.User{
-		ID:           id,
-		Username:     req.Username,
-		PasswordHash: string(hash),
-		Role:         req.Role,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+		ID:                id,
+		Username:          req.Username,
+		PasswordHash:      string(hash),
+		Role:              req.Role,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
 		BucketPermissions: req.BucketPermissions,
+		BucketAllowance:   req.BucketAllowance,
 	}
 
 	if user.BucketPermissions == nil {
 		user.BucketPermissions = []*schema.BucketPermission{}
 	}
 
-	s.users[id] = user
-	s.save()
-
 	return user, nil
 }
 
-func (s *UserStore) Update(id string, req *schema.UpdateUserRequest) (*schema.User, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	user, ok := s.users[id]
-	if !ok {
-		return nil, errors.New("user not found")
-	}
-
+// updateUser applies the fields set in an update request to a user.
+func updateUser(user *schema.User, req *schema.UpdateUserRequest) error {
 	// Update password if provided
 	if req.Password != "" {
 		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		user.PasswordHash = string(hash)
 	}
@@ -270,42 +153,66 @@ func (s *UserStore) Update(id string, req *schema.UpdateUserRequest) (*schema.Us
 		user.BucketPermissions = req.BucketPermissions
 	}
 
-	user.UpdatedAt = time.Now()
-	s.save()
+	// Update bucket allowance if provided, a zero allowance removes it
+	if req.BucketAllowance != nil {
+		user.BucketAllowance = req.BucketAllowance
+		if req.BucketAllowance.MaxBuckets <= 0 {
+			user.BucketAllowance = nil
+		}
+	}
 
-	return user, nil
+	user.UpdatedAt = time.Now()
+	return nil
 }
 
-func (s *UserStore) Delete(id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// demotesAdmin reports whether an update removes the admin role of a user.
+func demotesAdmin(user *schema.User, req *schema.UpdateUserRequest) bool {
+	return user.Role == schema.RoleAdmin && req.Role != "" && req.Role != schema.RoleAdmin
+}
 
-	user, ok := s.users[id]
-	if !ok {
-		return errors.New("user not found")
-	}
+func setBucketPermission(user *schema.User, perm *schema.BucketPermission) {
+	user.BucketPermissions = slices.DeleteFunc(user.BucketPermissions, func(p *schema.BucketPermission) bool {
+		return p.Cluster == perm.Cluster && getPermissionRef(p) == getPermissionRef(perm)
+	})
+	grant := *perm
+	user.BucketPermissions = append(user.BucketPermissions, &grant)
+	user.UpdatedAt = time.Now()
+}
 
-	// Prevent deleting the last admin
-	if user.Role == schema.RoleAdmin {
-		adminCount := 0
-		for _, u := range s.users {
-			if u.Role == schema.RoleAdmin {
-				adminCount++
-			}
-		}
-		if adminCount <= 1 {
-			return errors.New("cannot delete the last admin user")
+// removeBucketPermission removes the grants of a user on a bucket, or on
+// every bucket for "*", and reports whether there were any.
+func removeBucketPermission(user *schema.User, cluster string, bucketID string) bool {
+	n := len(user.BucketPermissions)
+	user.BucketPermissions = slices.DeleteFunc(user.BucketPermissions, func(perm *schema.BucketPermission) bool {
+		if bucketID == "*" {
+			return perm.Cluster == cluster && perm.BucketName == "*"
 		}
+		return perm.Cluster == cluster && perm.BucketID == bucketID
+	})
+	if len(user.BucketPermissions) == n {
+		return false
 	}
+	user.UpdatedAt = time.Now()
+	return true
+}
 
-	delete(s.users, id)
-	s.save()
-
-	return nil
+// copyUser returns a deep copy of a user, so callers can't modify or race
+// with the user held by a store.
+func copyUser(user *schema.User) *schema.User {
+	c := *user
+	c.BucketPermissions = make([]*schema.BucketPermission, len(user.BucketPermissions))
+	for i, perm := range user.BucketPermissions {
+		p := *perm
+		c.BucketPermissions[i] = &p
+	}
+	if user.BucketAllowance != nil {
+		allowance := *user.BucketAllowance
+		c.BucketAllowance = &allowance
+	}
+	return &c
 }
 
-func (s *UserStore) ValidateCredentials(username, password string) (*schema.User, error) {
-	user, err := s.GetByUsername(username)
+func validateCredentials(user *schema.User, err error, password string) (*schema.User, error) {
 	if err != nil {
 		return nil, errors.New("invalid username or password")
 	}
@@ -317,40 +224,9 @@ func (s *UserStore) ValidateCredentials(username, password string) (*schema.User
 	return user, nil
 }
 
-func (s *UserStore) HasBucketPermission(userID, bucket string) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	user, ok := s.users[userID]
-	if !ok {
-		return false
-	}
-
-	// Admin has access to all buckets
-	if user.Role == schema.RoleAdmin {
-		return true
-	}
-
-	// Check if user has permission for this bucket
-	for _, perm := range user.BucketPermissions {
-		if perm.BucketName == bucket || perm.BucketName == "*" {
-			return true
-		}
-	}
-
-	return false
-}
-
-// HasBucketPermissionDetailed checks if user has specific permission for a bucket
-func (s *UserStore) HasBucketPermissionDetailed(userID, bucket, action string) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	user, ok := s.users[userID]
-	if !ok {
-		return false
-	}
-
+// hasUserBucketPermission checks if user has a permission for a bucket, or
+// any permission when action is empty.
+func hasUserBucketPermission(user *schema.User, cluster *garage, bucket string, info *schema.Bucket, action string) bool {
 	// Admin has full access to all buckets
 	if user.Role == schema.RoleAdmin {
 		return true
@@ -358,8 +234,10 @@ func (s *UserStore) HasBucketPermissionDetailed(userID, bucket, action string) b
 
 	// Check if user has specific permission for this bucket
 	for _, perm := range user.BucketPermissions {
-		if perm.BucketName == bucket || perm.BucketName == "*" {
+		if matchBucketPermission(perm, cluster, bucket, info) {
 			switch action {
+			case "":
+				return true
 			case "read":
 				return perm.Read
 			case "write":
@@ -368,6 +246,10 @@ func (s *UserStore) HasBucketPermissionDetailed(userID, bucket, action string) b
 				return perm.Delete
 			case "manage_lifecycle":
 				return perm.ManageLifecycle
+			case "manage_cors":
+				return perm.ManageCORS
+			case "manage_website":
+				return perm.ManageWebsite
 			case "delete_bucket":
 				return perm.DeleteBucket
 			default:
@@ -379,6 +261,167 @@ func (s *UserStore) HasBucketPermissionDetailed(userID, bucket, action string) b
 	return false
 }
 
+// getBucketPermissionRefs resolves the buckets of the grants of users, by
+// cluster and bucket reference. Buckets that cannot be resolved are nil.
+func getBucketPermissionRefs(users []*schema.User) (map[string]*schema.Bucket, []error) {
+	refs := map[string]*schema.Bucket{}
+	var errs []error
+
+	for _, user := range users {
+		for _, perm := range user.BucketPermissions {
+			ref := getPermissionRef(perm)
+			if perm.BucketName == "*" || ref == "" {
+				continue
+			}
+			if _, ok := refs[perm.Cluster+"/"+ref]; ok {
+				continue
+			}
+
+			cluster, err := Clusters.Get(perm.Cluster)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("cannot resolve bucket %s of cluster %s: %w", ref, perm.Cluster, err))
+				refs[perm.Cluster+"/"+ref] = nil
+				continue
+			}
+
+			bucket, err := cluster.GetBucketInfo(ref)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("cannot resolve bucket %s: %w", ref, err))
+			}
+			refs[perm.Cluster+"/"+ref] = bucket
+		}
+	}
+
+	return refs, errs
+}
+
+// bindBucketPermissions binds the grants of a user to the resolved buckets,
+// and reports whether any changed.
+func bindBucketPermissions(user *schema.User, refs map[string]*schema.Bucket) bool {
+	changed := false
+	for _, perm := range user.BucketPermissions {
+		bucket := refs[perm.Cluster+"/"+getPermissionRef(perm)]
+		if bucket == nil {
+			continue
+		}
+
+		name := GetBucketDisplayName(bucket)
+		if perm.BucketID != bucket.ID || perm.BucketName != name {
+			perm.BucketID = bucket.ID
+			perm.BucketName = name
+			changed = true
+		}
+	}
+	return changed
+}
+
+// ResolveBucketPermissions binds each grant to the id of the bucket it
+// refers to, either by bucket_id or by bucket_name (id or alias), in the
+// cluster of the grant.
+func ResolveBucketPermissions(perms []*schema.BucketPermission) error {
+	for _, perm := range perms {
+		if perm.Cluster == Garage.Name {
+			perm.Cluster = ""
+		}
+
+		if perm.BucketName == "*" {
+			perm.BucketID = ""
+			continue
+		}
+		if perm.Cluster == "*" {
+			return errors.New("bucket permissions on every cluster require bucket *")
+		}
+
+		ref := getPermissionRef(perm)
+		if ref == "" {
+			return errors.New("bucket permission requires a bucket")
+		}
+
+		cluster, err := Clusters.Get(perm.Cluster)
+		if err != nil {
+			return fmt.Errorf("cluster %s: %w", perm.Cluster, err)
+		}
+
+		bucket, err := cluster.GetBucketInfo(ref)
+		if err != nil {
+			return fmt.Errorf("bucket %s not found: %w", ref, err)
+		}
+		perm.BucketID = bucket.ID
+		perm.BucketName = GetBucketDisplayName(bucket)
+	}
+	return nil
+}
+
+// GetBucketDisplayName returns the first global alias of a bucket, then the
+// first local alias, then its id.
+func GetBucketDisplayName(bucket *schema.Bucket) string {
+	if len(bucket.GlobalAliases) > 0 {
+		return bucket.GlobalAliases[0]
+	}
+	for _, key := range bucket.Keys {
+		if len(key.BucketLocalAliases) > 0 {
+			return key.BucketLocalAliases[0]
+		}
+	}
+	return bucket.ID
+}
+
+func getPermissionRef(perm *schema.BucketPermission) string {
+	if perm.BucketID != "" {
+		return perm.BucketID
+	}
+	return perm.BucketName
+}
+
+// resolveBucket returns the info of a bucket id or alias, or nil if it
+// cannot be resolved.
+func resolveBucket(cluster *garage, bucket string) *schema.Bucket {
+	if bucket == "" || bucket == "*" {
+		return nil
+	}
+	info, err := cluster.GetBucketInfo(bucket)
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// getPermissionCluster returns the cluster of a grant on a cluster, empty for
+// the default cluster.
+func getPermissionCluster(cluster *garage) string {
+	if cluster.IsDefault() {
+		return ""
+	}
+	return cluster.Name
+}
+
+// matchesCluster reports whether a grant applies to a cluster, grants
+// without a cluster apply to the default cluster.
+func matchesCluster(perm *schema.BucketPermission, cluster *garage) bool {
+	switch perm.Cluster {
+	case "*":
+		return true
+	case "":
+		return cluster.IsDefault()
+	}
+	return perm.Cluster == cluster.Name
+}
+
+// matchBucketPermission reports whether a grant applies to a bucket. Grants
+// bound to an id only match that id, legacy grants match by global alias.
+func matchBucketPermission(perm *schema.BucketPermission, cluster *garage, bucket string, info *schema.Bucket) bool {
+	if !matchesCluster(perm, cluster) {
+		return false
+	}
+	if perm.BucketName == "*" {
+		return true
+	}
+	if perm.BucketID != "" {
+		return perm.BucketID == bucket || (info != nil && perm.BucketID == info.ID)
+	}
+	return perm.BucketName == bucket || (info != nil && slices.Contains(info.GlobalAliases, perm.BucketName))
+}
+
 func generateID() (string, error) {
 	b := make([]byte, 16)
 	if _, err := rand.Read(b); err != nil {
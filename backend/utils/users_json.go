@@ -0,0 +1,610 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/flock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// usersRefreshInterval limits how often reads check whether the users file
+// was changed by another process, e.g. the CLI.
+const usersRefreshInterval = time.Second
+
+// JSONUserStore holds the users in a JSON file. Changes are written
+// atomically under a lock of the file shared with other processes, and the
+// previous versions are kept as rotating backups (USERS_BACKUPS, 5 by
+// default).
+type JSONUserStore struct {
+	mu       sync.RWMutex
+	users    map[string]*schema.User
+	file     string
+	fileLock *flock.Flock
+	backups  int
+	info     os.FileInfo  // Of the file when last loaded or saved
+	checked  atomic.Int64 // Time of the last check for external changes, in unix nanoseconds
+}
+
+func NewJSONUserStore(file string) (*JSONUserStore, error) {
+	backups, err := strconv.Atoi(GetEnv("USERS_BACKUPS", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid USERS_BACKUPS: %w", err)
+	}
+
+	store := &JSONUserStore{
+		users:    make(map[string]*schema.User),
+		file:     file,
+		fileLock: flock.New(file + ".lock"),
+		backups:  backups,
+	}
+
+	// Load users from file
+	if err := store.load(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *JSONUserStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.fileLock.Lock(); err != nil {
+		return fmt.Errorf("cannot lock %s: %w", s.file, err)
+	}
+	defer s.fileLock.Unlock()
+
+	data, err := s.reload()
+	if err != nil || data == nil {
+		return err
+	}
+
+	// Keep a copy of a legacy file before it is converted
+	if _, legacy, _ := parseUsers(data); legacy {
+		log.Printf("Converting the legacy users file %s, a copy is kept in %s.legacy", s.file, s.file)
+		if err := os.WriteFile(s.file+".legacy", data, 0600); err != nil {
+			return err
+		}
+	}
+
+	// Save if we migrated or added password hashes
+	return s.save()
+}
+
+// reload replaces the users with the content of the file. It returns the
+// content when it must be saved again, e.g. once converted from the legacy
+// format. The caller must hold the write lock.
+func (s *JSONUserStore) reload() ([]byte, error) {
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return nil, err
+	}
+
+	users, needsSave, err := parseUsers(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", s.file, err)
+	}
+
+	for _, user := range users {
+		// If user doesn't have password hash, set default password
+		if user.PasswordHash == "" {
+			defaultPass := "admin"
+			if user.Username != "admin" {
+				defaultPass = user.Username
+			}
+			hash, err := bcrypt.GenerateFromPassword([]byte(defaultPass), bcrypt.DefaultCost)
+			if err != nil {
+				return nil, err
+			}
+			user.PasswordHash = string(hash)
+			needsSave = true
+		}
+
+		// Ensure BucketPermissions is initialized
+		if user.BucketPermissions == nil {
+			user.BucketPermissions = []*schema.BucketPermission{}
+			needsSave = true
+		}
+	}
+
+	s.users = make(map[string]*schema.User, len(users))
+	for _, user := range users {
+		s.users[user.ID] = user
+	}
+	s.info = info
+
+	if needsSave {
+		return data, nil
+	}
+	return nil, nil
+}
+
+// parseUsers decodes a users file, converting the legacy format where bucket
+// permissions are a list of bucket names.
+func parseUsers(data []byte) ([]*schema.User, bool, error) {
+	// First try to unmarshal with new format
+	var users []*schema.User
+	if err := json.Unmarshal(data, &users); err == nil {
+		return users, false, nil
+	}
+
+	// If failed, try legacy format and migrate
+	var legacyUsers []map[string]interface{}
+	if err := json.Unmarshal(data, &legacyUsers); err != nil {
+		return nil, false, err
+	}
+
+	// Convert legacy format to new format
+	for _, legacyUser := range legacyUsers {
+		user := &schema.User{}
+		user.ID, _ = legacyUser["id"].(string)
+		user.Username, _ = legacyUser["username"].(string)
+		user.PasswordHash, _ = legacyUser["password_hash"].(string)
+		if role, ok := legacyUser["role"].(string); ok {
+			user.Role = schema.UserRole(role)
+		}
+		if user.ID == "" || user.Username == "" {
+			return nil, false, errors.New("invalid legacy user: id and username are required")
+		}
+
+		// Parse timestamps
+		if createdAt, ok := legacyUser["created_at"].(string); ok {
+			if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+				user.CreatedAt = t
+			}
+		}
+		if updatedAt, ok := legacyUser["updated_at"].(string); ok {
+			if t, err := time.Parse(time.RFC3339, updatedAt); err == nil {
+				user.UpdatedAt = t
+			}
+		}
+
+		// Convert old bucket_permissions (string array) to new format (object array)
+		user.BucketPermissions = []*schema.BucketPermission{}
+		if perms, ok := legacyUser["bucket_permissions"].([]interface{}); ok {
+			for _, perm := range perms {
+				if bucketName, ok := perm.(string); ok {
+					// Create permission with all rights for existing permissions
+					user.BucketPermissions = append(user.BucketPermissions, &schema.BucketPermission{
+						BucketName:      bucketName,
+						Read:            true,
+						Write:           true,
+						Delete:          true,
+						ManageLifecycle: true,
+						DeleteBucket:    false, // Don't grant delete bucket by default
+					})
+				}
+			}
+		}
+
+		users = append(users, user)
+	}
+
+	return users, true, nil
+}
+
+// IsLegacyUsersFile reports whether the users file has the legacy format.
+func IsLegacyUsersFile() (bool, error) {
+	data, err := os.ReadFile(GetUsersPath())
+	if err != nil {
+		return false, err
+	}
+
+	_, legacy, err := parseUsers(data)
+	return legacy, err
+}
+
+// refresh reloads the users when the file was changed by another process,
+// which replaces it or at least changes its modification time. The caller
+// must hold the write lock.
+func (s *JSONUserStore) refresh() error {
+	s.checked.Store(time.Now().UnixNano())
+
+	info, err := os.Stat(s.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.info != nil && os.SameFile(info, s.info) && info.ModTime().Equal(s.info.ModTime()) && info.Size() == s.info.Size() {
+		return nil
+	}
+	_, err = s.reload()
+	return err
+}
+
+// sync refreshes the users before a read, at most once per interval.
+func (s *JSONUserStore) sync() {
+	if time.Since(time.Unix(0, s.checked.Load())) < usersRefreshInterval {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refresh(); err != nil {
+		log.Println("Cannot reload users!", err)
+	}
+}
+
+// save writes the users, the caller must hold both locks.
+func (s *JSONUserStore) save() error {
+	users := make([]*schema.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := RotateBackups(s.file, s.backups); err != nil {
+		return fmt.Errorf("cannot back up %s: %w", s.file, err)
+	}
+	if err := WriteFileAtomic(s.file, data, 0600); err != nil {
+		return fmt.Errorf("cannot save %s: %w", s.file, err)
+	}
+
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return err
+	}
+	s.info = info
+	return nil
+}
+
+// userTx is a change of the users, holding the lock of the store and the
+// lock of its file. The users are restored when it ends without being
+// saved.
+type userTx struct {
+	s         *JSONUserStore
+	snapshot  []byte
+	committed bool
+}
+
+// begin locks the store and its file, and reloads the users if the file
+// was changed by another process.
+func (s *JSONUserStore) begin() (*userTx, error) {
+	s.mu.Lock()
+	if err := s.fileLock.Lock(); err != nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("cannot lock %s: %w", s.file, err)
+	}
+
+	tx := &userTx{s: s}
+	err := s.refresh()
+	if err == nil {
+		tx.snapshot, err = json.Marshal(s.users)
+	}
+	if err != nil {
+		tx.end()
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (tx *userTx) commit() error {
+	if err := tx.s.save(); err != nil {
+		return err
+	}
+	tx.committed = true
+	return nil
+}
+
+func (tx *userTx) end() {
+	if !tx.committed && tx.snapshot != nil {
+		var users map[string]*schema.User
+		if err := json.Unmarshal(tx.snapshot, &users); err == nil {
+			tx.s.users = users
+		}
+	}
+	tx.s.fileLock.Unlock()
+	tx.s.mu.Unlock()
+}
+
+func (s *JSONUserStore) GetAll() []*schema.User {
+	s.sync()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]*schema.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, copyUser(user))
+	}
+	return users
+}
+
+func (s *JSONUserStore) GetByID(id string) (*schema.User, error) {
+	s.sync()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	return copyUser(user), nil
+}
+
+func (s *JSONUserStore) GetByUsername(username string) (*schema.User, error) {
+	s.sync()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			return copyUser(user), nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (s *JSONUserStore) Create(req *schema.CreateUserRequest) (*schema.User, error) {
+	if err := ResolveBucketPermissions(req.BucketPermissions); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.end()
+
+	// Check if username exists
+	for _, user := range s.users {
+		if user.Username == req.Username {
+			return nil, errors.New("username already exists")
+		}
+	}
+
+	user, err := newUser(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.users[user.ID] = user
+	if err := tx.commit(); err != nil {
+		return nil, err
+	}
+
+	return copyUser(user), nil
+}
+
+func (s *JSONUserStore) Update(id string, req *schema.UpdateUserRequest) (*schema.User, error) {
+	if err := ResolveBucketPermissions(req.BucketPermissions); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.end()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+
+	// Prevent demoting the last admin
+	if demotesAdmin(user, req) && s.countAdmins() <= 1 {
+		return nil, errors.New("cannot demote the last admin user")
+	}
+
+	if err := updateUser(user, req); err != nil {
+		return nil, err
+	}
+	if err := tx.commit(); err != nil {
+		return nil, err
+	}
+
+	return copyUser(user), nil
+}
+
+// SetAccessKey links a Garage access key to a user, an empty id unlinks it.
+func (s *JSONUserStore) SetAccessKey(id string, accessKeyID string, managed bool) (*schema.User, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.end()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+
+	user.AccessKeyID = accessKeyID
+	user.AccessKeyManaged = managed && accessKeyID != ""
+	user.UpdatedAt = time.Now()
+	if err := tx.commit(); err != nil {
+		return nil, err
+	}
+
+	return copyUser(user), nil
+}
+
+// AddBucketPermission grants a resolved bucket permission to a user.
+func (s *JSONUserStore) AddBucketPermission(id string, perm *schema.BucketPermission) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.end()
+
+	user, ok := s.users[id]
+	if !ok {
+		return errors.New("user not found")
+	}
+
+	p := *perm
+	user.BucketPermissions = append(user.BucketPermissions, &p)
+	user.UpdatedAt = time.Now()
+	return tx.commit()
+}
+
+// SetBucketPermission grants a resolved bucket permission to a user,
+// replacing their grant on the same bucket.
+func (s *JSONUserStore) SetBucketPermission(id string, perm *schema.BucketPermission) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.end()
+
+	user, ok := s.users[id]
+	if !ok {
+		return errors.New("user not found")
+	}
+
+	setBucketPermission(user, perm)
+	return tx.commit()
+}
+
+// RemoveBucketPermission revokes the permissions of a user on a bucket, by
+// cluster and bucket id.
+func (s *JSONUserStore) RemoveBucketPermission(id string, cluster string, bucketID string) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.end()
+
+	user, ok := s.users[id]
+	if !ok {
+		return errors.New("user not found")
+	}
+
+	removeBucketPermission(user, cluster, bucketID)
+	return tx.commit()
+}
+
+// RevokeBucket removes the grants of every user on a deleted bucket.
+func (s *JSONUserStore) RevokeBucket(cluster string, bucketID string) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.end()
+
+	changed := false
+	for _, user := range s.users {
+		if removeBucketPermission(user, cluster, bucketID) {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return tx.commit()
+}
+
+func (s *JSONUserStore) Delete(id string) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.end()
+
+	user, ok := s.users[id]
+	if !ok {
+		return errors.New("user not found")
+	}
+
+	// Prevent deleting the last admin
+	if user.Role == schema.RoleAdmin && s.countAdmins() <= 1 {
+		return errors.New("cannot delete the last admin user")
+	}
+
+	delete(s.users, id)
+	return tx.commit()
+}
+
+func (s *JSONUserStore) countAdmins() int {
+	count := 0
+	for _, user := range s.users {
+		if user.Role == schema.RoleAdmin {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *JSONUserStore) ValidateCredentials(username, password string) (*schema.User, error) {
+	user, err := s.GetByUsername(username)
+	return validateCredentials(user, err, password)
+}
+
+// HasBucketPermission checks if user has any permission for a bucket of a
+// cluster.
+func (s *JSONUserStore) HasBucketPermission(cluster *garage, userID, bucket string) bool {
+	return s.hasBucketPermission(cluster, userID, bucket, resolveBucket(cluster, bucket), "")
+}
+
+// HasListedBucketPermission checks if user has any permission for a bucket
+// of a ListBuckets response, without fetching the bucket info.
+func (s *JSONUserStore) HasListedBucketPermission(cluster *garage, userID string, bucket *schema.GetBucketsRes) bool {
+	info := &schema.Bucket{ID: bucket.ID, GlobalAliases: bucket.GlobalAliases}
+	return s.hasBucketPermission(cluster, userID, bucket.ID, info, "")
+}
+
+func (s *JSONUserStore) hasBucketPermission(cluster *garage, userID string, bucket string, info *schema.Bucket, action string) bool {
+	s.sync()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	return ok && hasUserBucketPermission(user, cluster, bucket, info, action)
+}
+
+// HasBucketPermissionDetailed checks if user has specific permission for a bucket
+func (s *JSONUserStore) HasBucketPermissionDetailed(cluster *garage, userID, bucket, action string) bool {
+	return s.hasBucketPermission(cluster, userID, bucket, resolveBucket(cluster, bucket), action)
+}
+
+// MigrateBucketPermissions binds name based grants to bucket ids and
+// refreshes the display alias of id based grants. Grants of buckets that
+// cannot be resolved are kept as is.
+func (s *JSONUserStore) MigrateBucketPermissions() error {
+	refs, errs := getBucketPermissionRefs(s.GetAll())
+
+	tx, err := s.begin()
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	defer tx.end()
+
+	changed := false
+	for _, user := range s.users {
+		if bindBucketPermissions(user, refs) {
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := tx.commit(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
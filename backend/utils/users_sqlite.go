@@ -0,0 +1,517 @@
+package utils
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"khairul169/garage-webui/schema"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteUserMigrations are applied in order, the version of the database
+// schema is its user_version.
+var sqliteUserMigrations = []string{
+	`CREATE TABLE users (
+		id TEXT PRIMARY KEY,
+		username TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL,
+		access_key_id TEXT NOT NULL DEFAULT '',
+		access_key_managed INTEGER NOT NULL DEFAULT 0,
+		bucket_allowance TEXT
+	);
+	CREATE TABLE bucket_permissions (
+		user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		cluster TEXT NOT NULL DEFAULT '',
+		bucket_id TEXT NOT NULL DEFAULT '',
+		bucket_name TEXT NOT NULL,
+		can_read INTEGER NOT NULL DEFAULT 0,
+		can_write INTEGER NOT NULL DEFAULT 0,
+		can_delete INTEGER NOT NULL DEFAULT 0,
+		manage_lifecycle INTEGER NOT NULL DEFAULT 0,
+		manage_cors INTEGER NOT NULL DEFAULT 0,
+		manage_website INTEGER NOT NULL DEFAULT 0,
+		delete_bucket INTEGER NOT NULL DEFAULT 0,
+		owned INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (user_id, position)
+	);
+	CREATE INDEX bucket_permissions_bucket ON bucket_permissions (cluster, bucket_id);`,
+}
+
+// SQLiteUserStore holds the users in a SQLite database, which can be shared
+// by several processes.
+type SQLiteUserStore struct {
+	db *sql.DB
+}
+
+// querier runs queries on the database or in a transaction.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// NewSQLiteUserStore opens the database, applies the pending migrations and
+// imports the JSON users file when the database has no users yet.
+func NewSQLiteUserStore(path string) (*SQLiteUserStore, error) {
+	params := url.Values{}
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Set("_txlock", "immediate")
+
+	// SQLite creates the -wal and -shm files with the mode of the database
+	if err := restrictSQLiteFiles(path); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	store := &SQLiteUserStore{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot migrate %s: %w", path, err)
+	}
+	if err := store.importJSON(GetUsersPath()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	// The -wal and -shm files of a database created by a previous version
+	if err := restrictSQLiteFiles(path); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// restrictSQLiteFiles creates the database only readable by its owner, and
+// restricts the existing database files as they hold the password hashes.
+func restrictSQLiteFiles(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	for _, file := range []string{path, path + "-wal", path + "-shm"} {
+		if err := os.Chmod(file, 0600); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteUserStore) migrate() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(sqliteUserMigrations) {
+		return fmt.Errorf("schema version %d is newer than this version supports", version)
+	}
+
+	for i := version; i < len(sqliteUserMigrations); i++ {
+		if _, err := tx.Exec(sqliteUserMigrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(sqliteUserMigrations))); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// importJSON copies the users of a JSON users file into an empty database.
+// The file is then renamed with the .migrated extension, so the import only
+// happens once.
+func (s *SQLiteUserStore) importJSON(file string) error {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	store, err := NewJSONUserStore(file)
+	if err != nil {
+		return fmt.Errorf("cannot import %s: %w", file, err)
+	}
+	users := store.GetAll()
+	for _, user := range users {
+		if err := writeSQLiteUser(tx, user); err != nil {
+			return fmt.Errorf("cannot import user %s: %w", user.Username, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Imported %d users from %s, the file is renamed to %s.migrated", len(users), file, file)
+	return os.Rename(file, file+".migrated")
+}
+
+const sqliteUserColumns = `id, username, password_hash, role, created_at, updated_at, access_key_id, access_key_managed, bucket_allowance`
+
+const sqlitePermissionColumns = `user_id, cluster, bucket_id, bucket_name, can_read, can_write, can_delete, manage_lifecycle, manage_cors, manage_website, delete_bucket, owned`
+
+// getSQLiteUsers returns the users matching a condition on the users table,
+// with their bucket permissions.
+func getSQLiteUsers(q querier, where string, args ...any) ([]*schema.User, error) {
+	rows, err := q.Query("SELECT "+sqliteUserColumns+" FROM users "+where+" ORDER BY username", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*schema.User{}
+	byID := map[string]*schema.User{}
+	for rows.Next() {
+		var user schema.User
+		var createdAt, updatedAt string
+		var allowance sql.NullString
+		if err := rows.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &createdAt, &updatedAt,
+			&user.AccessKeyID, &user.AccessKeyManaged, &allowance); err != nil {
+			return nil, err
+		}
+
+		user.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		user.UpdatedAt, _ = time.Parse(time.RFC3339Nano, updatedAt)
+		if allowance.Valid {
+			if err := json.Unmarshal([]byte(allowance.String), &user.BucketAllowance); err != nil {
+				return nil, fmt.Errorf("user %s: invalid bucket allowance: %w", user.Username, err)
+			}
+		}
+		user.BucketPermissions = []*schema.BucketPermission{}
+
+		users = append(users, &user)
+		byID[user.ID] = &user
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return users, nil
+	}
+
+	rows, err = q.Query("SELECT "+sqlitePermissionColumns+" FROM bucket_permissions WHERE user_id IN (SELECT id FROM users "+where+") ORDER BY user_id, position", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		var perm schema.BucketPermission
+		if err := rows.Scan(&userID, &perm.Cluster, &perm.BucketID, &perm.BucketName, &perm.Read, &perm.Write, &perm.Delete,
+			&perm.ManageLifecycle, &perm.ManageCORS, &perm.ManageWebsite, &perm.DeleteBucket, &perm.Owned); err != nil {
+			return nil, err
+		}
+		if user, ok := byID[userID]; ok {
+			user.BucketPermissions = append(user.BucketPermissions, &perm)
+		}
+	}
+
+	return users, rows.Err()
+}
+
+func getSQLiteUser(q querier, where string, args ...any) (*schema.User, error) {
+	users, err := getSQLiteUsers(q, where, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, errors.New("user not found")
+	}
+	return users[0], nil
+}
+
+// writeSQLiteUser inserts or replaces a user and their bucket permissions.
+func writeSQLiteUser(q querier, user *schema.User) error {
+	var allowance sql.NullString
+	if user.BucketAllowance != nil {
+		data, err := json.Marshal(user.BucketAllowance)
+		if err != nil {
+			return err
+		}
+		allowance = sql.NullString{String: string(data), Valid: true}
+	}
+
+	_, err := q.Exec(`INSERT INTO users (`+sqliteUserColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET username = excluded.username, password_hash = excluded.password_hash,
+		role = excluded.role, updated_at = excluded.updated_at, access_key_id = excluded.access_key_id,
+		access_key_managed = excluded.access_key_managed, bucket_allowance = excluded.bucket_allowance`,
+		user.ID, user.Username, user.PasswordHash, user.Role, user.CreatedAt.Format(time.RFC3339Nano),
+		user.UpdatedAt.Format(time.RFC3339Nano), user.AccessKeyID, user.AccessKeyManaged, allowance)
+	if err != nil {
+		return err
+	}
+
+	if _, err := q.Exec("DELETE FROM bucket_permissions WHERE user_id = ?", user.ID); err != nil {
+		return err
+	}
+	for i, perm := range user.BucketPermissions {
+		_, err := q.Exec(`INSERT INTO bucket_permissions (position, `+sqlitePermissionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			i, user.ID, perm.Cluster, perm.BucketID, perm.BucketName, perm.Read, perm.Write, perm.Delete,
+			perm.ManageLifecycle, perm.ManageCORS, perm.ManageWebsite, perm.DeleteBucket, perm.Owned)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func countSQLiteAdmins(q querier) (int, error) {
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM users WHERE role = ?", schema.RoleAdmin).Scan(&count)
+	return count, err
+}
+
+// modify applies a change to a user in a transaction, and saves it.
+func (s *SQLiteUserStore) modify(id string, fn func(tx *sql.Tx, user *schema.User) error) (*schema.User, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	user, err := getSQLiteUser(tx, "WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(tx, user); err != nil {
+		return nil, err
+	}
+	if err := writeSQLiteUser(tx, user); err != nil {
+		return nil, err
+	}
+
+	return user, tx.Commit()
+}
+
+func (s *SQLiteUserStore) GetAll() []*schema.User {
+	users, err := getSQLiteUsers(s.db, "")
+	if err != nil {
+		log.Println("Cannot list users!", err)
+		return []*schema.User{}
+	}
+	return users
+}
+
+func (s *SQLiteUserStore) GetByID(id string) (*schema.User, error) {
+	return getSQLiteUser(s.db, "WHERE id = ?", id)
+}
+
+func (s *SQLiteUserStore) GetByUsername(username string) (*schema.User, error) {
+	return getSQLiteUser(s.db, "WHERE username = ?", username)
+}
+
+func (s *SQLiteUserStore) Create(req *schema.CreateUserRequest) (*schema.User, error) {
+	if err := ResolveBucketPermissions(req.BucketPermissions); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Check if username exists
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", req.Username).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("username already exists")
+	}
+
+	user, err := newUser(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeSQLiteUser(tx, user); err != nil {
+		return nil, err
+	}
+
+	return user, tx.Commit()
+}
+
+func (s *SQLiteUserStore) Update(id string, req *schema.UpdateUserRequest) (*schema.User, error) {
+	if err := ResolveBucketPermissions(req.BucketPermissions); err != nil {
+		return nil, err
+	}
+
+	return s.modify(id, func(tx *sql.Tx, user *schema.User) error {
+		// Prevent demoting the last admin
+		if demotesAdmin(user, req) {
+			admins, err := countSQLiteAdmins(tx)
+			if err != nil {
+				return err
+			}
+			if admins <= 1 {
+				return errors.New("cannot demote the last admin user")
+			}
+		}
+
+		return updateUser(user, req)
+	})
+}
+
+func (s *SQLiteUserStore) SetAccessKey(id string, accessKeyID string, managed bool) (*schema.User, error) {
+	return s.modify(id, func(tx *sql.Tx, user *schema.User) error {
+		user.AccessKeyID = accessKeyID
+		user.AccessKeyManaged = managed && accessKeyID != ""
+		user.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+func (s *SQLiteUserStore) AddBucketPermission(id string, perm *schema.BucketPermission) error {
+	_, err := s.modify(id, func(tx *sql.Tx, user *schema.User) error {
+		user.BucketPermissions = append(user.BucketPermissions, perm)
+		user.UpdatedAt = time.Now()
+		return nil
+	})
+	return err
+}
+
+func (s *SQLiteUserStore) SetBucketPermission(id string, perm *schema.BucketPermission) error {
+	_, err := s.modify(id, func(tx *sql.Tx, user *schema.User) error {
+		setBucketPermission(user, perm)
+		return nil
+	})
+	return err
+}
+
+func (s *SQLiteUserStore) RemoveBucketPermission(id string, cluster string, bucketID string) error {
+	_, err := s.modify(id, func(tx *sql.Tx, user *schema.User) error {
+		removeBucketPermission(user, cluster, bucketID)
+		return nil
+	})
+	return err
+}
+
+func (s *SQLiteUserStore) RevokeBucket(cluster string, bucketID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE users SET updated_at = ? WHERE id IN
+		(SELECT user_id FROM bucket_permissions WHERE cluster = ? AND bucket_id = ?)`,
+		time.Now().Format(time.RFC3339Nano), cluster, bucketID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM bucket_permissions WHERE cluster = ? AND bucket_id = ?", cluster, bucketID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteUserStore) Delete(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	user, err := getSQLiteUser(tx, "WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	// Prevent deleting the last admin
+	if user.Role == schema.RoleAdmin {
+		admins, err := countSQLiteAdmins(tx)
+		if err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return errors.New("cannot delete the last admin user")
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM users WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteUserStore) ValidateCredentials(username, password string) (*schema.User, error) {
+	user, err := s.GetByUsername(username)
+	return validateCredentials(user, err, password)
+}
+
+func (s *SQLiteUserStore) HasBucketPermission(cluster *garage, userID, bucket string) bool {
+	return s.hasBucketPermission(cluster, userID, bucket, resolveBucket(cluster, bucket), "")
+}
+
+func (s *SQLiteUserStore) HasListedBucketPermission(cluster *garage, userID string, bucket *schema.GetBucketsRes) bool {
+	info := &schema.Bucket{ID: bucket.ID, GlobalAliases: bucket.GlobalAliases}
+	return s.hasBucketPermission(cluster, userID, bucket.ID, info, "")
+}
+
+func (s *SQLiteUserStore) HasBucketPermissionDetailed(cluster *garage, userID, bucket, action string) bool {
+	return s.hasBucketPermission(cluster, userID, bucket, resolveBucket(cluster, bucket), action)
+}
+
+func (s *SQLiteUserStore) hasBucketPermission(cluster *garage, userID string, bucket string, info *schema.Bucket, action string) bool {
+	user, err := s.GetByID(userID)
+	return err == nil && hasUserBucketPermission(user, cluster, bucket, info, action)
+}
+
+func (s *SQLiteUserStore) MigrateBucketPermissions() error {
+	users := s.GetAll()
+	refs, errs := getBucketPermissionRefs(users)
+
+	for _, user := range users {
+		if !bindBucketPermissions(user, refs) {
+			continue
+		}
+
+		_, err := s.modify(user.ID, func(tx *sql.Tx, user *schema.User) error {
+			bindBucketPermissions(user, refs)
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", user.Username, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"encoding/json"
+	"khairul169/garage-webui/garageapi"
 	"net/http"
 	"os"
 )
@@ -18,8 +19,18 @@ func LastString(str []string) string {
 	return str[len(str)-1]
 }
 
+// ResponseError writes err with status 500. Bad request, not found and
+// conflict errors of the admin API keep their status, and an admin token
+// rejected by Garage is a bad gateway rather than an unauthenticated session.
 func ResponseError(w http.ResponseWriter, err error) {
-	w.WriteHeader(http.StatusInternalServerError)
+	status := http.StatusInternalServerError
+	switch s := garageapi.StatusOf(err); s {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusConflict:
+		status = s
+	case http.StatusUnauthorized, http.StatusForbidden:
+		status = http.StatusBadGateway
+	}
+	w.WriteHeader(status)
 	w.Write([]byte(err.Error()))
 }
 
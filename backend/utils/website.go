@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"khairul169/garage-webui/schema"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const defaultIndexDocument = "index.html"
+
+// GetWebsite returns the website hosting state of a bucket, by id or alias.
+func (g *garage) GetWebsite(ctx context.Context, bucket string) (*schema.WebsiteInfo, error) {
+	info, err := g.GetBucketInfo(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch the bucket again, the cached info may predate a change
+	info, err = g.Client().GetBucketInfo(ctx, info.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.getWebsiteInfo(info), nil
+}
+
+// UpdateWebsite enables or disables website hosting on a bucket.
+func (g *garage) UpdateWebsite(ctx context.Context, bucket string, req *schema.UpdateWebsiteAccess) (*schema.WebsiteInfo, error) {
+	info, err := g.GetBucketInfo(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Enabled && req.IndexDocument == "" {
+		req.IndexDocument = defaultIndexDocument
+	}
+	if !req.Enabled {
+		req.IndexDocument = ""
+		req.ErrorDocument = ""
+	}
+	if strings.HasPrefix(req.IndexDocument, "/") || strings.HasPrefix(req.ErrorDocument, "/") {
+		return nil, errors.New("documents must be relative to the bucket root")
+	}
+
+	info, err = g.Client().UpdateBucket(ctx, info.ID, &schema.UpdateBucketRequest{WebsiteAccess: req})
+	if err != nil {
+		return nil, err
+	}
+
+	g.S3Clients().InvalidateBucket(info.ID)
+	g.BucketList().Invalidate(info.ID)
+
+	return g.getWebsiteInfo(info), nil
+}
+
+func (g *garage) getWebsiteInfo(bucket *schema.Bucket) *schema.WebsiteInfo {
+	res := &schema.WebsiteInfo{
+		Enabled:       bucket.WebsiteAccess,
+		IndexDocument: bucket.WebsiteConfig.IndexDocument,
+		ErrorDocument: bucket.WebsiteConfig.ErrorDocument,
+		URLs:          []string{},
+	}
+	if !bucket.WebsiteAccess {
+		return res
+	}
+
+	for _, alias := range bucket.GlobalAliases {
+		res.URLs = append(res.URLs, g.GetWebsiteURLs(alias)...)
+	}
+	return res
+}
+
+// GetWebsiteURLs returns the public URLs of the website of a global alias.
+// They are computed from the s3_web section of garage.toml: Garage serves a
+// bucket at its alias followed by the root domain, and at its alias when it
+// is a domain name. WEBSITE_URL overrides them, with {bucket} replaced by
+// the alias.
+func (g *garage) GetWebsiteURLs(alias string) []string {
+	if template := g.getEnv("WEBSITE_URL", ""); template != "" {
+		return []string{strings.ReplaceAll(template, "{bucket}", alias)}
+	}
+
+	web := g.Config.S3Web
+	if web.BindAddr == "" {
+		return nil
+	}
+
+	port := ""
+	if _, p, err := net.SplitHostPort(web.BindAddr); err == nil && p != "80" {
+		port = ":" + p
+	}
+
+	var res []string
+	if domain := strings.Trim(web.RootDomain, "."); domain != "" {
+		res = append(res, fmt.Sprintf("http://%s.%s%s", alias, domain, port))
+	}
+	if strings.Contains(alias, ".") {
+		res = append(res, fmt.Sprintf("http://%s%s", alias, port))
+	}
+	return res
+}
+
+// GetWebsiteMaxSize returns the WEBSITE_UPLOAD_MAX_SIZE limit of the site
+// archives and of their extracted content.
+func GetWebsiteMaxSize() int64 {
+	size, err := strconv.ParseInt(GetEnv("WEBSITE_UPLOAD_MAX_SIZE", "536870912"), 10, 64)
+	if err != nil || size <= 0 {
+		return 512 << 20
+	}
+	return size
+}
+
+// UploadWebsiteArchive extracts a ZIP archive into a bucket, under prefix.
+// When every file is in the same top-level directory, that directory is
+// stripped so a zipped build folder lands at the root of the site. The
+// archive is checked before anything is uploaded.
+func UploadWebsiteArchive(ctx context.Context, client *S3Bucket, archive io.ReaderAt, size int64, prefix string) (*schema.WebsiteUploadResult, error) {
+	maxSize := GetWebsiteMaxSize()
+	if size > maxSize {
+		return nil, fmt.Errorf("archive is larger than %d bytes", maxSize)
+	}
+
+	zr, err := zip.NewReader(archive, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %w", err)
+	}
+
+	var files []*zip.File
+	var names []string
+	var total uint64
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		name, err := getArchiveFileName(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(name, "__MACOSX/") || path.Base(name) == ".DS_Store" {
+			continue
+		}
+
+		total += f.UncompressedSize64
+		if total > uint64(maxSize) {
+			return nil, fmt.Errorf("archive content is larger than %d bytes", maxSize)
+		}
+
+		files = append(files, f)
+		names = append(names, name)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("archive has no files")
+	}
+
+	root := getArchiveRoot(names)
+	res := &schema.WebsiteUploadResult{Keys: []string{}}
+
+	for i, f := range files {
+		key := prefix + strings.TrimPrefix(names[i], root)
+		n, err := putArchiveFile(ctx, client, f, key)
+		if err != nil {
+			return res, fmt.Errorf("cannot upload %s: %w", names[i], err)
+		}
+
+		Index.Refresh(client, key)
+		res.Files++
+		res.Bytes += n
+		res.Keys = append(res.Keys, key)
+	}
+
+	return res, nil
+}
+
+// getArchiveFileName cleans the path of an archive entry, rejecting paths
+// escaping the archive root.
+func getArchiveFileName(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	clean := path.Clean(name)
+	if strings.HasPrefix(name, "/") || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid path in archive: %q", name)
+	}
+	return clean, nil
+}
+
+// getArchiveRoot returns the top-level directory shared by every file, with
+// its trailing slash, or an empty string.
+func getArchiveRoot(names []string) string {
+	dir, _, ok := strings.Cut(names[0], "/")
+	if !ok {
+		return ""
+	}
+	root := dir + "/"
+	for _, name := range names[1:] {
+		if !strings.HasPrefix(name, root) {
+			return ""
+		}
+	}
+	return root
+}
+
+// putArchiveFile streams an archive entry to the bucket, with the content
+// type of its extension, or sniffed from its content. The zip reader fails
+// when the entry doesn't match the size of its header.
+func putArchiveFile(ctx context.Context, client *S3Bucket, f *zip.File, key string) (int64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	body := bufio.NewReaderSize(rc, 512)
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		head, err := body.Peek(512)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		contentType = http.DetectContentType(head)
+	}
+
+	// The payload isn't hashed, as the entry can't be read twice to sign it
+	size := int64(f.UncompressedSize64)
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(client.Name),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(contentType),
+	}, s3.WithAPIOptions(v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware))
+	return size, err
+}
@@ -20,13 +20,13 @@ type Props = {
 };
 
 const Actions = ({ prefix }: Props) => {
-  const { bucketName } = useBucketContext();
+  const { bucket } = useBucketContext();
   const queryClient = useQueryClient();
   const [uploadFiles, setUploadFiles] = useState<UploadFile[]>([]);
   const { isOpen, onOpen, onClose } = useDisclosure();
 
   const handleUploadComplete = () => {
-    queryClient.invalidateQueries({ queryKey: ["browse", bucketName] });
+    queryClient.invalidateQueries({ queryKey: ["browse", bucket.id] });
   };
 
   const handleCloseDialog = () => {
@@ -89,7 +89,7 @@ const Actions = ({ prefix }: Props) => {
 
       try {
         // Use uploadFile function which automatically handles multipart for large files
-        await uploadFile(bucketName, key, file, {
+        await uploadFile(bucket.id, key, file, {
           onProgress: (progress) => {
             setUploadFiles((prev) =>
               prev.map((f, idx) =>
@@ -167,7 +167,7 @@ type CreateFolderActionProps = {
 
 const CreateFolderAction = ({ prefix }: CreateFolderActionProps) => {
   const { isOpen, onOpen, onClose } = useDisclosure();
-  const { bucketName } = useBucketContext();
+  const { bucket } = useBucketContext();
   const queryClient = useQueryClient();
 
   const form = useForm<CreateFolderSchema>({
@@ -179,10 +179,10 @@ const CreateFolderAction = ({ prefix }: CreateFolderActionProps) => {
     if (isOpen) form.setFocus("name");
   }, [isOpen]);
 
-  const createFolder = usePutObject(bucketName, {
+  const createFolder = usePutObject(bucket.id, {
     onSuccess: () => {
       toast.success("Folder created!");
-      queryClient.invalidateQueries({ queryKey: ["browse", bucketName] });
+      queryClient.invalidateQueries({ queryKey: ["browse", bucket.id] });
       onClose();
       form.reset();
     },
@@ -18,15 +18,15 @@ type Props = {
 };
 
 const ObjectActions = ({ prefix = "", object, end }: Props) => {
-  const { bucketName } = useBucketContext();
+  const { bucket } = useBucketContext();
   const queryClient = useQueryClient();
   const isDirectory = object.objectKey.endsWith("/");
   const openDeleteDialog = useDeleteDialogStore((state) => state.open);
 
-  const deleteObject = useDeleteObject(bucketName, {
+  const deleteObject = useDeleteObject(bucket.id, {
     onSuccess: () => {
       toast.success("Object deleted!");
-      queryClient.invalidateQueries({ queryKey: ["browse", bucketName] });
+      queryClient.invalidateQueries({ queryKey: ["browse", bucket.id] });
     },
     onError: handleError,
   });
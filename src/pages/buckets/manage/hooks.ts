@@ -116,16 +116,13 @@ export const useLifecycleConfiguration = (bucket?: string) => {
   const query = useQuery({
     queryKey: ["lifecycle", bucket],
     queryFn: () =>
-      api.get<LifecycleConfiguration>("/buckets/lifecycle", {
-        params: { bucket },
-      }),
+      api.get<LifecycleConfiguration>(`/buckets/${bucket}/lifecycle`),
     enabled: !!bucket,
   });
 
   const updateMutation = useMutation({
     mutationFn: (data: { rules: LifecycleConfiguration["rules"] }) =>
-      api.put<{ message: string }>("/buckets/lifecycle", {
-        params: { bucket },
+      api.put<{ message: string }>(`/buckets/${bucket}/lifecycle`, {
         body: data,
       }),
     onSuccess: () => {
@@ -135,9 +132,7 @@ export const useLifecycleConfiguration = (bucket?: string) => {
 
   const deleteMutation = useMutation({
     mutationFn: () =>
-      api.delete<{ message: string }>("/buckets/lifecycle", {
-        params: { bucket },
-      }),
+      api.delete<{ message: string }>(`/buckets/${bucket}/lifecycle`),
     onSuccess: () => {
       query.refetch();
     },